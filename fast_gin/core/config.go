@@ -18,13 +18,149 @@ type DatabaseConfig struct {
 	TimeZone string `yaml:"timezone"`
 }
 
+// ProviderConfig 单个厂商的上游配置
+type ProviderConfig struct {
+	BaseURL string `yaml:"base_url"` // 上游地址，为空时使用厂商官方地址
+	APIKey  string `yaml:"api_key"`  // 上游密钥
+}
+
+// RelayConfig 网关上游转发配置
+type RelayConfig struct {
+	Timeout      int                       `yaml:"timeout"`       // 请求超时（秒）
+	MaxAttempts  int                       `yaml:"max_attempts"`  // 单次请求最多尝试的渠道数
+	EjectSeconds int                       `yaml:"eject_seconds"` // 失败渠道临时剔除时长（秒）
+	Providers    map[string]ProviderConfig `yaml:"providers"`     // 按厂商名称（openai, anthropic, gemini）配置
+	Probe        ProbeConfig               `yaml:"probe"`         // 上游健康探测
+}
+
+// ProbeConfig 上游健康探测配置
+type ProbeConfig struct {
+	Enabled          bool `yaml:"enabled"`           // 是否启用后台探测
+	Interval         int  `yaml:"interval"`          // 探测间隔（秒）
+	Timeout          int  `yaml:"timeout"`           // 单次探测超时（秒）
+	WindowHours      int  `yaml:"window_hours"`      // 可用率统计窗口（小时）
+	FailThreshold    int  `yaml:"fail_threshold"`    // 连续失败多少次转为 maintenance
+	DownThreshold    int  `yaml:"down_threshold"`    // 连续失败多少次转为 inactive
+	RecoverThreshold int  `yaml:"recover_threshold"` // 连续成功多少次恢复 active
+	RetentionDays    int  `yaml:"retention_days"`    // 探测记录保留天数
+}
+
+// RateLimitConfig 网关限流配置，0表示不限制
+type RateLimitConfig struct {
+	Store   string `yaml:"store"`    // memory（单实例）或 database（多实例共享）
+	KeyRPM  int    `yaml:"key_rpm"`  // 每个API密钥每分钟请求数
+	KeyTPM  int    `yaml:"key_tpm"`  // 每个API密钥每分钟Token数
+	UserRPM int    `yaml:"user_rpm"` // 每个用户每分钟请求数
+	UserTPM int    `yaml:"user_tpm"` // 每个用户每分钟Token数
+}
+
+// BillingConfig 预付费计费配置
+type BillingConfig struct {
+	Enabled       bool    `yaml:"enabled"`        // 是否在转发前冻结余额并按实际用量结算
+	InitialCredit float64 `yaml:"initial_credit"` // 新建用户钱包的赠送额度，组织钱包不赠送
+	// DefaultHoldOutputTokens 请求和服务都未限制输出长度时，冻结余额按每个候选的该补全 Token 数估算，0 表示使用默认值 4096
+	DefaultHoldOutputTokens int `yaml:"default_hold_output_tokens"`
+}
+
+// OrganizationConfig 组织配置
+type OrganizationConfig struct {
+	MaxPerUser int `yaml:"max_per_user"` // 每个用户最多创建的组织数（含已删除），0 表示使用默认值 5
+}
+
+// SecurityConfig 安全配置
+type SecurityConfig struct {
+	SecretKey       string `yaml:"secret_key"`        // 服务端密钥，用于加密渠道凭据等敏感数据，可用环境变量 SECRET_KEY 覆盖
+	JWTSecret       string `yaml:"jwt_secret"`        // JWT 签名密钥，可用环境变量 JWT_SECRET 覆盖；为空时由 secret_key 派生
+	AccessTokenTTL  int    `yaml:"access_token_ttl"`  // 访问令牌有效期（秒）
+	RefreshTokenTTL int    `yaml:"refresh_token_ttl"` // 刷新令牌有效期（秒）
+	ImpersonateTTL  int    `yaml:"impersonate_ttl"`   // 模拟登录令牌有效期（秒），默认 30 分钟，不可刷新
+
+	JWTAlgorithm  string         `yaml:"jwt_algorithm"`   // HS256（默认）或 RS256
+	JWTSigningKid string         `yaml:"jwt_signing_kid"` // RS256 签名使用的密钥，为空时使用第一个带私钥的密钥
+	JWTKeys       []JWTKeyConfig `yaml:"jwt_keys"`        // RS256 密钥集，轮换后的旧密钥保留公钥用于验证
+
+	TOTPIssuer string `yaml:"totp_issuer"` // 验证器应用中显示的发行方名称
+
+	Login LoginProtectionConfig `yaml:"login"` // 登录防暴力破解
+
+	PlainPassword bool   `yaml:"plain_password"` // 允许登录和注册提交明文密码，仅用于本地开发
+	LoginKeyFile  string `yaml:"login_key_file"` // 加密登录载荷的 RSA 私钥（PEM），为空时每次启动随机生成
+
+	RequireEmailVerification bool `yaml:"require_email_verification"` // 新注册账号在验证邮箱前保持 inactive
+
+	RegistrationMode string `yaml:"registration_mode"` // open（默认）或 invite_only，管理员可在系统设置中覆盖
+}
+
+// LoginProtectionConfig 登录防暴力破解配置，0 表示使用默认值
+type LoginProtectionConfig struct {
+	FreeAttempts     int `yaml:"free_attempts"`     // 不触发退避的连续失败次数
+	BackoffSeconds   int `yaml:"backoff_seconds"`   // 退避初始时长，之后每次失败翻倍
+	MaxBackoff       int `yaml:"max_backoff"`       // 退避时长上限（秒）
+	MaxFailures      int `yaml:"max_failures"`      // 账号连续失败多少次后临时锁定
+	LockMinutes      int `yaml:"lock_minutes"`      // 账号锁定时长（分钟）
+	IPFreeAttempts   int `yaml:"ip_free_attempts"`  // 同一 IP 不触发退避的失败次数
+	IPMaxFailures    int `yaml:"ip_max_failures"`   // 同一 IP 在窗口内失败多少次后封禁
+	IPBlockMinutes   int `yaml:"ip_block_minutes"`  // IP 封禁时长（分钟）
+	WindowMinutes    int `yaml:"window_minutes"`    // 失败计数窗口，超过窗口未再失败则重新计数
+	HistoryRetention int `yaml:"history_retention"` // 登录历史保留天数
+}
+
+// JWTKeyConfig RS256 签名密钥
+type JWTKeyConfig struct {
+	Kid            string `yaml:"kid"`              // 为空时由公钥指纹生成
+	PrivateKeyFile string `yaml:"private_key_file"` // PEM 私钥，可签名
+	PublicKeyFile  string `yaml:"public_key_file"`  // PEM 公钥，只用于验证
+}
+
+// MailConfig 邮件发送配置
+type MailConfig struct {
+	Driver      string     `yaml:"driver"`        // smtp、file（写入目录）或 memory（只记录日志，默认）
+	From        string     `yaml:"from"`          // 发件人，例如 "AI Hub <noreply@example.com>"
+	Dir         string     `yaml:"dir"`           // file 驱动的输出目录
+	LinkBaseURL string     `yaml:"link_base_url"` // 邮件中链接指向的前端地址
+	SMTP        SMTPConfig `yaml:"smtp"`
+}
+
+// SMTPConfig SMTP 服务器配置
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	TLS      bool   `yaml:"tls"` // 直接使用 TLS 连接（465 端口）；为 false 时尝试 STARTTLS
+}
+
+// OIDCConfig OpenID Connect 单点登录配置
+type OIDCConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	DisplayName   string            `yaml:"display_name"` // 登录页按钮显示的名称
+	Issuer        string            `yaml:"issuer"`       // 身份提供方地址，用于读取发现文档
+	ClientID      string            `yaml:"client_id"`
+	ClientSecret  string            `yaml:"client_secret"`  // 公共客户端留空，仅使用 PKCE
+	RedirectURL   string            `yaml:"redirect_url"`   // 指向 /api/auth/oidc/callback
+	Scopes        []string          `yaml:"scopes"`         // 默认 openid profile email
+	FrontendURL   string            `yaml:"frontend_url"`   // 登录完成后跳转的前端页面，令牌放在 URL 片段中
+	AutoProvision bool              `yaml:"auto_provision"` // 首次登录时自动创建账号
+	LinkByEmail   bool              `yaml:"link_by_email"`  // 按身份提供方已验证的邮箱关联已有账号
+	DefaultRole   string            `yaml:"default_role"`   // 自动创建账号的默认角色
+	GroupsClaim   string            `yaml:"groups_claim"`   // ID Token 中组信息的声明名，例如 groups
+	RoleMapping   map[string]string `yaml:"role_mapping"`   // 组 → 角色名，每次登录同步映射到的角色
+}
+
 // 定义配置结构体
 type Config struct {
 	Server struct {
 		Port string `yaml:"port"`
 		Host string `yaml:"host"`
 	} `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
+	Database  DatabaseConfig     `yaml:"database"`
+	Relay     RelayConfig        `yaml:"relay"`
+	RateLimit RateLimitConfig    `yaml:"ratelimit"`
+	Billing   BillingConfig      `yaml:"billing"`
+	Org       OrganizationConfig `yaml:"organization"`
+	Security  SecurityConfig     `yaml:"security"`
+	Mail      MailConfig         `yaml:"mail"`
+	OIDC      OIDCConfig         `yaml:"oidc"`
 }
 
 // 全局配置变量
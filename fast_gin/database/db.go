@@ -8,6 +8,7 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 
 	"go.uber.org/zap"
@@ -116,6 +117,19 @@ func GetDB() *gorm.DB {
 	return DB
 }
 
+// Transaction 在事务中执行 fn，fn 返回错误或 panic 时回滚
+func Transaction(fn func(tx *gorm.DB) error) error {
+	if DB == nil {
+		return fmt.Errorf("database not initialized")
+	}
+	return DB.Transaction(fn)
+}
+
+// ForUpdate 为查询加上 SELECT ... FOR UPDATE 行锁，需在事务中使用
+func ForUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+}
+
 // Close 关闭数据库连接
 func Close() error {
 	if DB != nil {
@@ -0,0 +1,54 @@
+// Package dbtest 提供测试用的内存 SQLite 数据库
+package dbtest
+
+import (
+	"strings"
+	"testing"
+
+	"macg/database"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// sqliteDialector 去掉 PostgreSQL 专用的 gen_random_uuid() 默认值，主键由模型的 BeforeCreate 生成
+type sqliteDialector struct {
+	gorm.Dialector
+}
+
+func (d sqliteDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return sqliteMigrator{d.Dialector.Migrator(db).(sqlite.Migrator)}
+}
+
+type sqliteMigrator struct {
+	sqlite.Migrator
+}
+
+func (m sqliteMigrator) FullDataTypeOf(field *schema.Field) clause.Expr {
+	expr := m.Migrator.FullDataTypeOf(field)
+	expr.SQL = strings.Replace(expr.SQL, " DEFAULT gen_random_uuid()", "", 1)
+	return expr
+}
+
+// Open 打开内存 SQLite 数据库并迁移 models，设为 database.DB，测试结束时自动关闭
+func Open(tb testing.TB, models ...interface{}) *gorm.DB {
+	tb.Helper()
+
+	db, err := gorm.Open(sqliteDialector{sqlite.Open("file::memory:")}, &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		tb.Fatalf("open sqlite: %v", err)
+	}
+	// 每个连接都是独立的内存数据库，只保留一个连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	tb.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		tb.Fatalf("migrate: %v", err)
+	}
+	database.DB = db
+	return db
+}
@@ -0,0 +1,219 @@
+package gins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"macg/core"
+	"macg/mailer"
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// 找回密码与邮箱验证 API
+// ============================================================================
+
+// EmailRequest 只包含邮箱的请求
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求，密码可明文或按 LoginPayload 加密提交
+type ResetPasswordRequest struct {
+	Token             string `json:"token" binding:"required"`
+	Password          string `json:"password"`
+	EncryptedPassword string `json:"encrypted_password"`
+}
+
+// VerifyEmailRequest 验证邮箱请求
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// emailLink 生成邮件中指向前端页面的链接
+func emailLink(path, token string) string {
+	base := strings.TrimRight(core.Cfg.Mail.LinkBaseURL, "/")
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendMailAsync 后台发送邮件，避免响应时间暴露邮箱是否已注册
+func sendMailAsync(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mailer.Send(ctx, msg); err != nil {
+			zap.L().Error("发送邮件失败", zap.String("to", msg.To), zap.String("subject", msg.Subject), zap.Error(err))
+		}
+	}()
+}
+
+// sendPasswordResetEmail 发送重置密码邮件
+func sendPasswordResetEmail(user *models.User, token string) {
+	link := emailLink("/reset-password", token)
+	sendMailAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "重置密码",
+		Text: fmt.Sprintf("%s，您好：\n\n请在 %d 分钟内打开以下链接重置密码：\n%s\n\n如果这不是您本人的操作，请忽略本邮件。\n",
+			user.Username, int(models.PasswordResetTTL/time.Minute), link),
+	})
+}
+
+// sendVerificationEmail 发送邮箱验证邮件
+func sendVerificationEmail(user *models.User, token string) {
+	link := emailLink("/verify-email", token)
+	sendMailAsync(mailer.Message{
+		To:      user.Email,
+		Subject: "验证邮箱",
+		Text: fmt.Sprintf("%s，您好：\n\n请在 %d 小时内打开以下链接验证邮箱：\n%s\n",
+			user.Username, int(models.VerifyEmailTTL/time.Hour), link),
+	})
+}
+
+// ForgotPasswordAPI 申请重置密码，无论邮箱是否注册都返回相同结果
+func ForgotPasswordAPI(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	user, token, err := models.CreatePasswordResetToken(req.Email)
+	switch {
+	case errors.Is(err, models.ErrEmailTokenTooFrequent):
+		// 按正常流程返回，避免暴露邮箱是否已注册
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	case user != nil:
+		sendPasswordResetEmail(user, token)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "如果该邮箱已注册，重置密码邮件已发送",
+	})
+}
+
+// ResetPasswordAPI 使用邮件中的令牌设置新密码
+func ResetPasswordAPI(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	password, err := resolvePassword(req.Password, req.EncryptedPassword)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	if utf8.RuneCountInString(password) < 6 {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "密码长度不能少于6位",
+		})
+		return
+	}
+
+	if _, err := models.ResetPassword(req.Token, password); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrEmailTokenInvalid) || errors.Is(err, models.ErrEmailTokenExpired) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "密码已重置，请重新登录",
+	})
+}
+
+// VerifyEmailAPI 使用邮件中的令牌验证邮箱
+func VerifyEmailAPI(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	user, err := models.VerifyEmail(req.Token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrEmailTokenInvalid) || errors.Is(err, models.ErrEmailTokenExpired) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "邮箱验证成功",
+		Data: gin.H{
+			"username": user.Username,
+			"email":    user.Email,
+		},
+	})
+}
+
+// ResendVerificationAPI 重新发送验证邮件，无论邮箱是否注册都返回相同结果
+func ResendVerificationAPI(c *gin.Context) {
+	var req EmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	user, token, err := models.ResendEmailVerification(req.Email)
+	switch {
+	case errors.Is(err, models.ErrEmailTokenTooFrequent):
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	case user != nil:
+		sendVerificationEmail(user, token)
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "如果该邮箱已注册且未验证，验证邮件已发送",
+	})
+}
@@ -0,0 +1,234 @@
+package gins
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// API 密钥管理 API
+// ============================================================================
+
+// CreateAPIKeyRequest 创建密钥请求
+type CreateAPIKeyRequest struct {
+	Name        string     `json:"name" binding:"required"`
+	Permissions string     `json:"permissions"` // 逗号分隔，为空时不限制
+	ExpiresAt   *time.Time `json:"expires_at"`  // 为空时永不过期
+}
+
+// apiKeyOwner 当前请求操作的密钥归属：组织上下文中为组织密钥，否则为个人密钥
+func apiKeyOwner(c *gin.Context) models.APIKeyOwner {
+	return models.APIKeyOwner{
+		UserID:         currentUserID(c),
+		OrganizationID: currentOrgID(c),
+	}
+}
+
+// GetMyAPIKeys 获取当前用户（或当前组织）的密钥列表
+func GetMyAPIKeys(c *gin.Context) {
+	keys, err := models.GetAPIKeys(apiKeyOwner(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    keys,
+	})
+}
+
+// CreateMyAPIKey 为当前用户（或当前组织）创建密钥，完整密钥只在此处返回一次
+func CreateMyAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "expires_at must be in the future",
+		})
+		return
+	}
+
+	apiKey, fullKey, err := models.GenerateAPIKey(apiKeyOwner(c), req.Name, req.Permissions, req.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "api key created successfully",
+		Data: gin.H{
+			"api_key": apiKey,
+			"key":     fullKey,
+		},
+	})
+}
+
+// UpdateMyAPIKey 修改当前用户（或当前组织）密钥的名称、权限范围或过期时间
+func UpdateMyAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid api key id",
+		})
+		return
+	}
+
+	var updates map[string]interface{}
+	if err := c.ShouldBindJSON(&updates); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	apiKey, err := models.UpdateAPIKey(id, apiKeyOwner(c), updates)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "api key updated successfully",
+		Data:    apiKey,
+	})
+}
+
+// RevokeMyAPIKey 撤销当前用户（或当前组织）的密钥
+func RevokeMyAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid api key id",
+		})
+		return
+	}
+
+	if err := models.RevokeAPIKey(id, apiKeyOwner(c)); err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "api key revoked successfully",
+	})
+}
+
+// DeleteMyAPIKey 删除当前用户（或当前组织）的密钥
+func DeleteMyAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid api key id",
+		})
+		return
+	}
+
+	if err := models.DeleteAPIKey(id, apiKeyOwner(c)); err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "api key deleted successfully",
+	})
+}
+
+// AdminGetAPIKeys 分页查看所有用户的密钥，可按 user_id 过滤
+func AdminGetAPIKeys(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	var userID *uuid.UUID
+	if raw := c.Query("user_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "invalid user id",
+			})
+			return
+		}
+		userID = &id
+	}
+
+	keys, total, err := models.GetAllAPIKeys(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"keys":  keys,
+			"total": total,
+		},
+	})
+}
+
+// AdminRevokeAPIKey 撤销任意用户的密钥
+func AdminRevokeAPIKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid api key id",
+		})
+		return
+	}
+
+	if err := models.AdminRevokeAPIKey(id); err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "api key revoked successfully",
+	})
+}
@@ -3,8 +3,10 @@ package gins
 import (
 	"fmt"
 	"macg/global"
+	"macg/models"
 	"macg/utils"
-	"macg/utils/ResponeResult"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -32,52 +34,239 @@ func userAgentMiddleware() gin.HandlerFunc {
 	}
 }
 
-func authMiddleware() gin.HandlerFunc {
+// API密钥验证中间件（用于 /v1 网关接口）
+func apiKeyMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从查询参数获取token
-		token := c.Query("token")
-		if token == "" {
-			c.JSON(200, ResponeResult.OkResult(gin.H{"error": "登录已过期"}))
-			c.Abort()
+		key := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if !strings.HasPrefix(key, "sk-") {
+			relayError(c, http.StatusUnauthorized, "invalid_request_error", "missing or malformed API key")
 			return
 		}
 
-		// 验证JWT的有效性
-		username, err := utils.GetSub(token)
-		if err != nil || username == "" {
-			c.JSON(200, ResponeResult.OkResult(gin.H{"error": "登录已过期"}))
-			c.Abort()
+		apiKey, err := models.GetAPIKeyByKey(key)
+		if err != nil {
+			relayError(c, http.StatusUnauthorized, "invalid_api_key", err.Error())
+			return
+		}
+
+		user, err := models.GetUserByID(apiKey.UserID)
+		if err != nil {
+			relayError(c, http.StatusUnauthorized, "invalid_api_key", err.Error())
+			return
+		}
+		if user.Status != "active" {
+			relayError(c, http.StatusForbidden, "permission_denied", "账号已被禁用")
 			return
 		}
 
-		// 将用户名存储在上下文中，供后续处理使用
-		c.Set("username", username)
+		// 组织密钥在组织停用或删除后不可用
+		if apiKey.OrganizationID != nil {
+			org, err := models.GetOrganizationByID(*apiKey.OrganizationID)
+			if err != nil {
+				relayError(c, http.StatusUnauthorized, "invalid_api_key", err.Error())
+				return
+			}
+			if org.Status != "active" {
+				relayError(c, http.StatusForbidden, "permission_denied", "组织已停用")
+				return
+			}
+			c.Set("org_id", org.ID)
+		}
+
+		// 通过全部检查后才记录最近使用时间
+		models.TouchAPIKey(apiKey.ID)
+
+		// 将密钥和所属用户存储在上下文中
+		c.Set("api_key", apiKey)
+		c.Set("user", user)
+		c.Set("user_id", apiKey.UserID)
 
 		c.Next()
 	}
 }
 
-func loginMiddleware() gin.HandlerFunc {
+// requireScope 要求 API 密钥拥有指定权限范围，需在 apiKeyMiddleware 之后使用
+func requireScope(scope string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从查询参数获取token
-		token := c.Query("token")
+		apiKey := c.MustGet("api_key").(*models.APIKey)
+		if !apiKey.HasScope(scope) {
+			relayError(c, http.StatusForbidden, "permission_denied", "API key does not have the '"+scope+"' scope")
+			return
+		}
+		c.Next()
+	}
+}
+
+// tokenFromRequest 依次从 Authorization: Bearer、token Cookie 和 token 查询参数中读取登录令牌
+func tokenFromRequest(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		if token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")); token != "" {
+			return token
+		}
+	}
+	if token, err := c.Cookie("token"); err == nil && token != "" {
+		return token
+	}
+	return c.Query("token")
+}
+
+// AuthMiddleware 登录验证中间件：校验 JWT 并将当前用户（含角色）存储在上下文中
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := tokenFromRequest(c)
 		if token == "" {
-			c.JSON(200, ResponeResult.OkResult(gin.H{"error": "登录已过期"}))
-			c.Abort()
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: "未登录",
+			})
 			return
 		}
 
-		// 验证JWT的有效性
-		username, err := utils.GetSub(token)
-		if err != nil || username == "" {
-			c.JSON(200, ResponeResult.OkResult(gin.H{"error": "登录已过期"}))
-			c.Abort()
+		claims, err := utils.ParseJWT(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: "登录已过期",
+			})
+			return
+		}
+		username, _ := claims["sub"].(string)
+		jti, _ := claims["jti"].(string)
+		if claims["typ"] != utils.TokenTypeAccess || username == "" || jti == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: "令牌无效",
+			})
 			return
 		}
 
-		// 将用户名存储在上下文中，供后续处理使用
-		c.Set("username", username)
+		revoked, err := models.IsAccessTokenRevoked(jti)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: err.Error(),
+			})
+			return
+		}
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: "登录已失效",
+			})
+			return
+		}
+
+		user, err := models.GetUserWithRoles(username)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: err.Error(),
+			})
+			return
+		}
+		if user.Status != "active" {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+				Code:    403,
+				Message: "账号已被禁用",
+			})
+			return
+		}
+		// 修改密码或退出所有设备后，旧版本的令牌失效
+		if version, _ := claims["ver"].(float64); int(version) != user.TokenVersion {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+				Code:    401,
+				Message: "登录已失效",
+			})
+			return
+		}
+
+		c.Set("token_claims", claims)
+		c.Set("username", user.Username)
+		c.Set("user", user)
+		c.Set("user_id", user.ID)
+
+		if !resolveImpersonation(c, claims, jti) {
+			return
+		}
+
+		if !resolveOrgContext(c, user) {
+			return
+		}
+
+		// 角色要求双因素认证但尚未启用时，只允许访问启用流程相关接口
+		if models.UserRequiresTwoFactor(user) && !twoFactorExempt(c.FullPath()) {
+			enabled, err := models.IsTwoFactorEnabled(user.ID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+					Code:    500,
+					Message: err.Error(),
+				})
+				return
+			}
+			if !enabled {
+				c.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+					Code:    403,
+					Message: "当前角色要求启用双因素认证，请先完成设置",
+					Data:    gin.H{"two_factor_setup_required": true},
+				})
+				return
+			}
+		}
 
 		c.Next()
+		auditImpersonatedRequest(c)
+	}
+}
+
+// twoFactorExempt 未启用双因素认证时仍可访问的接口
+func twoFactorExempt(path string) bool {
+	switch path {
+	case "/api/auth/logout", "/api/auth/impersonation/stop", "/api/me/permissions":
+		return true
 	}
+	return strings.HasPrefix(path, "/api/me/2fa")
+}
+
+// RequirePermission 要求当前用户拥有任一指定权限，需在 AuthMiddleware 之后使用
+// 需要同时满足多个权限时串联多个 RequirePermission
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.MustGet("user_id").(uuid.UUID)
+		for _, permission := range permissions {
+			ok, err := hasPermission(c, userID, permission)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+					Code:    500,
+					Message: err.Error(),
+				})
+				return
+			}
+			if ok {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "权限不足：" + strings.Join(permissions, " | "),
+		})
+	}
+}
+
+// hasPermission 判断当前用户是否拥有权限
+// 组织上下文中的组织资源（组织、成员、API 密钥、钱包、用量）只看成员角色，
+// 全局角色仅在是平台管理员（system:admin）时生效；其余情况按全局角色判断
+func hasPermission(c *gin.Context, userID uuid.UUID, permission string) (bool, error) {
+	if currentOrgID(c) != nil && models.IsOrgScopedPermission(permission) {
+		if models.OrgRoleHasPermission(c.GetString("org_role"), permission) {
+			return true, nil
+		}
+		return models.UserHasPermission(userID, "system:admin")
+	}
+	return models.UserHasPermission(userID, permission)
+}
+
+// currentUserID 获取当前登录用户的 ID，需在 AuthMiddleware 之后使用
+func currentUserID(c *gin.Context) uuid.UUID {
+	return c.MustGet("user_id").(uuid.UUID)
 }
@@ -0,0 +1,285 @@
+package gins
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"macg/core"
+	"macg/global"
+	"macg/models"
+	"macg/utils"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// 令牌刷新与退出登录 API
+// ============================================================================
+
+// TokenPair 登录或刷新后返回的令牌
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // 访问令牌有效期（秒）
+}
+
+// RefreshTokenRequest 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest 退出登录请求
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"` // 同时吊销当前设备的刷新令牌
+	All          bool   `json:"all"`           // 退出所有设备
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// LoginPayload 加密登录载荷：客户端将其序列化为 JSON，用 /api/auth/public-key 返回的公钥
+// 以 RSA-OAEP（SHA-256）加密后 Base64 编码，作为 encrypted_password 提交
+type LoginPayload struct {
+	Password  string `json:"password"`
+	Timestamp int64  `json:"timestamp"` // Unix 时间戳（秒）
+	Nonce     string `json:"nonce"`     // 每次提交不同的随机字符串
+}
+
+// loginPayloadMaxAge 加密载荷的有效期，同时也是 nonce 的保留时长
+const loginPayloadMaxAge = 5 * time.Minute
+
+// resolvePassword 解密 encrypted_password 并校验时间戳和 nonce；
+// 未提供密文时仅在配置允许明文密码的情况下使用 password
+func resolvePassword(plain, encrypted string) (string, error) {
+	if encrypted == "" {
+		if !core.Cfg.Security.PlainPassword {
+			return "", errors.New("请使用加密方式提交密码")
+		}
+		return plain, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", errors.New("加密密码格式错误")
+	}
+	decrypted, err := global.RsaObj.Decrypt(data)
+	if err != nil {
+		return "", errors.New("密码解密失败，请重新获取公钥")
+	}
+
+	var payload LoginPayload
+	if err := json.Unmarshal(decrypted, &payload); err != nil {
+		return "", errors.New("加密密码格式错误")
+	}
+	if payload.Nonce == "" || len(payload.Nonce) > 100 {
+		return "", errors.New("加密密码缺少有效的 nonce")
+	}
+
+	issuedAt := time.Unix(payload.Timestamp, 0)
+	if age := time.Since(issuedAt); age > loginPayloadMaxAge || age < -loginPayloadMaxAge {
+		return "", errors.New("加密密码已过期，请检查设备时间后重试")
+	}
+	if err := models.ConsumeLoginNonce(payload.Nonce, issuedAt.Add(loginPayloadMaxAge)); err != nil {
+		return "", err
+	}
+
+	return payload.Password, nil
+}
+
+// LoginPublicKeyAPI 返回加密登录载荷使用的 RSA 公钥
+func LoginPublicKeyAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"public_key":     global.RsaObj.PublicKeyPEM,
+			"algorithm":      "RSA-OAEP-256",
+			"timestamp":      time.Now().Unix(), // 供客户端校准时间
+			"max_age":        int64(loginPayloadMaxAge / time.Second),
+			"plain_password": core.Cfg.Security.PlainPassword,
+		},
+	})
+}
+
+// issueTokens 为用户签发访问令牌和新的刷新令牌
+func issueTokens(c *gin.Context, user *models.User) (*TokenPair, error) {
+	refreshToken, err := models.CreateRefreshToken(user.ID, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		return nil, err
+	}
+	return issueAccessToken(user, refreshToken)
+}
+
+// issueAccessToken 签发访问令牌，与给定的刷新令牌一起返回
+func issueAccessToken(user *models.User, refreshToken string) (*TokenPair, error) {
+	accessToken, _, _, err := utils.CreateAccessToken(user.Username, user.TokenVersion)
+	if err != nil {
+		return nil, errors.New("签发访问令牌失败：" + err.Error())
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(utils.JwtTTL / time.Second),
+	}, nil
+}
+
+// RefreshTokenAPI 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func RefreshTokenAPI(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	user, refreshToken, err := models.RotateRefreshToken(req.RefreshToken, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		status := http.StatusUnauthorized
+		if !errors.Is(err, models.ErrRefreshTokenInvalid) && !errors.Is(err, models.ErrRefreshTokenExpired) &&
+			!errors.Is(err, models.ErrRefreshTokenReused) {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+	if user.Status != "active" {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "账号已被禁用",
+		})
+		return
+	}
+
+	tokens, err := issueAccessToken(user, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    tokens,
+	})
+}
+
+// LogoutAPI 退出登录：吊销当前访问令牌，可选吊销刷新令牌或退出所有设备
+func LogoutAPI(c *gin.Context) {
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "invalid request: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	// 模拟登录的退出只结束模拟会话，不影响被模拟用户自己的登录
+	if currentImpersonation(c) != nil {
+		StopImpersonationAPI(c)
+		return
+	}
+
+	userID := currentUserID(c)
+	claims := c.MustGet("token_claims").(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	if err := models.RevokeAccessToken(jti, userID, time.Unix(int64(exp), 0)); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if req.All {
+		if err := models.RevokeAllUserTokens(userID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: err.Error(),
+			})
+			return
+		}
+	} else if req.RefreshToken != "" {
+		if err := models.RevokeRefreshToken(req.RefreshToken); err != nil && !errors.Is(err, models.ErrRefreshTokenInvalid) {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "logged out successfully",
+	})
+}
+
+// ChangePasswordAPI 修改当前用户密码，所有设备需重新登录，当前设备返回新令牌
+func ChangePasswordAPI(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	userID := currentUserID(c)
+	if err := models.ChangePassword(userID, req.OldPassword, req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+	tokens, err := issueTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "password changed successfully",
+		Data:    tokens,
+	})
+}
+
+// JWKSAPI 公开 RS256 验证公钥（JWK Set），供其他服务校验本服务签发的令牌
+func JWKSAPI(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": utils.JWKS()})
+}
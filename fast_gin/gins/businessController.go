@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"macg/models"
+	"macg/provider"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -24,7 +25,22 @@ func GetTicketList(c *gin.Context) {
 
 	zap.L().Debug("获取工单列表", zap.Int("page", page), zap.Int("pageSize", pageSize), zap.String("status", status))
 
-	tickets, total, err := models.GetAllTickets(page, pageSize, status)
+	// 没有工单管理权限的用户只能看到自己提交的工单
+	isStaff, err := models.UserHasPermission(currentUserID(c), "ticket:manage")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+	var userID *uuid.UUID
+	if !isStaff {
+		id := currentUserID(c)
+		userID = &id
+	}
+
+	tickets, total, err := models.GetAllTickets(currentOrgID(c), userID, page, pageSize, status)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -68,12 +84,8 @@ func GetTicketDetail(c *gin.Context) {
 		return
 	}
 
-	ticket, err := models.GetTicketByID(id)
-	if err != nil {
-		c.JSON(http.StatusNotFound, models.Response{
-			Code:    404,
-			Message: err.Error(),
-		})
+	ticket, ok := loadAccessibleTicket(c, id)
+	if !ok {
 		return
 	}
 
@@ -84,6 +96,40 @@ func GetTicketDetail(c *gin.Context) {
 	})
 }
 
+// loadAccessibleTicket 读取当前用户可访问的工单：提交者本人或拥有工单管理权限的用户，
+// 其他人按工单不存在处理，不可访问时已写入响应
+func loadAccessibleTicket(c *gin.Context, id uuid.UUID) (*models.SupportTicket, bool) {
+	ticket, err := models.GetTicketByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+
+	userID := currentUserID(c)
+	if ticket.UserID == userID {
+		return ticket, true
+	}
+	isStaff, err := models.UserHasPermission(userID, "ticket:manage")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return nil, false
+	}
+	if !isStaff {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: "工单不存在",
+		})
+		return nil, false
+	}
+	return ticket, true
+}
+
 // CreateTicketRequest 创建工单请求
 type CreateTicketRequest struct {
 	Subject     string `json:"subject" binding:"required"`
@@ -103,24 +149,9 @@ func CreateNewTicket(c *gin.Context) {
 		return
 	}
 
-	// 从JWT获取用户ID（这里简化处理，实际需要从token中解析）
-	userIDStr := c.GetHeader("X-User-ID")
-	var userID uuid.UUID
-	if userIDStr != "" {
-		var err error
-		userID, err = uuid.Parse(userIDStr)
-		if err != nil {
-			userID = uuid.New() // 临时处理
-		}
-	} else {
-		// 获取第一个用户（仅用于演示）
-		users, _, _ := models.GetAllUsers(1, 1)
-		if len(users) > 0 {
-			userID = users[0].ID
-		}
-	}
+	userID := currentUserID(c)
 
-	ticket, err := models.CreateTicket(userID, req.Subject, req.Description, req.Priority, req.Category)
+	ticket, err := models.CreateTicket(userID, currentOrgID(c), req.Subject, req.Description, req.Priority, req.Category)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -188,7 +219,6 @@ func UpdateTicketStatusAPI(c *gin.Context) {
 // AddTicketReplyRequest 添加回复请求
 type AddTicketReplyRequest struct {
 	Content string `json:"content" binding:"required"`
-	IsStaff bool   `json:"is_staff"`
 }
 
 // AddReplyToTicket 添加工单回复
@@ -212,14 +242,22 @@ func AddReplyToTicket(c *gin.Context) {
 		return
 	}
 
-	// 获取用户ID
-	users, _, _ := models.GetAllUsers(1, 1)
-	var userID uuid.UUID
-	if len(users) > 0 {
-		userID = users[0].ID
+	if _, ok := loadAccessibleTicket(c, ticketID); !ok {
+		return
 	}
 
-	reply, err := models.AddTicketReply(ticketID, userID, req.Content, req.IsStaff)
+	// 拥有工单管理权限的用户以客服身份回复
+	userID := currentUserID(c)
+	isStaff, err := models.UserHasPermission(userID, "ticket:manage")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	reply, err := models.AddTicketReply(ticketID, userID, req.Content, isStaff)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -339,12 +377,7 @@ func CreateNewAnnouncement(c *gin.Context) {
 		return
 	}
 
-	// 获取管理员用户ID
-	users, _, _ := models.GetAllUsers(1, 1)
-	var authorID uuid.UUID
-	if len(users) > 0 {
-		authorID = users[0].ID
-	}
+	authorID := currentUserID(c)
 
 	announcement, err := models.CreateAnnouncement(authorID, req.Title, req.Content, req.Excerpt, req.Tag, req.Color, req.Status)
 	if err != nil {
@@ -447,17 +480,21 @@ func GetServiceList(c *gin.Context) {
 	serviceDTOs := make([]models.ServiceDTO, len(services))
 	for i, s := range services {
 		serviceDTOs[i] = models.ServiceDTO{
-			ID:          i + 1, // 使用索引作为简单ID
-			Name:        s.Name,
-			Description: s.Description,
-			Status:      s.Status,
-			Uptime:      s.Uptime,
-			Icon:        s.Icon,
-			Bg:          s.Bg,
-			ModelID:     s.ModelID,
-			MaxTokens:   s.MaxTokens,
-			RateLimit:   s.RateLimit,
-			Price:       s.Price,
+			ID:            i + 1, // 使用索引作为简单ID
+			Name:          s.Name,
+			Description:   s.Description,
+			Status:        s.Status,
+			Uptime:        s.Uptime,
+			AutoStatus:    s.AutoStatus,
+			Icon:          s.Icon,
+			Bg:            s.Bg,
+			ModelID:       s.ModelID,
+			Provider:      s.Provider,
+			MaxTokens:     s.MaxTokens,
+			ContextWindow: s.ContextWindow,
+			RateLimit:     s.RateLimit,
+			TokenLimit:    s.TokenLimit,
+			Price:         s.Price,
 		}
 	}
 
@@ -499,17 +536,52 @@ func GetServiceDetail(c *gin.Context) {
 	})
 }
 
+// GetServiceProbesAPI 获取服务最近的健康探测记录
+func GetServiceProbesAPI(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid service id",
+		})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	probes, err := models.GetRecentServiceProbes(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    probes,
+	})
+}
+
 // CreateServiceRequest 创建服务请求
 type CreateServiceRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Description string  `json:"description"`
-	Status      string  `json:"status"`
-	Icon        string  `json:"icon"`
-	Bg          string  `json:"bg"`
-	ModelID     string  `json:"model_id"`
-	MaxTokens   int     `json:"max_tokens"`
-	RateLimit   int     `json:"rate_limit"`
-	Price       float64 `json:"price"`
+	Name          string  `json:"name" binding:"required"`
+	Description   string  `json:"description"`
+	Status        string  `json:"status"`
+	Icon          string  `json:"icon"`
+	Bg            string  `json:"bg"`
+	ModelID       string  `json:"model_id"`
+	Provider      string  `json:"provider"`
+	MaxTokens     int     `json:"max_tokens"`
+	ContextWindow int     `json:"context_window"`
+	RateLimit     int     `json:"rate_limit"`
+	Price         float64 `json:"price"`
 }
 
 // CreateNewService 创建服务
@@ -523,7 +595,15 @@ func CreateNewService(c *gin.Context) {
 		return
 	}
 
-	service, err := models.CreateService(req.Name, req.Description, req.Status, req.Icon, req.Bg, req.ModelID, req.MaxTokens, req.RateLimit, req.Price)
+	if _, err := provider.Get(req.Provider); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	service, err := models.CreateService(req.Name, req.Description, req.Status, req.Icon, req.Bg, req.ModelID, req.Provider, req.MaxTokens, req.ContextWindow, req.RateLimit, req.Price)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -559,6 +639,16 @@ func UpdateServiceAPI(c *gin.Context) {
 		})
 		return
 	}
+	if v, ok := updates["provider"]; ok {
+		name, _ := v.(string)
+		if _, err := provider.Get(name); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
 
 	service, err := models.UpdateService(id, updates)
 	if err != nil {
@@ -606,9 +696,28 @@ func DeleteServiceAPI(c *gin.Context) {
 // Token 使用 API
 // ============================================================================
 
-// GetTokenUsageStats 获取Token使用统计
+// GetTokenUsageStats 获取Token使用统计，组织上下文中只统计该组织，
+// 否则只统计当前用户，平台管理员（system:admin）查看全平台
 func GetTokenUsageStats(c *gin.Context) {
-	summary, err := models.GetTokenUsageSummary(nil, nil, nil)
+	userID := currentUserID(c)
+	platformAdmin, err := models.UserHasPermission(userID, "system:admin")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	var summary []models.TokenUsageSummary
+	switch orgID := currentOrgID(c); {
+	case orgID != nil:
+		summary, err = models.GetOrganizationTokenUsageSummary(*orgID, nil, nil)
+	case platformAdmin:
+		summary, err = models.GetTokenUsageSummary(nil, nil, nil)
+	default:
+		summary, err = models.GetTokenUsageSummary(&userID, nil, nil)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.Response{
 			Code:    500,
@@ -0,0 +1,153 @@
+package gins
+
+import (
+	"net/http"
+
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 上游渠道管理 API
+// ============================================================================
+
+// CreateChannelRequest 创建渠道请求
+type CreateChannelRequest struct {
+	Name     string `json:"name" binding:"required"`
+	BaseURL  string `json:"base_url"`
+	APIKey   string `json:"api_key" binding:"required"`
+	Weight   int    `json:"weight"`
+	Priority int    `json:"priority"`
+	Enabled  *bool  `json:"enabled"`
+}
+
+// GetServiceChannelsAPI 获取服务下的渠道列表
+func GetServiceChannelsAPI(c *gin.Context) {
+	serviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid service id",
+		})
+		return
+	}
+
+	channels, err := models.GetServiceChannels(serviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    channels,
+	})
+}
+
+// CreateChannelAPI 为服务添加渠道
+func CreateChannelAPI(c *gin.Context) {
+	serviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid service id",
+		})
+		return
+	}
+
+	var req CreateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	channel, err := models.CreateChannel(serviceID, req.Name, req.BaseURL, req.APIKey, req.Weight, req.Priority, enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "channel created successfully",
+		Data:    channel,
+	})
+}
+
+// UpdateChannelAPI 更新渠道
+func UpdateChannelAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid channel id",
+		})
+		return
+	}
+
+	var updates map[string]interface{}
+	if err := c.ShouldBindJSON(&updates); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	channel, err := models.UpdateChannel(id, updates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "channel updated successfully",
+		Data:    channel,
+	})
+}
+
+// DeleteChannelAPI 删除渠道
+func DeleteChannelAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid channel id",
+		})
+		return
+	}
+
+	if err := models.DeleteChannel(id); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "channel deleted successfully",
+	})
+}
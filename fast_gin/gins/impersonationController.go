@@ -0,0 +1,372 @@
+package gins
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"macg/core"
+	"macg/models"
+	"macg/utils"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 模拟登录 API
+// 超级管理员签发以目标用户身份访问的短期令牌，模拟期间：
+// 响应头 X-Impersonated-By 标明实际操作人，敏感操作被禁止，
+// 开始、结束以及每个写操作都记录审计日志
+// ============================================================================
+
+// ImpersonationHeader 模拟期间每个响应都带有该头，值为实际操作的管理员用户名
+const ImpersonationHeader = "X-Impersonated-By"
+
+// defaultImpersonateTTL 未配置 impersonate_ttl 时的模拟令牌有效期
+const defaultImpersonateTTL = 30 * time.Minute
+
+// StartImpersonationRequest 发起模拟登录请求
+type StartImpersonationRequest struct {
+	Reason   string     `json:"reason" binding:"required,max=500"`
+	TicketID *uuid.UUID `json:"ticket_id"` // 处理工单时关联工单，便于审计追溯
+}
+
+// impersonateTTL 模拟令牌有效期
+func impersonateTTL() time.Duration {
+	if ttl := core.Cfg.Security.ImpersonateTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultImpersonateTTL
+}
+
+// resolveImpersonation 令牌带有 act 声明时校验模拟会话，并记录实际操作的管理员；
+// 会话已结束、已过期或管理员已失去超级管理员角色时令牌失效
+func resolveImpersonation(c *gin.Context, claims jwt.MapClaims, jti string) bool {
+	raw, present := claims["act"]
+	if !present {
+		return true
+	}
+
+	invalid := func(message string) bool {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, models.Response{
+			Code:    401,
+			Message: message,
+		})
+		return false
+	}
+
+	act, _ := raw.(map[string]interface{})
+	actor, _ := act["sub"].(string)
+	if actor == "" {
+		return invalid("令牌无效")
+	}
+
+	session, err := models.GetImpersonationSessionByJTI(jti)
+	if err != nil {
+		if errors.Is(err, models.ErrImpersonationNotFound) {
+			return invalid("模拟会话无效")
+		}
+		c.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return false
+	}
+	if !session.Active() {
+		return invalid(models.ErrImpersonationEnded.Error())
+	}
+
+	admin, err := models.GetUserWithRolesByID(session.AdminID)
+	if err != nil || admin.Username != actor || admin.Status != "active" || !userHasRole(admin, models.ImpersonatorRole) {
+		return invalid("模拟会话无效")
+	}
+
+	c.Set("impersonator", admin)
+	c.Set("impersonation", session)
+	c.Header(ImpersonationHeader, admin.Username)
+	return true
+}
+
+// userHasRole 判断已加载角色的用户是否拥有指定角色
+func userHasRole(user *models.User, roleName string) bool {
+	for _, role := range user.Roles {
+		if role.Name == roleName {
+			return true
+		}
+	}
+	return false
+}
+
+// currentImpersonation 当前请求的模拟会话，不在模拟中时返回 nil
+func currentImpersonation(c *gin.Context) *models.ImpersonationSession {
+	value, ok := c.Get("impersonation")
+	if !ok {
+		return nil
+	}
+	return value.(*models.ImpersonationSession)
+}
+
+// currentImpersonator 模拟期间实际操作的管理员，不在模拟中时返回 nil
+func currentImpersonator(c *gin.Context) *models.User {
+	value, ok := c.Get("impersonator")
+	if !ok {
+		return nil
+	}
+	return value.(*models.User)
+}
+
+// DenyImpersonation 模拟登录期间禁止访问的接口（修改密码、双因素认证、创建或修改密钥、充值、创建组织、接受邀请等）
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if currentImpersonation(c) != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+				Code:    403,
+				Message: "模拟登录期间不允许此操作",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// auditImpersonatedRequest 模拟期间的写操作记录审计日志，操作人为实际的管理员
+func auditImpersonatedRequest(c *gin.Context) {
+	session := currentImpersonation(c)
+	if session == nil {
+		return
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return
+	}
+
+	models.RecordAuditLog(&session.AdminID, models.AuditImpersonationRequest, "user", session.TargetUserID.String(), gin.H{
+		"session_id": session.ID,
+		"method":     c.Request.Method,
+		"route":      c.FullPath(),
+		"path":       c.Request.URL.Path,
+		"status":     c.Writer.Status(),
+	}, c.ClientIP())
+}
+
+// StartImpersonationAPI 超级管理员以目标用户身份登录，返回不可刷新的短期访问令牌
+func StartImpersonationAPI(c *gin.Context) {
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	var req StartImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	admin := c.MustGet("user").(*models.User)
+	if !userHasRole(admin, models.ImpersonatorRole) {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "只有超级管理员可以模拟用户登录",
+		})
+		return
+	}
+
+	target, err := models.GetUserWithRolesByID(targetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := models.CheckImpersonationTarget(admin.ID, target); err != nil {
+		c.JSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: err.Error(),
+		})
+		return
+	}
+	if req.TicketID != nil {
+		if _, err := models.GetTicketByID(*req.TicketID); err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	token, jti, expiresAt, err := utils.CreateImpersonationToken(target.Username, target.TokenVersion, admin.Username, impersonateTTL())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: "签发模拟令牌失败：" + err.Error(),
+		})
+		return
+	}
+
+	session := models.ImpersonationSession{
+		AdminID:      admin.ID,
+		TargetUserID: target.ID,
+		Reason:       req.Reason,
+		TicketID:     req.TicketID,
+		TokenJTI:     jti,
+		IP:           c.ClientIP(),
+		ExpiresAt:    expiresAt,
+	}
+	if err := models.CreateImpersonationSession(&session); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditImpersonationStart, "user", target.ID.String(), gin.H{
+		"session_id": session.ID,
+		"username":   target.Username,
+		"reason":     req.Reason,
+		"ticket_id":  req.TicketID,
+		"expires_at": expiresAt,
+	})
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "impersonation started",
+		Data: gin.H{
+			"token":      token,
+			"expires_in": int64(time.Until(expiresAt) / time.Second),
+			"session":    session,
+			"user": gin.H{
+				"id":       target.ID,
+				"username": target.Username,
+				"email":    target.Email,
+				"name":     target.Name,
+			},
+		},
+	})
+}
+
+// StopImpersonationAPI 结束当前模拟会话，模拟令牌随即失效
+func StopImpersonationAPI(c *gin.Context) {
+	session := currentImpersonation(c)
+	if session == nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "当前未处于模拟登录",
+		})
+		return
+	}
+
+	if _, err := models.EndImpersonationSession(session.ID); err != nil && !errors.Is(err, models.ErrImpersonationEnded) {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditImpersonationStop, "user", session.TargetUserID.String(), gin.H{
+		"session_id": session.ID,
+	})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "impersonation stopped",
+	})
+}
+
+// AdminGetImpersonationsAPI 分页查看模拟会话，可按 admin_id、user_id 过滤
+func AdminGetImpersonationsAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var filters [2]*uuid.UUID
+	for i, name := range []string{"admin_id", "user_id"} {
+		raw := c.Query(name)
+		if raw == "" {
+			continue
+		}
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "invalid " + name,
+			})
+			return
+		}
+		filters[i] = &id
+	}
+
+	sessions, total, err := models.GetImpersonationSessions(filters[0], filters[1], page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"sessions": sessions,
+			"total":    total,
+		},
+	})
+}
+
+// AdminEndImpersonationAPI 强制结束任意模拟会话
+func AdminEndImpersonationAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid session id",
+		})
+		return
+	}
+
+	session, err := models.EndImpersonationSession(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, models.ErrImpersonationNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, models.ErrImpersonationEnded):
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditImpersonationStop, "user", session.TargetUserID.String(), gin.H{
+		"session_id": session.ID,
+		"forced":     true,
+	})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "impersonation ended",
+	})
+}
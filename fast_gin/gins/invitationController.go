@@ -0,0 +1,331 @@
+package gins
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"macg/mailer"
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 邀请与注册模式 API
+// /api/invitations 为平台邀请（只邀请注册），/api/orgs/:orgId/invitations 为组织邀请
+// ============================================================================
+
+// CreateInvitationRequest 创建邀请请求，role 只用于组织邀请，默认 member
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role"`
+}
+
+// InvitationTokenRequest 携带邀请令牌的请求
+type InvitationTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RegistrationSettingsRequest 修改注册模式请求
+type RegistrationSettingsRequest struct {
+	Mode string `json:"mode" binding:"required,oneof=open invite_only"`
+}
+
+// invitationErrorStatus 按邀请相关错误选择状态码
+func invitationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrInvitationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrInvitationInvalid), errors.Is(err, models.ErrInvitationExpired),
+		errors.Is(err, models.ErrInvitationEmailMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrInvitationNotPending), errors.Is(err, models.ErrInvitationRegistered):
+		return http.StatusConflict
+	default:
+		return orgErrorStatus(err)
+	}
+}
+
+// invitationOrgID 邀请所属组织，只认路径中的组织；
+// 平台邀请接口按 user:write 鉴权，不能借 X-Org-ID 绕过组织的 member:write
+func invitationOrgID(c *gin.Context) *uuid.UUID {
+	if c.Param("orgId") == "" {
+		return nil
+	}
+	return currentOrgID(c)
+}
+
+// respondInvitationError 按错误类型返回
+func respondInvitationError(c *gin.Context, err error) {
+	status := invitationErrorStatus(err)
+	c.JSON(status, models.Response{
+		Code:    status,
+		Message: err.Error(),
+	})
+}
+
+// sendInvitationEmail 发送邀请邮件
+func sendInvitationEmail(invitation *models.Invitation, token string) {
+	inviter := "管理员"
+	if user, err := models.GetUserByID(invitation.InviterID); err == nil {
+		inviter = user.Username
+		if user.Name != "" {
+			inviter = user.Name
+		}
+	}
+
+	subject := "邀请您注册账号"
+	target := "注册账号"
+	if invitation.OrganizationID != nil {
+		if org, err := models.GetOrganizationByID(*invitation.OrganizationID); err == nil {
+			subject = "邀请您加入 " + org.Name
+			target = "加入组织「" + org.Name + "」"
+		}
+	}
+
+	sendMailAsync(mailer.Message{
+		To:      invitation.Email,
+		Subject: subject,
+		Text: fmt.Sprintf("您好：\n\n%s 邀请您%s。请在 %d 天内打开以下链接接受邀请：\n%s\n\n如果您不认识邀请人，请忽略本邮件。\n",
+			inviter, target, int(models.InvitationTTL/(24*time.Hour)), emailLink("/invite", token)),
+	})
+}
+
+// GetInvitationsAPI 分页获取邀请，组织上下文中只返回该组织的邀请
+func GetInvitationsAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	invitations, total, err := models.GetInvitations(invitationOrgID(c), c.Query("status"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"invitations": invitations,
+			"total":       total,
+		},
+	})
+}
+
+// CreateInvitationAPI 创建邀请并发送邮件，组织上下文中邀请加入该组织
+func CreateInvitationAPI(c *gin.Context) {
+	var req CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	invitation, token, err := models.CreateInvitation(currentUserID(c), req.Email, invitationOrgID(c), req.Role, c.GetString("org_role"))
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	sendInvitationEmail(invitation, token)
+	audit(c, models.AuditInvitationCreate, "invitation", invitation.ID.String(), gin.H{
+		"email":           invitation.Email,
+		"organization_id": invitation.OrganizationID,
+		"role":            invitation.OrgRole,
+	})
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "invitation sent successfully",
+		Data:    invitation,
+	})
+}
+
+// ResendInvitationAPI 重新发送邀请，旧链接失效
+func ResendInvitationAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid invitation id",
+		})
+		return
+	}
+
+	invitation, token, err := models.ResendInvitation(id, invitationOrgID(c))
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	sendInvitationEmail(invitation, token)
+	audit(c, models.AuditInvitationResend, "invitation", id.String(), nil)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "invitation resent successfully",
+		Data:    invitation,
+	})
+}
+
+// RevokeInvitationAPI 撤销邀请
+func RevokeInvitationAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid invitation id",
+		})
+		return
+	}
+
+	if err := models.RevokeInvitation(id, invitationOrgID(c)); err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	audit(c, models.AuditInvitationRevoke, "invitation", id.String(), nil)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "invitation revoked successfully",
+	})
+}
+
+// PreviewInvitationAPI 查看邀请内容，前端据此决定登录后接受还是注册新账号
+func PreviewInvitationAPI(c *gin.Context) {
+	var req InvitationTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	invitation, err := models.GetInvitationByToken(req.Token)
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+	registered, err := models.InvitationEmailRegistered(invitation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	data := gin.H{
+		"email":          invitation.Email,
+		"role":           invitation.OrgRole,
+		"expires_at":     invitation.ExpiresAt,
+		"account_exists": registered,
+	}
+	if invitation.Inviter != nil {
+		data["inviter"] = invitation.Inviter.Username
+	}
+	if invitation.Organization != nil {
+		data["organization"] = gin.H{
+			"id":   invitation.Organization.ID,
+			"name": invitation.Organization.Name,
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    data,
+	})
+}
+
+// AcceptInvitationAPI 当前登录用户接受邀请，用户邮箱需与受邀邮箱一致
+func AcceptInvitationAPI(c *gin.Context) {
+	var req InvitationTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	user := c.MustGet("user").(*models.User)
+	invitation, err := models.AcceptInvitation(req.Token, user)
+	if err != nil {
+		respondInvitationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "invitation accepted",
+		Data: gin.H{
+			"organization_id": invitation.OrganizationID,
+			"role":            invitation.OrgRole,
+		},
+	})
+}
+
+// GetRegistrationSettingsAPI 获取当前注册模式，登录页据此决定是否显示注册入口
+func GetRegistrationSettingsAPI(c *gin.Context) {
+	mode, err := models.GetRegistrationMode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    gin.H{"mode": mode},
+	})
+}
+
+// UpdateRegistrationSettingsAPI 切换开放注册或仅凭邀请注册
+func UpdateRegistrationSettingsAPI(c *gin.Context) {
+	var req RegistrationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	operatorID := currentUserID(c)
+	if err := models.SetRegistrationMode(req.Mode, &operatorID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditSettingUpdate, "setting", models.SettingRegistrationMode, req)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "registration settings updated",
+		Data:    gin.H{"mode": req.Mode},
+	})
+}
@@ -0,0 +1,93 @@
+package gins
+
+import (
+	"net/http"
+	"strconv"
+
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 登录历史与账号锁定 API
+// ============================================================================
+
+// respondLoginHistory 分页返回指定用户的登录历史
+func respondLoginHistory(c *gin.Context, userID uuid.UUID) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	histories, total, err := models.GetLoginHistory(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"history": histories,
+			"total":   total,
+		},
+	})
+}
+
+// GetMyLoginHistoryAPI 获取当前用户的登录历史
+func GetMyLoginHistoryAPI(c *gin.Context) {
+	respondLoginHistory(c, currentUserID(c))
+}
+
+// GetUserLoginHistoryAPI 管理员查看指定用户的登录历史
+func GetUserLoginHistoryAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	respondLoginHistory(c, id)
+}
+
+// UnlockUserAPI 管理员解除因登录失败次数过多导致的账号锁定
+func UnlockUserAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	user, err := models.UnlockUser(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditUserUnlock, "user", id.String(), nil)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "user unlocked successfully",
+		Data:    user,
+	})
+}
@@ -0,0 +1,257 @@
+package gins
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"macg/core"
+	"macg/models"
+	"macg/oidc"
+	"macg/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// OpenID Connect 单点登录 API
+// 浏览器跳转流程：/login 跳到身份提供方，/callback 换取令牌后带结果跳回前端，
+// 令牌放在 URL 片段中，不会发送到服务器或记录在访问日志里
+// ============================================================================
+
+// oidcStateCookie 绑定授权请求与发起登录的浏览器，防止登录 CSRF
+const oidcStateCookie = "oidc_state"
+
+// oidcStateTTL 授权请求的有效期
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCConfigAPI 返回登录页需要的单点登录配置
+func OIDCConfigAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"enabled":      oidc.Enabled(),
+			"display_name": core.Cfg.OIDC.DisplayName,
+		},
+	})
+}
+
+// safeRedirect 只允许站内相对路径，避免开放重定向
+func safeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		return ""
+	}
+	return redirect
+}
+
+// OIDCLoginAPI 生成 state、nonce 和 PKCE 校验码后跳转到身份提供方
+func OIDCLoginAPI(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "single sign-on is not enabled"})
+		return
+	}
+
+	provider, err := oidc.Default(c.Request.Context())
+	if err != nil {
+		zap.L().Error("读取 OIDC 发现文档失败", zap.Error(err))
+		c.JSON(http.StatusBadGateway, models.Response{Code: 502, Message: "identity provider unavailable"})
+		return
+	}
+
+	var values [3]string
+	for i := range values {
+		if values[i], err = oidc.RandomString(32); err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: err.Error()})
+			return
+		}
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	if err := models.CreateOIDCLoginState(&models.OIDCLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Redirect:     safeRedirect(c.Query("redirect")),
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{Code: 500, Message: err.Error()})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcStateTTL/time.Second), "/api/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier)))
+}
+
+// OIDCCallbackAPI 身份提供方回调：校验 state，换取并校验 ID Token，关联或开通本地账号后签发令牌
+func OIDCCallbackAPI(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.JSON(http.StatusNotFound, models.Response{Code: 404, Message: "single sign-on is not enabled"})
+		return
+	}
+
+	// state cookie 只使用一次
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", c.Request.TLS != nil, true)
+
+	if idpErr := c.Query("error"); idpErr != "" {
+		zap.L().Warn("身份提供方返回错误", zap.String("error", idpErr), zap.String("description", c.Query("error_description")))
+		oidcRedirect(c, url.Values{"error": {"身份提供方拒绝了登录请求"}})
+		return
+	}
+
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	if state == "" || cookieState != state {
+		oidcRedirect(c, url.Values{"error": {models.ErrOIDCStateInvalid.Error()}})
+		return
+	}
+	loginState, err := models.ConsumeOIDCLoginState(state)
+	if err != nil {
+		oidcRedirect(c, url.Values{"error": {models.ErrOIDCStateInvalid.Error()}})
+		return
+	}
+
+	ctx := c.Request.Context()
+	provider, err := oidc.Default(ctx)
+	if err != nil {
+		zap.L().Error("读取 OIDC 发现文档失败", zap.Error(err))
+		oidcRedirect(c, url.Values{"error": {"身份提供方暂时不可用"}})
+		return
+	}
+	token, err := provider.Exchange(ctx, c.Query("code"), loginState.CodeVerifier)
+	if err != nil {
+		zap.L().Warn("OIDC 授权码换取令牌失败", zap.Error(err))
+		oidcRedirect(c, url.Values{"error": {"单点登录失败，请重试"}})
+		return
+	}
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, loginState.Nonce)
+	if err != nil {
+		zap.L().Warn("OIDC ID Token 校验失败", zap.Error(err))
+		oidcRedirect(c, url.Values{"error": {"单点登录失败，请重试"}})
+		return
+	}
+
+	cfg := core.Cfg.OIDC
+	user, err := models.FindOrProvisionExternalUser(models.ExternalIdentity{
+		Issuer:        provider.Metadata().Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+		Username:      claims.PreferredUsername,
+	}, models.ProvisionOptions{
+		AutoProvision: cfg.AutoProvision,
+		LinkByEmail:   cfg.LinkByEmail,
+		DefaultRole:   cfg.DefaultRole,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrExternalUserAbsent) {
+			models.RecordLoginHistory(claims.PreferredUsername, c.ClientIP(), c.GetHeader("User-Agent"), false, models.LoginFailSSONotProvisioned)
+		} else {
+			zap.L().Error("关联外部身份失败", zap.Error(err))
+		}
+		oidcRedirect(c, url.Values{"error": {err.Error()}})
+		return
+	}
+
+	if len(cfg.RoleMapping) > 0 {
+		if err := syncOIDCRoles(user, claims); err != nil {
+			zap.L().Error("同步单点登录角色失败", zap.String("username", user.Username), zap.Error(err))
+		} else if user, err = models.GetUserWithRolesByID(user.ID); err != nil {
+			oidcRedirect(c, url.Values{"error": {err.Error()}})
+			return
+		}
+	}
+
+	if user.Status != "active" {
+		models.RecordLoginHistory(user.Username, c.ClientIP(), c.GetHeader("User-Agent"), false, models.LoginFailAccountDisabled)
+		oidcRedirect(c, url.Values{"error": {models.ErrAccountDisabled.Error()}})
+		return
+	}
+	if user.IsLocked() {
+		models.RecordLoginHistory(user.Username, c.ClientIP(), c.GetHeader("User-Agent"), false, models.LoginFailAccountLocked)
+		oidcRedirect(c, url.Values{"error": {models.ErrAccountLocked.Error()}})
+		return
+	}
+
+	// 本地启用了双因素认证时仍需校验验证码，前端拿挑战令牌调用 /api/login/2fa
+	enabled, err := models.IsTwoFactorEnabled(user.ID)
+	if err != nil {
+		oidcRedirect(c, url.Values{"error": {err.Error()}})
+		return
+	}
+	if enabled {
+		challenge, err := utils.CreateTwoFactorChallenge(user.Username, user.TokenVersion)
+		if err != nil {
+			oidcRedirect(c, url.Values{"error": {"签发挑战令牌失败"}})
+			return
+		}
+		oidcRedirect(c, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {challenge},
+			"expires_in":          {strconv.FormatInt(int64(utils.TwoFactorChallengeTTL/time.Second), 10)},
+			"redirect":            {loginState.Redirect},
+		})
+		return
+	}
+
+	models.ResetLoginFailures(user.Username)
+	models.RecordLoginHistory(user.Username, c.ClientIP(), c.GetHeader("User-Agent"), true, "")
+	models.TouchLastLogin(user.ID)
+
+	tokens, err := issueTokens(c, user)
+	if err != nil {
+		oidcRedirect(c, url.Values{"error": {err.Error()}})
+		return
+	}
+	oidcRedirect(c, url.Values{
+		"token":         {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"expires_in":    {strconv.FormatInt(tokens.ExpiresIn, 10)},
+		"redirect":      {loginState.Redirect},
+	})
+}
+
+// syncOIDCRoles 按 role_mapping 把身份提供方的组映射为本地角色
+func syncOIDCRoles(user *models.User, claims *oidc.Claims) error {
+	cfg := core.Cfg.OIDC
+	groupsClaim := cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	managed := make([]string, 0, len(cfg.RoleMapping))
+	seen := make(map[string]bool, len(cfg.RoleMapping))
+	for _, role := range cfg.RoleMapping {
+		if !seen[role] {
+			seen[role] = true
+			managed = append(managed, role)
+		}
+	}
+
+	var mapped []string
+	for _, group := range claims.Strings(groupsClaim) {
+		if role, ok := cfg.RoleMapping[group]; ok {
+			mapped = append(mapped, role)
+		}
+	}
+
+	return models.SyncMappedRoles(user.ID, mapped, managed)
+}
+
+// oidcRedirect 带着登录结果跳回前端页面
+func oidcRedirect(c *gin.Context, values url.Values) {
+	target := core.Cfg.OIDC.FrontendURL
+	if target == "" {
+		target = "/"
+	}
+	if values.Get("redirect") == "" {
+		values.Del("redirect")
+	}
+	c.Redirect(http.StatusFound, target+"#"+values.Encode())
+}
@@ -0,0 +1,249 @@
+package gins
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"macg/core"
+	"macg/database"
+	"macg/database/dbtest"
+	"macg/global"
+	"macg/models"
+	"macg/oidc"
+	"macg/oidc/oidctest"
+	"macg/utils"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+const testCallbackURL = "https://hub.example.com/api/auth/oidc/callback"
+
+// setupOIDCTest 使用内存 SQLite 数据库和身份提供方替身，返回只注册单点登录路由的 Router
+func setupOIDCTest(t *testing.T, cfg core.OIDCConfig) (*oidctest.IdP, *gin.Engine) {
+	t.Helper()
+
+	db := dbtest.Open(t,
+		&models.Role{}, &models.Permission{}, &models.User{}, &models.UserIdentity{}, &models.OIDCLoginState{},
+		&models.LoginHistory{}, &models.LoginFailureCounter{}, &models.UserTwoFactor{}, &models.RefreshToken{},
+	)
+	for _, name := range []string{"user", "admin"} {
+		if err := db.Create(&models.Role{Name: name}).Error; err != nil {
+			t.Fatalf("create role: %v", err)
+		}
+	}
+
+	global.AppConfig = &global.AppConfigType{SecretKey: []byte("0123456789abcdef0123456789abcdef")}
+	utils.SetJWTSecret([]byte("test-jwt-secret"), 15*time.Minute)
+
+	idp := oidctest.New(t, "hub-client")
+	cfg.Enabled = true
+	cfg.Issuer = idp.Issuer()
+	cfg.ClientID = idp.ClientID
+	cfg.RedirectURL = testCallbackURL
+	cfg.FrontendURL = "https://hub.example.com/sso"
+	core.Cfg.OIDC = cfg
+
+	provider, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:      cfg.Issuer,
+		ClientID:    cfg.ClientID,
+		RedirectURL: cfg.RedirectURL,
+	}, idp.Client())
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	oidc.SetDefault(provider)
+	t.Cleanup(func() { oidc.SetDefault(nil) })
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/auth/oidc/login", OIDCLoginAPI)
+	r.GET("/api/auth/oidc/callback", OIDCCallbackAPI)
+	return idp, r
+}
+
+// ssoLogin 走完一次浏览器跳转流程，返回跳回前端时 URL 片段中的结果
+func ssoLogin(t *testing.T, idp *oidctest.IdP, r *gin.Engine) url.Values {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login?redirect=/dashboard", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+
+	callback := idp.Authorize(w.Header().Get("Location"))
+	req := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return frontendResult(t, w)
+}
+
+func frontendResult(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), core.Cfg.OIDC.FrontendURL+"#") {
+		t.Fatalf("callback redirected to %s", location)
+	}
+	values, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func roleNames(t *testing.T, user *models.User) []string {
+	t.Helper()
+	loaded, err := models.GetUserWithRolesByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(loaded.Roles))
+	for _, role := range loaded.Roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOIDCCallbackLinksByEmailAndSyncsRoles(t *testing.T) {
+	idp, r := setupOIDCTest(t, core.OIDCConfig{
+		LinkByEmail: true,
+		GroupsClaim: "groups",
+		RoleMapping: map[string]string{"hub-admins": "admin"},
+	})
+	alice, err := models.CreateUser("alice", "alice@example.com", "secret1", "Alice", "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp.Login = jwt.MapClaims{
+		"sub":            "idp-alice",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"groups":         []string{"hub-admins", "staff"},
+	}
+	result := ssoLogin(t, idp, r)
+	if result.Get("error") != "" || result.Get("token") == "" || result.Get("refresh_token") == "" {
+		t.Fatalf("first login result = %v", result)
+	}
+	if result.Get("redirect") != "/dashboard" {
+		t.Errorf("redirect = %q", result.Get("redirect"))
+	}
+	if sub, err := utils.GetSub(result.Get("token")); err != nil || sub != "alice" {
+		t.Errorf("token subject = %q, %v", sub, err)
+	}
+
+	var link models.UserIdentity
+	if err := database.DB.Where("issuer = ? AND subject = ?", idp.Issuer(), "idp-alice").First(&link).Error; err != nil {
+		t.Fatalf("identity not linked: %v", err)
+	}
+	if link.UserID != alice.ID {
+		t.Fatalf("identity linked to %s, want %s", link.UserID, alice.ID)
+	}
+	if roles := roleNames(t, alice); !hasName(roles, "admin") || !hasName(roles, "user") {
+		t.Fatalf("roles after first login = %v", roles)
+	}
+
+	// 再次登录按 issuer + sub 找到同一账号；组变化后映射的角色被移除，手工分配的角色保留
+	idp.Login = jwt.MapClaims{
+		"sub":            "idp-alice",
+		"email":          "alice@new.example.com",
+		"email_verified": true,
+		"groups":         []string{"staff"},
+	}
+	result = ssoLogin(t, idp, r)
+	if result.Get("error") != "" || result.Get("token") == "" {
+		t.Fatalf("second login result = %v", result)
+	}
+	if roles := roleNames(t, alice); hasName(roles, "admin") || !hasName(roles, "user") {
+		t.Fatalf("roles after second login = %v", roles)
+	}
+
+	var users, links int64
+	database.DB.Model(&models.User{}).Count(&users)
+	database.DB.Model(&models.UserIdentity{}).Count(&links)
+	if users != 1 || links != 1 {
+		t.Fatalf("users = %d, identities = %d", users, links)
+	}
+}
+
+func TestOIDCCallbackUnverifiedEmailNotLinked(t *testing.T) {
+	idp, r := setupOIDCTest(t, core.OIDCConfig{LinkByEmail: true})
+	if _, err := models.CreateUser("alice", "alice@example.com", "secret1", "Alice", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未验证的邮箱不能接管已有账号
+	idp.Login = jwt.MapClaims{"sub": "idp-mallory", "email": "alice@example.com", "email_verified": false}
+	result := ssoLogin(t, idp, r)
+	if result.Get("error") != models.ErrExternalUserAbsent.Error() || result.Get("token") != "" {
+		t.Fatalf("result = %v", result)
+	}
+
+	var links int64
+	database.DB.Model(&models.UserIdentity{}).Count(&links)
+	if links != 0 {
+		t.Fatalf("identities = %d", links)
+	}
+}
+
+func TestOIDCCallbackAutoProvision(t *testing.T) {
+	idp, r := setupOIDCTest(t, core.OIDCConfig{AutoProvision: true, DefaultRole: "user"})
+
+	idp.Login = jwt.MapClaims{"sub": "idp-bob", "email": "bob@example.com", "email_verified": true, "preferred_username": "bob"}
+	result := ssoLogin(t, idp, r)
+	if result.Get("error") != "" || result.Get("token") == "" {
+		t.Fatalf("result = %v", result)
+	}
+
+	user, err := models.GetUserByUsername("bob")
+	if err != nil {
+		t.Fatalf("user not provisioned: %v", err)
+	}
+	if !user.EmailVerified {
+		t.Error("provisioned user email not verified")
+	}
+	if roles := roleNames(t, user); !hasName(roles, "user") {
+		t.Errorf("roles = %v", roles)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	idp, r := setupOIDCTest(t, core.OIDCConfig{AutoProvision: true})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	callback := idp.Authorize(w.Header().Get("Location"))
+
+	// 没有发起登录时写入的 state cookie（登录 CSRF）
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil))
+	result := frontendResult(t, w)
+	if result.Get("error") != models.ErrOIDCStateInvalid.Error() || result.Get("token") != "" {
+		t.Fatalf("result = %v", result)
+	}
+}
@@ -0,0 +1,537 @@
+package gins
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 组织 API
+// 组织上下文由路径 /api/orgs/:orgId/... 或请求头 X-Org-ID 指定，
+// 在组织上下文中 /api/keys、/api/tickets 和 /api/token-usage/stats 操作的是组织的数据
+// ============================================================================
+
+// OrgIDHeader 切换组织上下文的请求头
+const OrgIDHeader = "X-Org-ID"
+
+// CreateOrganizationRequest 创建组织请求
+type CreateOrganizationRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Slug        string `json:"slug" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=500"`
+}
+
+// UpdateOrganizationRequest 更新组织请求，字段为空时不修改
+type UpdateOrganizationRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+}
+
+// AddOrgMemberRequest 添加成员请求，user_id 和 username 二选一
+type AddOrgMemberRequest struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// UpdateOrgMemberRequest 变更成员角色请求
+type UpdateOrgMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UpdateOrgStatusRequest 启用或停用组织请求
+type UpdateOrgStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active suspended"`
+}
+
+// resolveOrgContext 解析请求指定的组织并校验成员身份，失败时已写入响应
+// 平台管理员（system:admin）不是成员时按所有者处理
+func resolveOrgContext(c *gin.Context, user *models.User) bool {
+	raw := c.Param("orgId")
+	if header := c.GetHeader(OrgIDHeader); header != "" {
+		if raw != "" && raw != header {
+			c.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "X-Org-ID 与路径中的组织不一致",
+			})
+			return false
+		}
+		raw = header
+	}
+	if raw == "" {
+		return true
+	}
+
+	orgID, err := uuid.Parse(raw)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid organization id",
+		})
+		return false
+	}
+
+	org, err := models.GetOrganizationByID(orgID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	platformAdmin, err := models.UserHasPermission(user.ID, "system:admin")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	role := ""
+	member, err := models.GetOrgMembership(orgID, user.ID)
+	switch {
+	case err == nil:
+		role = member.Role
+	case errors.Is(err, models.ErrNotOrgMember) && platformAdmin:
+		role = models.OrgRoleOwner
+	case errors.Is(err, models.ErrNotOrgMember):
+		c.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: err.Error(),
+		})
+		return false
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	if org.Status != "active" && !platformAdmin {
+		c.AbortWithStatusJSON(http.StatusForbidden, models.Response{
+			Code:    403,
+			Message: "组织已停用",
+		})
+		return false
+	}
+
+	c.Set("org_id", org.ID)
+	c.Set("org_role", role)
+	c.Set("organization", org)
+	return true
+}
+
+// currentOrgID 获取当前组织上下文，不在组织上下文中时返回 nil
+func currentOrgID(c *gin.Context) *uuid.UUID {
+	value, ok := c.Get("org_id")
+	if !ok {
+		return nil
+	}
+	orgID := value.(uuid.UUID)
+	return &orgID
+}
+
+// orgErrorStatus 按组织相关错误选择状态码
+func orgErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrOrganizationNotFound), errors.Is(err, models.ErrNotOrgMember):
+		return http.StatusNotFound
+	case errors.Is(err, models.ErrOrgOwnerRequired):
+		return http.StatusForbidden
+	case errors.Is(err, models.ErrOrgMemberExists), errors.Is(err, models.ErrOrgSlugExists), errors.Is(err, models.ErrLastOrgOwner):
+		return http.StatusConflict
+	case errors.Is(err, models.ErrInvalidOrgRole):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondOrgError 按错误类型返回
+func respondOrgError(c *gin.Context, err error) {
+	status := orgErrorStatus(err)
+	c.JSON(status, models.Response{
+		Code:    status,
+		Message: err.Error(),
+	})
+}
+
+// GetMyOrganizationsAPI 获取当前用户加入的组织及成员角色
+func GetMyOrganizationsAPI(c *gin.Context) {
+	memberships, err := models.GetUserOrganizations(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	orgs := make([]gin.H, len(memberships))
+	for i, m := range memberships {
+		orgs[i] = gin.H{
+			"organization": m.Organization,
+			"role":         m.Role,
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    orgs,
+	})
+}
+
+// CreateOrganizationAPI 创建组织，当前用户成为所有者
+func CreateOrganizationAPI(c *gin.Context) {
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	org, err := models.CreateOrganization(currentUserID(c), req.Name, req.Slug, req.Description)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, models.ErrOrgSlugExists):
+			status = http.StatusConflict
+		case errors.Is(err, models.ErrOrgLimitReached):
+			status = http.StatusForbidden
+		}
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditOrgCreate, "organization", org.ID.String(), gin.H{"name": org.Name, "slug": org.Slug})
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "organization created successfully",
+		Data:    org,
+	})
+}
+
+// GetOrganizationAPI 获取组织详情和当前用户的成员角色
+func GetOrganizationAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"organization": c.MustGet("organization"),
+			"role":         c.GetString("org_role"),
+		},
+	})
+}
+
+// UpdateOrganizationAPI 更新组织名称和描述
+func UpdateOrganizationAPI(c *gin.Context) {
+	var req UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	orgID := *currentOrgID(c)
+	org, err := models.UpdateOrganization(orgID, req.Name, req.Description)
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	audit(c, models.AuditOrgUpdate, "organization", orgID.String(), req)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "organization updated successfully",
+		Data:    org,
+	})
+}
+
+// DeleteOrganizationAPI 删除组织，组织的 API 密钥同时撤销
+func DeleteOrganizationAPI(c *gin.Context) {
+	orgID := *currentOrgID(c)
+	if err := models.DeleteOrganization(orgID); err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	audit(c, models.AuditOrgDelete, "organization", orgID.String(), nil)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "organization deleted successfully",
+	})
+}
+
+// GetOrgMembersAPI 获取组织成员列表
+func GetOrgMembersAPI(c *gin.Context) {
+	members, err := models.GetOrgMembers(*currentOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    members,
+	})
+}
+
+// AddOrgMemberAPI 按用户 ID 或用户名添加组织成员
+func AddOrgMemberAPI(c *gin.Context) {
+	var req AddOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	var userID uuid.UUID
+	switch {
+	case req.UserID != "":
+		id, err := uuid.Parse(req.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "invalid user id",
+			})
+			return
+		}
+		userID = id
+	case req.Username != "":
+		user, err := models.GetUserByUsername(req.Username)
+		if err != nil {
+			c.JSON(http.StatusNotFound, models.Response{
+				Code:    404,
+				Message: err.Error(),
+			})
+			return
+		}
+		userID = user.ID
+	default:
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "user_id or username is required",
+		})
+		return
+	}
+
+	orgID := *currentOrgID(c)
+	member, err := models.AddOrgMember(orgID, userID, req.Role, c.GetString("org_role"))
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	audit(c, models.AuditOrgMemberAdd, "organization", orgID.String(), gin.H{"user_id": userID, "role": req.Role})
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "member added successfully",
+		Data:    member,
+	})
+}
+
+// UpdateOrgMemberAPI 变更成员角色
+func UpdateOrgMemberAPI(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	var req UpdateOrgMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	orgID := *currentOrgID(c)
+	member, err := models.UpdateOrgMemberRole(orgID, userID, req.Role, c.GetString("org_role"))
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	audit(c, models.AuditOrgMemberUpdate, "organization", orgID.String(), gin.H{"user_id": userID, "role": req.Role})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "member updated successfully",
+		Data:    member,
+	})
+}
+
+// RemoveOrgMemberAPI 移除组织成员
+func RemoveOrgMemberAPI(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	orgID := *currentOrgID(c)
+	if err := models.RemoveOrgMember(orgID, userID, c.GetString("org_role"), userID == currentUserID(c)); err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	audit(c, models.AuditOrgMemberRemove, "organization", orgID.String(), gin.H{"user_id": userID})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "member removed successfully",
+	})
+}
+
+// LeaveOrganizationAPI 当前用户退出组织，最后一名所有者不能退出
+func LeaveOrganizationAPI(c *gin.Context) {
+	orgID := *currentOrgID(c)
+	userID := currentUserID(c)
+	if err := models.RemoveOrgMember(orgID, userID, c.GetString("org_role"), true); err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	audit(c, models.AuditOrgMemberRemove, "organization", orgID.String(), gin.H{"user_id": userID, "self": true})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "left organization successfully",
+	})
+}
+
+// GetOrgWalletAPI 获取组织钱包
+func GetOrgWalletAPI(c *gin.Context) {
+	respondWallet(c, models.WalletOwnerOrganization, *currentOrgID(c))
+}
+
+// GetOrgWalletTransactionsAPI 获取组织钱包流水
+func GetOrgWalletTransactionsAPI(c *gin.Context) {
+	respondWalletTransactions(c, models.WalletOwnerOrganization, *currentOrgID(c))
+}
+
+// CreditOrgWalletAPI 为组织钱包充值（平台管理员）
+func CreditOrgWalletAPI(c *gin.Context) {
+	orgID := *currentOrgID(c)
+	if wallet := creditWallet(c, models.WalletOwnerOrganization, orgID); wallet != nil {
+		audit(c, models.AuditOrgWalletCredit, "organization", orgID.String(), gin.H{"balance": wallet.Balance})
+	}
+}
+
+// GetOrgUsageAPI 获取组织按模型汇总的Token使用
+func GetOrgUsageAPI(c *gin.Context) {
+	summary, err := models.GetOrganizationTokenUsageSummary(*currentOrgID(c), nil, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    summary,
+	})
+}
+
+// AdminGetOrganizationsAPI 分页获取所有组织（平台管理员）
+func AdminGetOrganizationsAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	orgs, total, err := models.GetAllOrganizations(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"organizations": orgs,
+			"total":         total,
+		},
+	})
+}
+
+// AdminUpdateOrganizationStatusAPI 启用或停用组织（平台管理员）
+func AdminUpdateOrganizationStatusAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid organization id",
+		})
+		return
+	}
+
+	var req UpdateOrgStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	org, err := models.SetOrganizationStatus(id, req.Status)
+	if err != nil {
+		respondOrgError(c, err)
+		return
+	}
+
+	audit(c, models.AuditOrgStatusUpdate, "organization", id.String(), req)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "organization status updated successfully",
+		Data:    org,
+	})
+}
@@ -0,0 +1,163 @@
+package gins
+
+import (
+	"net/http"
+	"time"
+
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 定价管理 API
+// ============================================================================
+
+// PriceTierRequest 阶梯价格
+type PriceTierRequest struct {
+	MinTokens        int64   `json:"min_tokens" binding:"required,gt=0"`
+	InputPrice       float64 `json:"input_price"`
+	OutputPrice      float64 `json:"output_price"`
+	CachedInputPrice float64 `json:"cached_input_price"`
+}
+
+// CreateServicePriceRequest 新增价格版本请求
+type CreateServicePriceRequest struct {
+	InputPrice       float64            `json:"input_price"`
+	OutputPrice      float64            `json:"output_price"`
+	CachedInputPrice float64            `json:"cached_input_price"`
+	EffectiveFrom    *time.Time         `json:"effective_from"` // 为空时立即生效
+	Tiers            []PriceTierRequest `json:"tiers"`
+	Note             string             `json:"note"`
+}
+
+// RecomputeCostsRequest 花费重算请求
+type RecomputeCostsRequest struct {
+	ServiceID     string    `json:"service_id"` // 为空时重算全部服务
+	Start         time.Time `json:"start" binding:"required"`
+	End           time.Time `json:"end" binding:"required"`
+	AdjustWallets bool      `json:"adjust_wallets"` // 是否将差额计入用户钱包
+}
+
+// GetServicePricesAPI 获取服务的价格版本历史
+func GetServicePricesAPI(c *gin.Context) {
+	serviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid service id",
+		})
+		return
+	}
+
+	prices, err := models.GetServicePrices(serviceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    prices,
+	})
+}
+
+// CreateServicePriceAPI 新增价格版本
+func CreateServicePriceAPI(c *gin.Context) {
+	serviceID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid service id",
+		})
+		return
+	}
+
+	var req CreateServicePriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	tiers := make([]models.PriceTier, len(req.Tiers))
+	for i, t := range req.Tiers {
+		tiers[i] = models.PriceTier{
+			MinTokens:        t.MinTokens,
+			InputPrice:       t.InputPrice,
+			OutputPrice:      t.OutputPrice,
+			CachedInputPrice: t.CachedInputPrice,
+		}
+	}
+
+	operatorID := currentUserID(c)
+	price, err := models.CreateServicePrice(serviceID, req.InputPrice, req.OutputPrice, req.CachedInputPrice, req.EffectiveFrom, tiers, req.Note, &operatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "price created successfully",
+		Data:    price,
+	})
+}
+
+// RecomputeCostsAPI 按当时生效的价格重算指定时间范围内的调用花费
+func RecomputeCostsAPI(c *gin.Context) {
+	var req RecomputeCostsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+	if !req.End.After(req.Start) {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "end must be after start",
+		})
+		return
+	}
+
+	var serviceID *uuid.UUID
+	if req.ServiceID != "" {
+		id, err := uuid.Parse(req.ServiceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.Response{
+				Code:    400,
+				Message: "invalid service id",
+			})
+			return
+		}
+		serviceID = &id
+	}
+
+	operatorID := currentUserID(c)
+	result, err := models.RecomputeUsageCosts(serviceID, req.Start, req.End, req.AdjustWallets, &operatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "costs recomputed successfully",
+		Data:    result,
+	})
+}
@@ -0,0 +1,168 @@
+package gins
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"macg/core"
+	"macg/models"
+	"macg/ratelimit"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// 网关限流中间件
+// 按 API 密钥、用户和服务三个维度分别限制每分钟请求数和 Token 数
+// ============================================================================
+
+// ctxUsageTokens 处理函数写入的本次请求实际消耗 Token 数，用于请求结束后扣减 TPM 令牌桶
+const ctxUsageTokens = "usage_tokens"
+
+// rateLimitRule 单个维度的限流规则
+type rateLimitRule struct {
+	key string
+	rpm ratelimit.Limit
+	tpm ratelimit.Limit
+}
+
+// rateLimitMiddleware 网关限流中间件，需在 apiKeyMiddleware 之后使用
+func rateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := c.MustGet("api_key").(*models.APIKey)
+		cfg := core.Cfg.RateLimit
+		store := ratelimit.Default()
+		ctx := c.Request.Context()
+
+		rules := []rateLimitRule{
+			{key: "key:" + apiKey.ID.String(), rpm: ratelimit.PerMinute(cfg.KeyRPM), tpm: ratelimit.PerMinute(cfg.KeyTPM)},
+			{key: "user:" + apiKey.UserID.String(), rpm: ratelimit.PerMinute(cfg.UserRPM), tpm: ratelimit.PerMinute(cfg.UserTPM)},
+		}
+		service := peekRequestService(c)
+		if c.IsAborted() {
+			return
+		}
+		if service != nil {
+			rules = append(rules, rateLimitRule{
+				key: "service:" + service.ID.String(),
+				rpm: ratelimit.PerMinute(service.RateLimit),
+				tpm: ratelimit.PerMinute(service.TokenLimit),
+			})
+		}
+
+		// 分别记录剩余量最少的请求桶和 Token 桶，用于响应头
+		var requests, tokens *ratelimit.Result
+		take := func(key string, limit ratelimit.Limit, n int, tightest **ratelimit.Result) bool {
+			if limit.Unlimited() {
+				return true
+			}
+			result, err := store.Take(ctx, key, limit, n)
+			if err != nil {
+				// 限流存储故障时放行，避免影响正常请求
+				zap.L().Error("限流检查失败", zap.String("key", key), zap.Error(err))
+				return true
+			}
+			if *tightest == nil || result.Remaining < (*tightest).Remaining || !result.Allowed {
+				*tightest = &result
+			}
+			if result.Allowed {
+				return true
+			}
+
+			setRateLimitHeaders(c, requests, tokens)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			zap.L().Info("触发限流", zap.String("key", key))
+			relayError(c, http.StatusTooManyRequests, "rate_limit_exceeded",
+				fmt.Sprintf("rate limit reached for %s, please retry after %s", key, result.RetryAfter.Round(time.Second)))
+			return false
+		}
+
+		// 先检查所有 Token 桶（n 为0不扣除），再依次扣除请求桶；
+		// 后面的规则拒绝时归还前面已扣除的请求令牌，被拒绝的请求不占用任何维度的额度
+		for _, rule := range rules {
+			if !take(rule.key+":tpm", rule.tpm, 0, &tokens) {
+				return
+			}
+		}
+		for i, rule := range rules {
+			if take(rule.key+":rpm", rule.rpm, 1, &requests) {
+				continue
+			}
+			for _, taken := range rules[:i] {
+				if taken.rpm.Unlimited() {
+					continue
+				}
+				if err := store.Consume(ctx, taken.key+":rpm", taken.rpm, -1); err != nil {
+					zap.L().Error("归还请求令牌失败", zap.String("key", taken.key), zap.Error(err))
+				}
+			}
+			return
+		}
+		setRateLimitHeaders(c, requests, tokens)
+
+		c.Next()
+
+		used := c.GetInt(ctxUsageTokens)
+		if used <= 0 {
+			return
+		}
+		for _, rule := range rules {
+			if rule.tpm.Unlimited() {
+				continue
+			}
+			if err := store.Consume(ctx, rule.key+":tpm", rule.tpm, used); err != nil {
+				zap.L().Error("扣减Token令牌桶失败", zap.String("key", rule.key), zap.Error(err))
+			}
+		}
+	}
+}
+
+// maxPeekBodySize 网关请求体大小上限
+const maxPeekBodySize = 32 << 20
+
+// peekRequestService 读取请求体中的 model 字段并查找对应服务，请求体会被还原供后续处理函数使用
+func peekRequestService(c *gin.Context) *models.ServiceModel {
+	if c.Request.Body == nil || c.Request.Method != http.MethodPost {
+		return nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPeekBodySize))
+	if err != nil {
+		// 超出上限时已读部分无法还原，直接拒绝
+		relayError(c, http.StatusRequestEntityTooLarge, "request_too_large", err.Error())
+		return nil
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var peek struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &peek); err != nil || peek.Model == "" {
+		return nil
+	}
+	service, err := models.GetActiveServiceByModelID(peek.Model)
+	if err != nil {
+		return nil
+	}
+	return service
+}
+
+// setRateLimitHeaders 设置 OpenAI 风格的 X-RateLimit-* 响应头
+func setRateLimitHeaders(c *gin.Context, requests, tokens *ratelimit.Result) {
+	if requests != nil {
+		c.Header("X-RateLimit-Limit-Requests", strconv.Itoa(requests.Limit))
+		c.Header("X-RateLimit-Remaining-Requests", strconv.Itoa(requests.Remaining))
+		c.Header("X-RateLimit-Reset-Requests", requests.Reset.Round(time.Millisecond).String())
+	}
+	if tokens != nil {
+		c.Header("X-RateLimit-Limit-Tokens", strconv.Itoa(tokens.Limit))
+		c.Header("X-RateLimit-Remaining-Tokens", strconv.Itoa(tokens.Remaining))
+		c.Header("X-RateLimit-Reset-Tokens", tokens.Reset.Round(time.Millisecond).String())
+	}
+}
@@ -0,0 +1,477 @@
+package gins
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 角色与权限管理 API
+// ============================================================================
+
+// CreateRoleRequest 创建角色请求
+type CreateRoleRequest struct {
+	Name          string      `json:"name" binding:"required"`
+	DisplayName   string      `json:"display_name"`
+	Description   string      `json:"description"`
+	PermissionIDs []uuid.UUID `json:"permission_ids"`
+}
+
+// UpdateRoleRequest 更新角色请求
+type UpdateRoleRequest struct {
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+}
+
+// UpdateRolePermissionsRequest 替换角色权限请求
+type UpdateRolePermissionsRequest struct {
+	PermissionIDs []uuid.UUID `json:"permission_ids"`
+}
+
+// RoleTwoFactorPolicyRequest 角色双因素认证策略请求
+type RoleTwoFactorPolicyRequest struct {
+	Require2FA bool `json:"require_2fa"`
+}
+
+// CreatePermissionRequest 创建权限请求
+type CreatePermissionRequest struct {
+	Resource    string `json:"resource" binding:"required"`
+	Action      string `json:"action" binding:"required"`
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+}
+
+// AssignUserRoleRequest 为用户分配角色请求
+type AssignUserRoleRequest struct {
+	RoleID uuid.UUID `json:"role_id" binding:"required"`
+}
+
+// audit 以当前登录用户的身份记录审计日志
+func audit(c *gin.Context, action, targetType, targetID string, detail interface{}) {
+	actorID := currentUserID(c)
+	// 模拟登录期间记为实际操作的管理员
+	if admin := currentImpersonator(c); admin != nil {
+		actorID = admin.ID
+	}
+	models.RecordAuditLog(&actorID, action, targetType, targetID, detail, c.ClientIP())
+}
+
+// roleErrorStatus 系统角色返回 403，其余按请求错误处理
+func roleErrorStatus(err error) int {
+	if errors.Is(err, models.ErrSystemRole) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// GetRolesAPI 获取所有角色及其权限
+func GetRolesAPI(c *gin.Context) {
+	roles, err := models.GetAllRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    roles,
+	})
+}
+
+// GetRoleAPI 获取角色详情
+func GetRoleAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid role id",
+		})
+		return
+	}
+
+	role, err := models.GetRoleByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    role,
+	})
+}
+
+// CreateRoleAPI 创建自定义角色
+func CreateRoleAPI(c *gin.Context) {
+	var req CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	role, err := models.CreateRole(req.Name, req.DisplayName, req.Description, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+	if len(req.PermissionIDs) > 0 {
+		if role, err = models.UpdateRolePermissions(role.ID, req.PermissionIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, models.Response{
+				Code:    500,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	audit(c, models.AuditRoleCreate, "role", role.ID.String(), req)
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "role created successfully",
+		Data:    role,
+	})
+}
+
+// UpdateRoleAPI 更新自定义角色
+func UpdateRoleAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid role id",
+		})
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	role, err := models.UpdateRole(id, req.DisplayName, req.Description)
+	if err != nil {
+		status := roleErrorStatus(err)
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditRoleUpdate, "role", id.String(), req)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "role updated successfully",
+		Data:    role,
+	})
+}
+
+// UpdateRolePermissionsAPI 替换自定义角色的权限集合
+func UpdateRolePermissionsAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid role id",
+		})
+		return
+	}
+
+	var req UpdateRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	role, err := models.UpdateRolePermissions(id, req.PermissionIDs)
+	if err != nil {
+		status := roleErrorStatus(err)
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditRolePermissionsUpdate, "role", id.String(), req)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "role permissions updated successfully",
+		Data:    role,
+	})
+}
+
+// SetRoleTwoFactorPolicyAPI 设置角色是否要求双因素认证，系统角色同样可设置
+func SetRoleTwoFactorPolicyAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid role id",
+		})
+		return
+	}
+
+	var req RoleTwoFactorPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	role, err := models.SetRoleTwoFactorPolicy(id, req.Require2FA)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditRoleTwoFactorPolicy, "role", id.String(), req)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "role 2fa policy updated successfully",
+		Data:    role,
+	})
+}
+
+// DeleteRoleAPI 删除自定义角色
+func DeleteRoleAPI(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid role id",
+		})
+		return
+	}
+
+	if err := models.DeleteRole(id); err != nil {
+		status := roleErrorStatus(err)
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditRoleDelete, "role", id.String(), nil)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "role deleted successfully",
+	})
+}
+
+// GetPermissionsAPI 获取所有权限
+func GetPermissionsAPI(c *gin.Context) {
+	permissions, err := models.GetAllPermissions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    permissions,
+	})
+}
+
+// CreatePermissionAPI 创建权限，名称为 resource:action
+func CreatePermissionAPI(c *gin.Context) {
+	var req CreatePermissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if strings.Contains(req.Resource, ":") || strings.Contains(req.Action, ":") {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "resource and action must not contain ':'",
+		})
+		return
+	}
+
+	name := req.Resource + ":" + req.Action
+	permission, err := models.CreatePermission(name, req.DisplayName, req.Description, req.Resource, req.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditPermissionCreate, "permission", permission.ID.String(), req)
+
+	c.JSON(http.StatusCreated, models.Response{
+		Code:    201,
+		Message: "permission created successfully",
+		Data:    permission,
+	})
+}
+
+// GetUserRolesAPI 获取用户的角色
+func GetUserRolesAPI(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	roles, err := models.GetUserRoles(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    roles,
+	})
+}
+
+// AssignUserRoleAPI 为用户追加角色
+func AssignUserRoleAPI(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	var req AssignUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	if err := models.AddRoleToUser(userID, req.RoleID); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditUserRoleAssign, "user", userID.String(), req)
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "role assigned successfully",
+	})
+}
+
+// UnassignUserRoleAPI 解除用户的角色
+func UnassignUserRoleAPI(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+	roleID, err := uuid.Parse(c.Param("roleId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid role id",
+		})
+		return
+	}
+
+	if err := models.RemoveRoleFromUser(userID, roleID); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	audit(c, models.AuditUserRoleUnassign, "user", userID.String(), gin.H{"role_id": roleID})
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "role unassigned successfully",
+	})
+}
+
+// GetAuditLogsAPI 分页查询审计日志
+func GetAuditLogsAPI(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	logs, total, err := models.GetAuditLogs(c.Query("action"), c.Query("target_type"), c.Query("target_id"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"logs":  logs,
+			"total": total,
+		},
+	})
+}
@@ -0,0 +1,381 @@
+package gins
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"macg/core"
+	"macg/models"
+	"macg/relay"
+	"macg/tokenizer"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// OpenAI 兼容网关 API
+// ============================================================================
+
+// ChatCompletions 对话补全接口，转发至上游并记录Token用量
+func ChatCompletions(c *gin.Context) {
+	apiKey := c.MustGet("api_key").(*models.APIKey)
+
+	var req models.ChatCompletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		relayError(c, http.StatusBadRequest, "invalid_request_error", "invalid request: "+err.Error())
+		return
+	}
+	if req.Model == "" || len(req.Messages) == 0 {
+		relayError(c, http.StatusBadRequest, "invalid_request_error", "model and messages are required")
+		return
+	}
+
+	service, err := models.GetActiveServiceByModelID(req.Model)
+	if err != nil || !apiKey.CanUseModel(service.ModelID) {
+		relayError(c, http.StatusNotFound, "model_not_found", "the model `"+req.Model+"` does not exist or is not available")
+		return
+	}
+
+	// 发往上游前按本地分词估算提示 Token，超出模型限制的请求直接拒绝
+	promptTokens := tokenizer.CountRequestTokens(&req)
+	if !checkTokenLimits(c, service, &req, promptTokens) {
+		return
+	}
+
+	requestID := "req-" + uuid.New().String()
+	c.Header("X-Request-ID", requestID)
+
+	if !holdRequestFunds(c, apiKey, service, &req, requestID, promptTokens) {
+		return
+	}
+	defer releaseRequestFunds(c, requestID)
+
+	zap.L().Debug("转发对话补全请求",
+		zap.String("request_id", requestID),
+		zap.String("model", req.Model),
+		zap.Bool("stream", req.Stream),
+		zap.String("api_key", apiKey.KeyPrefix),
+		zap.Int("prompt_tokens", promptTokens),
+	)
+
+	if req.Stream {
+		streamChatCompletions(c, apiKey, service, &req, requestID, promptTokens)
+		return
+	}
+
+	resp, err := relay.ChatCompletionWithFailover(c.Request.Context(), service, requestID, &req)
+	if err != nil {
+		handleUpstreamError(c, requestID, err)
+		return
+	}
+
+	if resp.Usage == nil {
+		var completion strings.Builder
+		for _, choice := range resp.Choices {
+			completion.WriteString(choice.Message.TextContent())
+		}
+		resp.Usage = estimateUsage(req.Model, promptTokens, completion.String())
+	}
+
+	recordRelayUsage(c, apiKey, service, requestID, resp.Usage)
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkTokenLimits 将 max_tokens 截断到服务上限，并检查提示与补全之和是否超出上下文窗口
+func checkTokenLimits(c *gin.Context, service *models.ServiceModel, req *models.ChatCompletionRequest, promptTokens int) bool {
+	if service.MaxTokens > 0 && req.MaxTokens > service.MaxTokens {
+		req.MaxTokens = service.MaxTokens
+	}
+	if service.MaxTokens > 0 && req.MaxCompletionTokens > service.MaxTokens {
+		req.MaxCompletionTokens = service.MaxTokens
+	}
+	maxOutput := req.OutputTokenLimit()
+
+	// 未配置上下文窗口的旧数据以 MaxTokens 作为总上限
+	window := service.ContextWindow
+	if window == 0 {
+		window = service.MaxTokens
+	}
+	if window > 0 && promptTokens+maxOutput > window {
+		c.AbortWithStatusJSON(http.StatusBadRequest, models.ChatErrorResponse{
+			Error: models.ChatError{
+				Message: fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or completion.",
+					window, promptTokens+maxOutput, promptTokens, maxOutput),
+				Type: "invalid_request_error",
+				Code: "context_length_exceeded",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// estimateUsage 上游未返回用量时按本地分词估算
+func estimateUsage(model string, promptTokens int, completion string) *models.ChatUsage {
+	output := tokenizer.CountText(model, completion)
+	return &models.ChatUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: output,
+		TotalTokens:      promptTokens + output,
+	}
+}
+
+// ListModels 列出当前密钥可用的模型
+func ListModels(c *gin.Context) {
+	apiKey := c.MustGet("api_key").(*models.APIKey)
+
+	services, err := models.GetActiveServices()
+	if err != nil {
+		zap.L().Error("查询模型列表失败", zap.Error(err))
+		relayError(c, http.StatusInternalServerError, "server_error", "failed to list models")
+		return
+	}
+
+	list := models.ModelList{Object: "list", Data: []models.ModelObject{}}
+	for i := range services {
+		if !apiKey.CanUseModel(services[i].ModelID) {
+			continue
+		}
+		rates, err := models.GetServiceRates(&services[i], time.Now(), 0)
+		if err != nil {
+			zap.L().Error("查询模型价格失败", zap.String("model", services[i].ModelID), zap.Error(err))
+			continue
+		}
+		list.Data = append(list.Data, services[i].ModelObject(rates))
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// RetrieveModel 获取单个模型信息
+func RetrieveModel(c *gin.Context) {
+	apiKey := c.MustGet("api_key").(*models.APIKey)
+	modelID := c.Param("model")
+
+	service, err := models.GetActiveServiceByModelID(modelID)
+	if err != nil || !apiKey.CanUseModel(service.ModelID) {
+		relayError(c, http.StatusNotFound, "model_not_found", "the model `"+modelID+"` does not exist or is not available")
+		return
+	}
+
+	rates, err := models.GetServiceRates(service, time.Now(), 0)
+	if err != nil {
+		zap.L().Error("查询模型价格失败", zap.String("model", service.ModelID), zap.Error(err))
+		relayError(c, http.StatusInternalServerError, "server_error", "failed to retrieve model")
+		return
+	}
+
+	c.JSON(http.StatusOK, service.ModelObject(rates))
+}
+
+// streamChatCompletions 以 SSE 逐块转发上游流式响应
+func streamChatCompletions(c *gin.Context, apiKey *models.APIKey, service *models.ServiceModel, req *models.ChatCompletionRequest, requestID string, promptTokens int) {
+	// 始终向上游请求用量统计，客户端未要求时不转发用量数据块
+	clientWantsUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	req.StreamOptions = &models.StreamOptions{IncludeUsage: true}
+
+	stream, err := relay.ChatCompletionStreamWithFailover(c.Request.Context(), service, requestID, req)
+	if err != nil {
+		handleUpstreamError(c, requestID, err)
+		return
+	}
+	defer stream.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	var usage *models.ChatUsage
+	var completion strings.Builder
+
+	clientGone := c.Stream(func(w io.Writer) bool {
+		chunk, raw, err := stream.Recv()
+		if err == io.EOF {
+			c.SSEvent("", "[DONE]")
+			return false
+		}
+		if err != nil {
+			if c.Request.Context().Err() == nil {
+				zap.L().Warn("读取上游流失败", zap.String("request_id", requestID), zap.Error(err))
+				c.SSEvent("", models.ChatErrorResponse{Error: models.ChatError{Message: "upstream stream interrupted", Type: "upstream_error"}})
+			}
+			return false
+		}
+
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			completion.WriteString(choice.Delta.Content)
+			for _, tc := range choice.Delta.ToolCalls {
+				completion.WriteString(tc.Function.Name)
+				completion.WriteString(tc.Function.Arguments)
+			}
+		}
+
+		if len(chunk.Choices) == 0 && chunk.Usage != nil && !clientWantsUsage {
+			return true
+		}
+		c.SSEvent("", string(raw))
+		return true
+	})
+
+	if clientGone {
+		zap.L().Info("客户端已断开，取消上游请求", zap.String("request_id", requestID))
+	}
+
+	// 上游未返回用量（或中途断开）时按已转发内容估算
+	if usage == nil {
+		usage = estimateUsage(req.Model, promptTokens, completion.String())
+	}
+	recordRelayUsage(c, apiKey, service, requestID, usage)
+}
+
+// handleUpstreamError 将上游错误转换为客户端响应
+func handleUpstreamError(c *gin.Context, requestID string, err error) {
+	var upErr *relay.UpstreamError
+	if errors.As(err, &upErr) {
+		zap.L().Warn("上游返回错误", zap.String("request_id", requestID), zap.Int("status", upErr.StatusCode))
+		// 上游 401/403 是渠道凭据的问题，原样返回会让客户端误以为网关密钥无效
+		if upErr.StatusCode == http.StatusUnauthorized || upErr.StatusCode == http.StatusForbidden {
+			relayError(c, http.StatusBadGateway, "upstream_error", "upstream rejected the channel credentials")
+			return
+		}
+		c.AbortWithStatusJSON(upErr.StatusCode, upErr.Response())
+		return
+	}
+	zap.L().Error("上游请求失败", zap.String("request_id", requestID), zap.Error(err))
+	relayError(c, http.StatusBadGateway, "upstream_error", "upstream request failed")
+}
+
+// recordRelayUsage 写入Token使用记录（花费由计费引擎计算）并结算冻结，同时供限流中间件扣减 Token 令牌桶
+func recordRelayUsage(c *gin.Context, apiKey *models.APIKey, service *models.ServiceModel, requestID string, usage *models.ChatUsage) {
+	var inputTokens, outputTokens, cachedTokens int
+	if usage != nil {
+		inputTokens = usage.PromptTokens
+		outputTokens = usage.CompletionTokens
+		if usage.PromptTokensDetails != nil {
+			cachedTokens = usage.PromptTokensDetails.CachedTokens
+		}
+	}
+	c.Set(ctxUsageTokens, inputTokens+outputTokens)
+
+	var cost float64
+	record, err := models.RecordTokenUsage(apiKey.UserID, apiKey, service, inputTokens, outputTokens, cachedTokens, requestID)
+	if err != nil {
+		zap.L().Error("记录Token使用失败", zap.String("request_id", requestID), zap.Error(err))
+		// 记录失败时仍按基础单价结算，避免漏扣
+		cost, _ = models.EstimateCost(service, inputTokens, outputTokens)
+	} else {
+		cost = record.Cost
+	}
+
+	if c.GetBool(ctxWalletHeld) {
+		if err := models.SettleHold(requestID, cost); err != nil {
+			zap.L().Error("结算请求花费失败", zap.String("request_id", requestID), zap.Float64("cost", cost), zap.Error(err))
+		}
+		c.Set(ctxWalletHeld, false)
+	}
+}
+
+// ctxWalletHeld 本次请求是否已冻结余额且尚未结算
+const ctxWalletHeld = "wallet_held"
+
+// walletOwner 返回承担本次请求费用的钱包所有者，组织密钥由组织钱包支付
+func walletOwner(apiKey *models.APIKey) (string, uuid.UUID) {
+	if apiKey.OrganizationID != nil {
+		return models.WalletOwnerOrganization, *apiKey.OrganizationID
+	}
+	return models.WalletOwnerUser, apiKey.UserID
+}
+
+// defaultHoldOutputTokens 未配置 billing.default_hold_output_tokens 时每个候选按此补全 Token 数冻结
+const defaultHoldOutputTokens = 4096
+
+// holdOutputTokens 冻结余额时估算的补全 Token 数：依次取请求的输出上限、服务上限和默认上限，
+// 不超过上下文窗口剩余空间，n 个候选各自计费
+func holdOutputTokens(service *models.ServiceModel, req *models.ChatCompletionRequest, promptTokens int) int {
+	perChoice := req.OutputTokenLimit()
+	if perChoice <= 0 {
+		perChoice = service.MaxTokens
+	}
+	if perChoice <= 0 {
+		perChoice = defaultHoldOutputTokens
+		if n := core.Cfg.Billing.DefaultHoldOutputTokens; n > 0 {
+			perChoice = n
+		}
+		if window := service.ContextWindow; window > promptTokens && perChoice > window-promptTokens {
+			perChoice = window - promptTokens
+		}
+	}
+
+	choices := req.N
+	if choices < 1 {
+		choices = 1
+	}
+	return perChoice * choices
+}
+
+// holdRequestFunds 按估算的提示 Token 与最大补全 Token 冻结余额，余额不足时返回 402
+func holdRequestFunds(c *gin.Context, apiKey *models.APIKey, service *models.ServiceModel, req *models.ChatCompletionRequest, requestID string, promptTokens int) bool {
+	if !core.Cfg.Billing.Enabled {
+		return true
+	}
+
+	amount, err := models.EstimateCost(service, promptTokens, holdOutputTokens(service, req, promptTokens))
+	if err != nil {
+		zap.L().Error("估算请求花费失败", zap.String("request_id", requestID), zap.Error(err))
+		relayError(c, http.StatusInternalServerError, "server_error", "billing is temporarily unavailable")
+		return false
+	}
+	if amount <= 0 {
+		return true
+	}
+
+	ownerType, ownerID := walletOwner(apiKey)
+	if _, err := models.HoldFunds(ownerType, ownerID, requestID, amount); err != nil {
+		if errors.Is(err, models.ErrInsufficientBalance) {
+			c.AbortWithStatusJSON(http.StatusPaymentRequired, models.ChatErrorResponse{
+				Error: models.ChatError{
+					Message: "You exceeded your current quota, please top up your wallet.",
+					Type:    "insufficient_quota",
+					Code:    "insufficient_quota",
+				},
+			})
+			return false
+		}
+		zap.L().Error("冻结余额失败", zap.String("request_id", requestID), zap.Error(err))
+		relayError(c, http.StatusInternalServerError, "server_error", "billing is temporarily unavailable")
+		return false
+	}
+
+	c.Set(ctxWalletHeld, true)
+	return true
+}
+
+// releaseRequestFunds 请求失败未结算时释放冻结
+func releaseRequestFunds(c *gin.Context, requestID string) {
+	if !c.GetBool(ctxWalletHeld) {
+		return
+	}
+	if err := models.ReleaseHold(requestID); err != nil && !errors.Is(err, models.ErrHoldNotFound) {
+		zap.L().Error("释放冻结失败", zap.String("request_id", requestID), zap.Error(err))
+	}
+}
+
+// relayError 返回 OpenAI 风格的错误响应
+func relayError(c *gin.Context, status int, errType, message string) {
+	c.AbortWithStatusJSON(status, models.ChatErrorResponse{
+		Error: models.ChatError{
+			Message: message,
+			Type:    errType,
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package gins
+
+import (
+	"testing"
+
+	"macg/core"
+	"macg/models"
+)
+
+func TestHoldOutputTokens(t *testing.T) {
+	core.Cfg.Billing.DefaultHoldOutputTokens = 0
+	t.Cleanup(func() { core.Cfg.Billing.DefaultHoldOutputTokens = 0 })
+
+	cases := []struct {
+		name    string
+		service models.ServiceModel
+		req     models.ChatCompletionRequest
+		prompt  int
+		want    int
+	}{
+		{"max_tokens", models.ServiceModel{MaxTokens: 8192}, models.ChatCompletionRequest{MaxTokens: 100}, 10, 100},
+		{"max_completion_tokens", models.ServiceModel{MaxTokens: 8192}, models.ChatCompletionRequest{MaxCompletionTokens: 200}, 10, 200},
+		{"service limit", models.ServiceModel{MaxTokens: 8192}, models.ChatCompletionRequest{}, 10, 8192},
+		{"default limit", models.ServiceModel{}, models.ChatCompletionRequest{}, 10, defaultHoldOutputTokens},
+		{"default limit within context window", models.ServiceModel{ContextWindow: 1000}, models.ChatCompletionRequest{}, 400, 600},
+		{"n choices", models.ServiceModel{}, models.ChatCompletionRequest{MaxTokens: 100, N: 3}, 10, 300},
+		{"n choices with default limit", models.ServiceModel{}, models.ChatCompletionRequest{N: 2}, 10, 2 * defaultHoldOutputTokens},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := holdOutputTokens(&tc.service, &tc.req, tc.prompt); got != tc.want {
+				t.Errorf("holdOutputTokens = %d, want %d", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("configured default", func(t *testing.T) {
+		core.Cfg.Billing.DefaultHoldOutputTokens = 1000
+		if got := holdOutputTokens(&models.ServiceModel{}, &models.ChatCompletionRequest{}, 10); got != 1000 {
+			t.Errorf("holdOutputTokens = %d, want 1000", got)
+		}
+	})
+}
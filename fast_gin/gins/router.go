@@ -3,6 +3,8 @@ package gins
 import (
 	"net/http"
 
+	"macg/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -13,8 +15,9 @@ func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Org-ID, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", ImpersonationHeader)
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -37,45 +40,167 @@ func RouterInit(r *gin.Engine) {
 
 	// 认证接口
 	r.POST("/api/login", login)
+	r.POST("/api/login/2fa", loginTwoFactor)
 	r.POST("/api/register", register)
+	r.POST("/api/auth/refresh", RefreshTokenAPI)
+	r.GET("/api/auth/public-key", LoginPublicKeyAPI)
+	r.POST("/api/auth/forgot-password", ForgotPasswordAPI)
+	r.POST("/api/auth/reset-password", ResetPasswordAPI)
+	r.POST("/api/auth/verify-email", VerifyEmailAPI)
+	r.POST("/api/auth/resend-verification", ResendVerificationAPI)
+	r.GET("/api/auth/oidc/config", OIDCConfigAPI)
+	r.GET("/api/auth/oidc/login", OIDCLoginAPI)
+	r.GET("/api/auth/oidc/callback", OIDCCallbackAPI)
+	r.GET("/api/auth/registration", GetRegistrationSettingsAPI)
+	r.POST("/api/auth/invitations/preview", PreviewInvitationAPI)
+	r.GET("/.well-known/jwks.json", JWKSAPI)
+
+	// 以下接口需要登录
+	api := r.Group("/api", AuthMiddleware())
 
 	// 仪表板接口
-	r.GET("/api/dashboard", GetDashboardData)
+	api.GET("/dashboard", RequirePermission("dashboard:view"), GetDashboardData)
+
+	// 当前用户接口
+	// 修改密码、双因素认证、创建密钥和充值等敏感操作在模拟登录期间禁止
+	api.POST("/auth/logout", LogoutAPI)
+	api.POST("/auth/impersonation/stop", StopImpersonationAPI)
+	api.GET("/me/permissions", GetMyPermissions)
+	api.POST("/me/password", DenyImpersonation(), ChangePasswordAPI)
+	api.GET("/me/2fa", GetMyTwoFactorAPI)
+	api.POST("/me/2fa/setup", DenyImpersonation(), SetupMyTwoFactorAPI)
+	api.POST("/me/2fa/confirm", DenyImpersonation(), ConfirmMyTwoFactorAPI)
+	api.POST("/me/2fa/disable", DenyImpersonation(), DisableMyTwoFactorAPI)
+	api.POST("/me/2fa/recovery-codes", DenyImpersonation(), RegenerateMyRecoveryCodesAPI)
+	api.GET("/me/login-history", GetMyLoginHistoryAPI)
+	api.POST("/me/invitations/accept", DenyImpersonation(), AcceptInvitationAPI)
 
 	// 用户管理接口
-	r.GET("/api/users", GetUsers)
-	r.GET("/api/users/:id", GetUser)
-	r.POST("/api/users", CreateUser)
-	r.PUT("/api/users/:id", UpdateUser)
-	r.DELETE("/api/users/:id", DeleteUser)
+	api.GET("/users", RequirePermission("user:read"), GetUsers)
+	api.GET("/users/:id", RequirePermission("user:read"), GetUser)
+	api.POST("/users", RequirePermission("user:write"), CreateUser)
+	api.PUT("/users/:id", RequirePermission("user:write"), UpdateUser)
+	api.DELETE("/users/:id", RequirePermission("user:delete"), DeleteUser)
+	api.GET("/users/:id/login-history", RequirePermission("user:read"), GetUserLoginHistoryAPI)
+	api.POST("/users/:id/unlock", RequirePermission("user:manage"), UnlockUserAPI)
+
+	// 邀请注册与注册模式
+	api.GET("/invitations", RequirePermission("user:write"), GetInvitationsAPI)
+	api.POST("/invitations", RequirePermission("user:write"), CreateInvitationAPI)
+	api.POST("/invitations/:id/resend", RequirePermission("user:write"), ResendInvitationAPI)
+	api.POST("/invitations/:id/revoke", RequirePermission("user:write"), RevokeInvitationAPI)
+	api.GET("/settings/registration", RequirePermission("system:settings"), GetRegistrationSettingsAPI)
+	api.PUT("/settings/registration", RequirePermission("system:settings"), UpdateRegistrationSettingsAPI)
+
+	// 钱包接口
+	api.GET("/users/:id/wallet", RequirePermission("user:read"), GetUserWallet)
+	api.GET("/users/:id/wallet/transactions", RequirePermission("user:read"), GetUserWalletTransactions)
+	api.POST("/users/:id/wallet/credit", DenyImpersonation(), RequirePermission("user:manage"), CreditUserWallet)
 
 	// 服务接口 (支持完整CRUD)
-	r.GET("/api/services", GetServices)         // 兼容旧接口
-	r.GET("/api/services/list", GetServiceList) // 新的数据库接口
-	r.GET("/api/services/:id", GetServiceDetail)
-	r.POST("/api/services", CreateNewService)
-	r.PUT("/api/services/:id", UpdateServiceAPI)
-	r.DELETE("/api/services/:id", DeleteServiceAPI)
+	api.GET("/services", RequirePermission("service:read"), GetServices)         // 兼容旧接口
+	api.GET("/services/list", RequirePermission("service:read"), GetServiceList) // 新的数据库接口
+	api.GET("/services/:id", RequirePermission("service:read"), GetServiceDetail)
+	api.POST("/services", RequirePermission("service:write"), CreateNewService)
+	api.PUT("/services/:id", RequirePermission("service:write"), UpdateServiceAPI)
+	api.DELETE("/services/:id", RequirePermission("service:delete"), DeleteServiceAPI)
+	api.GET("/services/:id/probes", RequirePermission("service:read"), GetServiceProbesAPI)
+
+	// 定价接口
+	api.GET("/services/:id/prices", RequirePermission("service:read"), GetServicePricesAPI)
+	api.POST("/services/:id/prices", RequirePermission("service:write"), CreateServicePriceAPI)
+	api.POST("/pricing/recompute", RequirePermission("system:admin"), RecomputeCostsAPI)
+
+	// 上游渠道接口（包含上游密钥，仅服务管理员可见）
+	api.GET("/services/:id/channels", RequirePermission("service:manage"), GetServiceChannelsAPI)
+	api.POST("/services/:id/channels", RequirePermission("service:manage"), CreateChannelAPI)
+	api.PUT("/channels/:id", RequirePermission("service:manage"), UpdateChannelAPI)
+	api.DELETE("/channels/:id", RequirePermission("service:manage"), DeleteChannelAPI)
 
 	// 工单接口 (支持完整CRUD)
-	r.GET("/api/tickets", GetSupportTickets)  // 兼容旧接口
-	r.GET("/api/tickets/list", GetTicketList) // 新的数据库接口
-	r.GET("/api/tickets/:id", GetTicketDetail)
-	r.POST("/api/tickets", CreateNewTicket)
-	r.PUT("/api/tickets/:id", UpdateTicketStatusAPI)
-	r.DELETE("/api/tickets/:id", DeleteTicketAPI)
-	r.POST("/api/tickets/:id/reply", AddReplyToTicket)
+	api.GET("/tickets", RequirePermission("ticket:read"), GetSupportTickets)  // 兼容旧接口
+	api.GET("/tickets/list", RequirePermission("ticket:read"), GetTicketList) // 新的数据库接口
+	api.GET("/tickets/:id", RequirePermission("ticket:read"), GetTicketDetail)
+	api.POST("/tickets", RequirePermission("ticket:write"), CreateNewTicket)
+	api.PUT("/tickets/:id", RequirePermission("ticket:manage"), UpdateTicketStatusAPI)
+	api.DELETE("/tickets/:id", RequirePermission("ticket:delete"), DeleteTicketAPI)
+	api.POST("/tickets/:id/reply", RequirePermission("ticket:write"), AddReplyToTicket)
 
 	// 公告接口 (支持完整CRUD)
-	r.GET("/api/announcements", GetAnnouncementList)
-	r.GET("/api/announcements/:id", GetAnnouncementDetail)
-	r.POST("/api/announcements", CreateNewAnnouncement)
-	r.PUT("/api/announcements/:id", UpdateAnnouncementAPI)
-	r.DELETE("/api/announcements/:id", DeleteAnnouncementAPI)
+	api.GET("/announcements", RequirePermission("announcement:read"), GetAnnouncementList)
+	api.GET("/announcements/:id", RequirePermission("announcement:read"), GetAnnouncementDetail)
+	api.POST("/announcements", RequirePermission("announcement:write"), CreateNewAnnouncement)
+	api.PUT("/announcements/:id", RequirePermission("announcement:write"), UpdateAnnouncementAPI)
+	api.DELETE("/announcements/:id", RequirePermission("announcement:delete"), DeleteAnnouncementAPI)
 
 	// Token使用接口
-	r.GET("/api/token-usage", GetTokenUsage)            // 兼容旧接口
-	r.GET("/api/token-usage/stats", GetTokenUsageStats) // 新的数据库接口
+	api.GET("/token-usage", RequirePermission("dashboard:view"), GetTokenUsage)            // 兼容旧接口
+	api.GET("/token-usage/stats", RequirePermission("dashboard:view"), GetTokenUsageStats) // 新的数据库接口
+
+	// API 密钥接口（当前登录用户）
+	api.GET("/keys", RequirePermission("apikey:read"), GetMyAPIKeys)
+	api.POST("/keys", DenyImpersonation(), RequirePermission("apikey:write"), CreateMyAPIKey)
+	api.PUT("/keys/:id", DenyImpersonation(), RequirePermission("apikey:write"), UpdateMyAPIKey)
+	api.POST("/keys/:id/revoke", RequirePermission("apikey:write"), RevokeMyAPIKey)
+	api.DELETE("/keys/:id", RequirePermission("apikey:delete"), DeleteMyAPIKey)
+
+	// 组织接口，/api/orgs/:orgId 下的接口处于该组织上下文中
+	api.GET("/orgs", GetMyOrganizationsAPI)
+	api.POST("/orgs", DenyImpersonation(), CreateOrganizationAPI)
+	org := api.Group("/orgs/:orgId")
+	org.GET("", RequirePermission("org:read"), GetOrganizationAPI)
+	org.PUT("", RequirePermission("org:write"), UpdateOrganizationAPI)
+	org.DELETE("", RequirePermission("org:delete"), DeleteOrganizationAPI)
+	org.POST("/leave", RequirePermission("org:read"), LeaveOrganizationAPI)
+	org.GET("/members", RequirePermission("member:read"), GetOrgMembersAPI)
+	org.POST("/members", RequirePermission("member:write"), AddOrgMemberAPI)
+	org.PUT("/members/:userId", RequirePermission("member:write"), UpdateOrgMemberAPI)
+	org.DELETE("/members/:userId", RequirePermission("member:delete"), RemoveOrgMemberAPI)
+	org.GET("/invitations", RequirePermission("member:write"), GetInvitationsAPI)
+	org.POST("/invitations", RequirePermission("member:write"), CreateInvitationAPI)
+	org.POST("/invitations/:id/resend", RequirePermission("member:write"), ResendInvitationAPI)
+	org.POST("/invitations/:id/revoke", RequirePermission("member:write"), RevokeInvitationAPI)
+	org.GET("/keys", RequirePermission("apikey:read"), GetMyAPIKeys)
+	org.POST("/keys", DenyImpersonation(), RequirePermission("apikey:write"), CreateMyAPIKey)
+	org.PUT("/keys/:id", DenyImpersonation(), RequirePermission("apikey:write"), UpdateMyAPIKey)
+	org.POST("/keys/:id/revoke", RequirePermission("apikey:write"), RevokeMyAPIKey)
+	org.DELETE("/keys/:id", RequirePermission("apikey:delete"), DeleteMyAPIKey)
+	org.GET("/wallet", RequirePermission("wallet:read"), GetOrgWalletAPI)
+	org.GET("/wallet/transactions", RequirePermission("wallet:read"), GetOrgWalletTransactionsAPI)
+	org.POST("/wallet/credit", DenyImpersonation(), RequirePermission("user:manage"), CreditOrgWalletAPI)
+	org.GET("/usage", RequirePermission("usage:read"), GetOrgUsageAPI)
+
+	// API 密钥管理接口（管理员）
+	adminKeys := api.Group("/admin/keys", RequirePermission("user:manage"))
+	adminKeys.GET("", RequirePermission("apikey:read"), AdminGetAPIKeys)
+	adminKeys.POST("/:id/revoke", RequirePermission("apikey:write"), AdminRevokeAPIKey)
+
+	// 角色与权限管理接口（系统管理员）
+	admin := api.Group("/admin", RequirePermission("system:admin"))
+	admin.GET("/roles", GetRolesAPI)
+	admin.POST("/roles", CreateRoleAPI)
+	admin.GET("/roles/:id", GetRoleAPI)
+	admin.PUT("/roles/:id", UpdateRoleAPI)
+	admin.PUT("/roles/:id/permissions", UpdateRolePermissionsAPI)
+	admin.PUT("/roles/:id/2fa-policy", SetRoleTwoFactorPolicyAPI)
+	admin.DELETE("/roles/:id", DeleteRoleAPI)
+	admin.GET("/permissions", GetPermissionsAPI)
+	admin.POST("/permissions", CreatePermissionAPI)
+	admin.GET("/users/:id/roles", GetUserRolesAPI)
+	admin.POST("/users/:id/roles", AssignUserRoleAPI)
+	admin.DELETE("/users/:id/roles/:roleId", UnassignUserRoleAPI)
+	admin.GET("/audit-logs", GetAuditLogsAPI)
+	admin.GET("/orgs", AdminGetOrganizationsAPI)
+	admin.PUT("/orgs/:id/status", AdminUpdateOrganizationStatusAPI)
+	admin.POST("/users/:id/impersonate", DenyImpersonation(), StartImpersonationAPI)
+	admin.GET("/impersonations", AdminGetImpersonationsAPI)
+	admin.POST("/impersonations/:id/end", AdminEndImpersonationAPI)
+
+	// OpenAI 兼容网关接口
+	v1 := r.Group("/v1", apiKeyMiddleware())
+	v1.POST("/chat/completions", requireScope(models.ScopeChat), rateLimitMiddleware(), ChatCompletions)
+	v1.GET("/models", requireScope(models.ScopeModels), ListModels)
+	v1.GET("/models/:model", requireScope(models.ScopeModels), RetrieveModel)
 
 	// 404处理
 	r.NoRoute(func(c *gin.Context) {
@@ -0,0 +1,166 @@
+package gins
+
+import (
+	"errors"
+	"net/http"
+
+	"macg/core"
+	"macg/models"
+	"macg/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// 双因素认证 API（当前登录用户）
+// ============================================================================
+
+// TwoFactorCodeRequest 携带验证码的请求，code 可以是 TOTP 验证码或恢复码
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// twoFactorErrorStatus 验证码错误按请求错误处理，其余为服务端错误
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrTwoFactorInvalid), errors.Is(err, models.ErrTwoFactorNotEnabled):
+		return http.StatusBadRequest
+	case errors.Is(err, models.ErrTwoFactorRequired):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// totpIssuer 验证器应用中显示的发行方名称
+func totpIssuer() string {
+	if core.Cfg.Security.TOTPIssuer != "" {
+		return core.Cfg.Security.TOTPIssuer
+	}
+	return "AI Hub"
+}
+
+// GetMyTwoFactorAPI 获取当前用户的双因素认证状态
+func GetMyTwoFactorAPI(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	status, err := models.GetTwoFactorStatus(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    status,
+	})
+}
+
+// SetupMyTwoFactorAPI 生成 TOTP 密钥和 otpauth URI，需调用确认接口后才生效
+func SetupMyTwoFactorAPI(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	secret, err := models.BeginTwoFactorSetup(user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPURI(totpIssuer(), user.Username, secret),
+		},
+	})
+}
+
+// ConfirmMyTwoFactorAPI 校验验证码后启用双因素认证，返回只展示一次的恢复码
+func ConfirmMyTwoFactorAPI(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	codes, err := models.ConfirmTwoFactorSetup(currentUserID(c), req.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "two-factor authentication enabled",
+		Data:    gin.H{"recovery_codes": codes},
+	})
+}
+
+// DisableMyTwoFactorAPI 校验验证码后关闭双因素认证，角色要求启用时不可关闭
+func DisableMyTwoFactorAPI(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	user := c.MustGet("user").(*models.User)
+	if err := models.DisableTwoFactor(user, req.Code); err != nil {
+		status := twoFactorErrorStatus(err)
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "two-factor authentication disabled",
+	})
+}
+
+// RegenerateMyRecoveryCodesAPI 重新生成恢复码，旧恢复码全部失效
+func RegenerateMyRecoveryCodesAPI(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(currentUserID(c), req.Code)
+	if err != nil {
+		status := twoFactorErrorStatus(err)
+		c.JSON(status, models.Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "recovery codes regenerated",
+		Data:    gin.H{"recovery_codes": codes},
+	})
+}
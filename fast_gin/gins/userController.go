@@ -1,47 +1,31 @@
 package gins
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"macg/core"
 	"macg/models"
 	"macg/utils"
 	"macg/utils/ResponeResult"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-func cookieCheck() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 假设Cookie中存储的键为"token"
-		token, err := c.Cookie("token")
-		if err != nil {
-			c.JSON(http.StatusOK, ResponeResult.ErrorResult(gin.H{"error": "unauthorized"}))
-			c.Abort()
-			return
-		}
-
-		// 在这里添加你的验证逻辑，例如验证Token是否有效
-		username, err := utils.GetSub(token) // 假设GetSub是一个验证Token的函数
-		if err != nil || username == "" {
-			c.JSON(http.StatusOK, ResponeResult.ErrorResult(gin.H{"error": "unauthorized"}))
-			c.Abort()
-			return
-		}
-
-		// 将用户名存储在上下文中，供后续处理使用
-		c.Set("username", username)
-
-		c.Next()
-	}
-}
-
 // 登录功能
 func login(c *gin.Context) {
 	// 定义一个结构体来接收JSON数据
 	var loginData struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+		Username          string `json:"username"`
+		Password          string `json:"password"`
+		EncryptedPassword string `json:"encrypted_password"` // 见 LoginPayload
 	}
 
 	// 解析JSON数据
@@ -52,24 +36,155 @@ func login(c *gin.Context) {
 
 	fmt.Println("登录请求:", loginData.Username)
 
+	password, err := resolvePassword(loginData.Password, loginData.EncryptedPassword)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ResponeResult.ErrorResult(err.Error()))
+		return
+	}
+
+	if !checkLoginThrottle(c, loginData.Username) {
+		return
+	}
+
 	// 使用新的 models 包验证用户
-	user, err := models.CheckUserCredentials(loginData.Username, loginData.Password)
+	user, err := models.CheckUserCredentials(loginData.Username, password)
 	if err != nil {
 		fmt.Println("登录失败:", err)
+		switch {
+		case errors.Is(err, models.ErrInvalidCredentials):
+			loginFailed(c, loginData.Username, models.LoginFailInvalidCredentials, true)
+		case errors.Is(err, models.ErrAccountLocked):
+			loginFailed(c, loginData.Username, models.LoginFailAccountLocked, false)
+		case errors.Is(err, models.ErrAccountDisabled):
+			loginFailed(c, loginData.Username, models.LoginFailAccountDisabled, false)
+		case errors.Is(err, models.ErrEmailNotVerified):
+			loginFailed(c, loginData.Username, models.LoginFailEmailNotVerified, false)
+		}
+		c.JSON(http.StatusOK, ResponeResult.OkResult(gin.H{"error": err.Error()}))
+		return
+	}
+
+	// 已启用双因素认证时先返回挑战令牌，验证码通过后再签发登录令牌
+	enabled, err := models.IsTwoFactorEnabled(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ResponeResult.ErrorResult(err.Error()))
+		return
+	}
+	if enabled {
+		challenge, err := utils.CreateTwoFactorChallenge(user.Username, user.TokenVersion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ResponeResult.ErrorResult("签发挑战令牌失败"))
+			return
+		}
+		c.JSON(http.StatusOK, ResponeResult.OkResult(gin.H{
+			"code":                200,
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(utils.TwoFactorChallengeTTL / time.Second),
+		}))
+		return
+	}
+
+	loginSuccess(c, user)
+}
+
+// loginTwoFactor 登录第二步：校验挑战令牌和 TOTP 验证码（或恢复码）
+func loginTwoFactor(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ResponeResult.ErrorResult("无效的请求数据: "+err.Error()))
+		return
+	}
+
+	claims, err := utils.ParseJWT(req.ChallengeToken)
+	if err != nil || claims["typ"] != utils.TokenTypeTwoFactor {
+		c.JSON(http.StatusUnauthorized, ResponeResult.ErrorResult("挑战令牌无效或已过期，请重新登录"))
+		return
+	}
+	username, _ := claims["sub"].(string)
+	user, err := models.GetUserWithRoles(username)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, ResponeResult.ErrorResult("挑战令牌无效或已过期，请重新登录"))
+		return
+	}
+	if version, _ := claims["ver"].(float64); int(version) != user.TokenVersion || user.Status != "active" {
+		c.JSON(http.StatusUnauthorized, ResponeResult.ErrorResult("挑战令牌无效或已过期，请重新登录"))
+		return
+	}
+
+	// 验证码错误同样计入失败次数，防止拿到密码后暴力猜测验证码
+	if !checkLoginThrottle(c, username) {
+		return
+	}
+	if user.IsLocked() {
+		loginFailed(c, username, models.LoginFailAccountLocked, false)
+		c.JSON(http.StatusOK, ResponeResult.OkResult(gin.H{"error": models.ErrAccountLocked.Error()}))
+		return
+	}
+
+	if err := models.VerifyTwoFactor(user.ID, req.Code); err != nil {
+		zap.L().Warn("双因素认证失败", zap.String("username", username), zap.Error(err))
+		loginFailed(c, username, models.LoginFailInvalidTwoFactor, errors.Is(err, models.ErrTwoFactorInvalid))
 		c.JSON(http.StatusOK, ResponeResult.OkResult(gin.H{"error": err.Error()}))
 		return
 	}
 
+	loginSuccess(c, user)
+}
+
+// checkLoginThrottle 账号或 IP 处于退避期时返回 429，调用方应直接返回
+func checkLoginThrottle(c *gin.Context, username string) bool {
+	err := models.CheckLoginAllowed(username, c.ClientIP())
+	if err == nil {
+		return true
+	}
+
+	var throttled *models.LoginThrottledError
+	if errors.As(err, &throttled) {
+		models.RecordLoginHistory(username, c.ClientIP(), c.GetHeader("User-Agent"), false, models.LoginFailThrottled)
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, ResponeResult.ErrorResult(err.Error()))
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, ResponeResult.ErrorResult(err.Error()))
+	return false
+}
+
+// loginFailed 记录失败的登录尝试，countFailure 为 true 时计入退避和锁定
+func loginFailed(c *gin.Context, username, reason string, countFailure bool) {
+	models.RecordLoginHistory(username, c.ClientIP(), c.GetHeader("User-Agent"), false, reason)
+	if countFailure {
+		if err := models.RecordLoginFailure(username, c.ClientIP()); err != nil {
+			zap.L().Error("记录登录失败次数出错", zap.String("username", username), zap.Error(err))
+		}
+	}
+}
+
+// loginSuccess 签发令牌并返回登录结果，user.Roles 需已加载
+func loginSuccess(c *gin.Context, user *models.User) {
+	models.ResetLoginFailures(user.Username)
+	models.RecordLoginHistory(user.Username, c.ClientIP(), c.GetHeader("User-Agent"), true, "")
+
 	// 获取用户角色
 	roleName := "user"
 	if len(user.Roles) > 0 {
 		roleName = user.Roles[0].Name
 	}
 
-	token := utils.CreateJWT(loginData.Username)
+	tokens, err := issueTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ResponeResult.ErrorResult(err.Error()))
+		return
+	}
+
 	c.JSON(http.StatusOK, ResponeResult.OkResult(gin.H{
-		"token": token,
-		"code":  200,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		"code":          200,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -83,10 +198,12 @@ func login(c *gin.Context) {
 // 注册
 func register(c *gin.Context) {
 	var registerData struct {
-		Username string `json:"username" binding:"required"`
-		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=6"`
-		Name     string `json:"name"`
+		Username          string `json:"username" binding:"required"`
+		Email             string `json:"email" binding:"required,email"`
+		Password          string `json:"password"`
+		EncryptedPassword string `json:"encrypted_password"` // 见 LoginPayload
+		Name              string `json:"name"`
+		InviteToken       string `json:"invite_token"` // 凭邀请注册时携带
 	}
 
 	if err := c.ShouldBindJSON(&registerData); err != nil {
@@ -94,21 +211,109 @@ func register(c *gin.Context) {
 		return
 	}
 
-	// 使用新的 models 包创建用户
-	user, err := models.CreateUser(
-		registerData.Username,
-		registerData.Email,
-		registerData.Password,
-		registerData.Name,
-		"user", // 默认角色
-	)
+	// 仅凭邀请注册时必须携带有效邀请，且注册邮箱与受邀邮箱一致
+	mode, err := models.GetRegistrationMode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ResponeResult.ErrorResult(err.Error()))
+		return
+	}
+	if registerData.InviteToken == "" && mode == models.RegistrationInviteOnly {
+		c.JSON(http.StatusForbidden, ResponeResult.ErrorResult(models.ErrInvitationRequired.Error()))
+		return
+	}
+	if registerData.InviteToken != "" {
+		invitation, err := models.GetInvitationByToken(registerData.InviteToken)
+		if err != nil {
+			c.JSON(invitationErrorStatus(err), ResponeResult.ErrorResult(err.Error()))
+			return
+		}
+		if !strings.EqualFold(strings.TrimSpace(registerData.Email), invitation.Email) {
+			c.JSON(http.StatusBadRequest, ResponeResult.ErrorResult(models.ErrInvitationEmailMismatch.Error()))
+			return
+		}
+	}
+
+	password, err := resolvePassword(registerData.Password, registerData.EncryptedPassword)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ResponeResult.ErrorResult(err.Error()))
 		return
 	}
+	if utf8.RuneCountInString(password) < 6 {
+		c.JSON(http.StatusBadRequest, ResponeResult.ErrorResult("密码长度不能少于6位"))
+		return
+	}
+
+	// 凭邀请注册时创建用户和接受邀请在同一事务中完成，邀请失效则注册失败；
+	// 受邀邮箱视为已验证，注册后直接登录
+	var user *models.User
+	invited := registerData.InviteToken != ""
+	if invited {
+		user, _, err = models.RegisterWithInvitation(
+			registerData.InviteToken,
+			registerData.Username,
+			registerData.Email,
+			password,
+			registerData.Name,
+			"user", // 默认角色
+		)
+		if err != nil {
+			zap.L().Warn("凭邀请注册失败", zap.String("username", registerData.Username), zap.Error(err))
+			status := invitationErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				// 用户名或邮箱已存在等注册错误，与普通注册一致
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, ResponeResult.ErrorResult(err.Error()))
+			return
+		}
+	} else {
+		// 使用新的 models 包创建用户
+		user, err = models.CreateUser(
+			registerData.Username,
+			registerData.Email,
+			password,
+			registerData.Name,
+			"user", // 默认角色
+		)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ResponeResult.ErrorResult(err.Error()))
+			return
+		}
+	}
+
+	// 要求验证邮箱时账号保持 inactive，验证后才能登录
+	if !invited && core.Cfg.Security.RequireEmailVerification {
+		if err := models.MarkAwaitingVerification(user); err != nil {
+			c.JSON(http.StatusInternalServerError, ResponeResult.ErrorResult(err.Error()))
+			return
+		}
+	}
+	if !invited {
+		if token, err := models.CreateEmailVerificationToken(user); err != nil {
+			zap.L().Error("生成邮箱验证令牌失败", zap.String("username", user.Username), zap.Error(err))
+		} else {
+			sendVerificationEmail(user, token)
+		}
+	}
+	if !invited && core.Cfg.Security.RequireEmailVerification {
+		c.JSON(http.StatusCreated, ResponeResult.OkResult(gin.H{
+			"message":                     "注册成功，请查收验证邮件完成激活",
+			"email_verification_required": true,
+			"user": gin.H{
+				"id":       user.ID,
+				"username": user.Username,
+				"email":    user.Email,
+			},
+		}))
+		return
+	}
 
 	// 注册成功，返回用户信息和Token
-	token := utils.CreateJWT(user.Username)
+	tokens, err := issueTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ResponeResult.ErrorResult(err.Error()))
+		return
+	}
 
 	// 获取用户角色
 	regRoleName := "user"
@@ -117,8 +322,10 @@ func register(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, ResponeResult.OkResult(gin.H{
-		"message": "用户注册成功",
-		"token":   token,
+		"message":       "用户注册成功",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
@@ -128,3 +335,43 @@ func register(c *gin.Context) {
 		},
 	}))
 }
+
+// GetMyPermissions 获取当前用户的角色和有效权限，供前端控制菜单显示
+func GetMyPermissions(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	permissions, err := models.GetUserEffectivePermissions(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	roles := make([]string, len(user.Roles))
+	for i, role := range user.Roles {
+		roles[i] = role.Name
+	}
+
+	data := gin.H{
+		"user_id":     user.ID,
+		"username":    user.Username,
+		"roles":       roles,
+		"permissions": permissions,
+	}
+	// 模拟登录时告知前端显示提示条
+	if session := currentImpersonation(c); session != nil {
+		data["impersonation"] = gin.H{
+			"session_id": session.ID,
+			"admin":      currentImpersonator(c).Username,
+			"expires_at": session.ExpiresAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    data,
+	})
+}
@@ -0,0 +1,154 @@
+package gins
+
+import (
+	"net/http"
+	"strconv"
+
+	"macg/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 钱包 API
+// ============================================================================
+
+// CreditWalletRequest 充值请求
+type CreditWalletRequest struct {
+	Amount      float64 `json:"amount" binding:"required,gt=0"`
+	Description string  `json:"description"`
+}
+
+// walletResponse 钱包信息，附带可用余额
+func walletResponse(wallet *models.Wallet) gin.H {
+	return gin.H{
+		"wallet":    wallet,
+		"available": wallet.Available(),
+	}
+}
+
+// respondWallet 返回指定所有者的钱包
+func respondWallet(c *gin.Context, ownerType string, ownerID uuid.UUID) {
+	wallet, err := models.GetOrCreateWallet(ownerType, ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data:    walletResponse(wallet),
+	})
+}
+
+// respondWalletTransactions 分页返回指定所有者的钱包流水
+func respondWalletTransactions(c *gin.Context, ownerType string, ownerID uuid.UUID) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	wallet, err := models.GetOrCreateWallet(ownerType, ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	transactions, total, err := models.GetWalletTransactions(wallet.ID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "success",
+		Data: gin.H{
+			"transactions": transactions,
+			"total":        total,
+		},
+	})
+}
+
+// creditWallet 为指定所有者的钱包充值，成功时返回充值后的钱包
+func creditWallet(c *gin.Context, ownerType string, ownerID uuid.UUID) *models.Wallet {
+	var req CreditWalletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid request: " + err.Error(),
+		})
+		return nil
+	}
+	if req.Description == "" {
+		req.Description = "管理员充值"
+	}
+
+	operatorID := currentUserID(c)
+	wallet, err := models.CreditWallet(ownerType, ownerID, req.Amount, req.Description, &operatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return nil
+	}
+
+	c.JSON(http.StatusOK, models.Response{
+		Code:    200,
+		Message: "wallet credited successfully",
+		Data:    walletResponse(wallet),
+	})
+	return wallet
+}
+
+// GetUserWallet 获取用户钱包
+func GetUserWallet(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	respondWallet(c, models.WalletOwnerUser, userID)
+}
+
+// GetUserWalletTransactions 获取用户钱包流水
+func GetUserWalletTransactions(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	respondWalletTransactions(c, models.WalletOwnerUser, userID)
+}
+
+// CreditUserWallet 为用户钱包充值
+func CreditUserWallet(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.Response{
+			Code:    400,
+			Message: "invalid user id",
+		})
+		return
+	}
+
+	creditWallet(c, models.WalletOwnerUser, userID)
+}
@@ -1,10 +1,16 @@
 package global
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
+	"log"
 	"macg/core"
+	"macg/utils"
 	"macg/utils/rsautils"
+	"os"
 	"strings"
+	"time"
 )
 
 var RsaObj rsautils.RsaObj
@@ -17,7 +23,9 @@ var AppConfig *AppConfigType
 
 // AppConfigType 应用配置类型
 type AppConfigType struct {
-	Database core.DatabaseConfig
+	Database  core.DatabaseConfig
+	SecretKey []byte // 由配置的服务端密钥派生的32字节密钥
+	JWTSecret []byte // JWT 签名密钥
 }
 
 func init() {
@@ -27,11 +35,104 @@ func init() {
 	}
 }
 
+// placeholderSecretKey 旧版示例配置中的占位密钥，视同未配置
+const placeholderSecretKey = "change-me-in-production"
+
 // InitGlobalConfig 初始化全局配置
 func InitGlobalConfig() {
+	// 环境变量 SECRET_KEY 优先于配置文件
+	if secretKey := os.Getenv("SECRET_KEY"); secretKey != "" {
+		core.Cfg.Security.SecretKey = secretKey
+	}
+	// 服务端密钥用于 API Key、刷新令牌的哈希和渠道凭据、TOTP 密钥的加密，
+	// 未配置时派生出的密钥人人可算，单独配置 JWT 密钥也不能代替，拒绝启动
+	if !secretKeyConfigured() {
+		log.Fatalf("未配置服务端密钥：请设置 security.secret_key 或环境变量 SECRET_KEY（不能使用示例值 %q）", placeholderSecretKey)
+	}
+
+	secret := sha256.Sum256([]byte(core.Cfg.Security.SecretKey))
 	AppConfig = &AppConfigType{
-		Database: core.Cfg.Database,
+		Database:  core.Cfg.Database,
+		SecretKey: secret[:],
+		JWTSecret: jwtSecret(secret[:]),
+	}
+
+	utils.SetJWTSecret(AppConfig.JWTSecret, time.Duration(core.Cfg.Security.AccessTokenTTL)*time.Second)
+
+	if strings.EqualFold(core.Cfg.Security.JWTAlgorithm, "RS256") {
+		if err := loadJWTKeys(); err != nil {
+			log.Fatalf("加载 JWT 密钥失败: %v", err)
+		}
+	}
+
+	if err := loadLoginKey(); err != nil {
+		log.Fatalf("加载登录加密密钥失败: %v", err)
+	}
+}
+
+// loadLoginKey 加载用于解密登录载荷的 RSA 私钥，未配置时随机生成
+func loadLoginKey() error {
+	if core.Cfg.Security.LoginKeyFile == "" {
+		RsaObj = rsautils.NewRsaObj()
+		return nil
+	}
+
+	data, err := os.ReadFile(core.Cfg.Security.LoginKeyFile)
+	if err != nil {
+		return err
+	}
+	if _, err := rsautils.ParsePrivateKeyFromPEM(string(data)); err != nil {
+		return fmt.Errorf("%s: %w", core.Cfg.Security.LoginKeyFile, err)
+	}
+	RsaObj = rsautils.NewRsaObjFromPEM(string(data))
+	return nil
+}
+
+// loadJWTKeys 从 PEM 文件加载 RS256 密钥集
+func loadJWTKeys() error {
+	keys := make([]utils.JWTKey, 0, len(core.Cfg.Security.JWTKeys))
+	for _, cfg := range core.Cfg.Security.JWTKeys {
+		key := utils.JWTKey{Kid: cfg.Kid}
+		if cfg.PrivateKeyFile != "" {
+			data, err := os.ReadFile(cfg.PrivateKeyFile)
+			if err != nil {
+				return err
+			}
+			if key.Private, err = rsautils.ParsePrivateKeyFromPEM(string(data)); err != nil {
+				return fmt.Errorf("%s: %w", cfg.PrivateKeyFile, err)
+			}
+		}
+		if cfg.PublicKeyFile != "" {
+			data, err := os.ReadFile(cfg.PublicKeyFile)
+			if err != nil {
+				return err
+			}
+			if key.Public, err = rsautils.ParsePublicKeyFromPEM(string(data)); err != nil {
+				return fmt.Errorf("%s: %w", cfg.PublicKeyFile, err)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return utils.SetRSAKeys(keys, core.Cfg.Security.JWTSigningKid)
+}
+
+// secretKeyConfigured 服务端密钥已配置且不是示例占位值
+func secretKeyConfigured() bool {
+	key := strings.TrimSpace(core.Cfg.Security.SecretKey)
+	return key != "" && key != placeholderSecretKey
+}
+
+// jwtSecret 依次读取环境变量 JWT_SECRET、配置项 jwt_secret，都为空时由服务端密钥派生
+func jwtSecret(secretKey []byte) []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	if core.Cfg.Security.JWTSecret != "" {
+		return []byte(core.Cfg.Security.JWTSecret)
 	}
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write([]byte("jwt"))
+	return mac.Sum(nil)
 }
 
 func Base65Encode(data []byte) string {
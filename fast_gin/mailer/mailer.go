@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+
+	"macg/core"
+
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// 邮件发送
+// 业务代码只依赖 Sender 接口，按配置选择 SMTP、文件或内存实现
+// ============================================================================
+
+// Message 一封邮件，HTML 为空时只发送纯文本
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender 邮件发送器
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var defaultSender Sender = NewMemorySender()
+
+// Init 按配置初始化邮件发送器
+func Init() {
+	cfg := core.Cfg.Mail
+	switch cfg.Driver {
+	case "smtp":
+		defaultSender = NewSMTPSender(cfg.SMTP, cfg.From)
+	case "file":
+		defaultSender = NewFileSender(cfg.Dir, cfg.From)
+	default:
+		defaultSender = NewMemorySender()
+	}
+	zap.L().Info("邮件发送器初始化完成", zap.String("driver", cfg.Driver))
+}
+
+// Default 返回全局邮件发送器
+func Default() Sender {
+	return defaultSender
+}
+
+// SetDefault 替换全局邮件发送器，用于测试
+func SetDefault(sender Sender) {
+	defaultSender = sender
+}
+
+// Send 使用全局邮件发送器发送邮件
+func Send(ctx context.Context, msg Message) error {
+	return defaultSender.Send(ctx, msg)
+}
+
+// build 生成 RFC 5322 格式的邮件内容，有 HTML 时使用 multipart/alternative
+func build(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.BEncoding.Encode("UTF-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+randomID()+"@"+domainOf(from)+">")
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, msg.Text)
+		return buf.Bytes()
+	}
+
+	boundary := "=_" + randomID()
+	header("Content-Type", `multipart/alternative; boundary="`+boundary+`"`)
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	} {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		header("Content-Type", part.contentType+"; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		writeQuotedPrintable(&buf, part.body)
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes()
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, body string) {
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(body))
+	w.Close()
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// domainOf 取发件地址的域名，用于生成 Message-ID
+func domainOf(address string) string {
+	address = strings.TrimSuffix(address, ">")
+	if i := strings.LastIndex(address, "@"); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FileSender 将邮件以 .eml 文件写入目录，用于本地开发时查看邮件内容
+type FileSender struct {
+	dir  string
+	from string
+}
+
+// NewFileSender 创建文件发送器，dir 为空时写入 mail 目录
+func NewFileSender(dir, from string) *FileSender {
+	if dir == "" {
+		dir = "mail"
+	}
+	return &FileSender{dir: dir, from: from}
+}
+
+// Send 实现 Sender
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return errors.New("创建邮件目录失败：" + err.Error())
+	}
+	name := time.Now().Format("20060102-150405") + "-" + randomID() + ".eml"
+	if err := os.WriteFile(filepath.Join(s.dir, name), build(s.from, msg), 0o600); err != nil {
+		return errors.New("写入邮件失败：" + err.Error())
+	}
+	zap.L().Info("邮件已写入文件", zap.String("to", msg.To), zap.String("file", name))
+	return nil
+}
+
+// MemorySender 将邮件保存在内存中，用于测试或未配置邮件服务的环境
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemorySender 创建内存发送器
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+// Send 实现 Sender
+func (s *MemorySender) Send(ctx context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	zap.L().Info("邮件未实际发送（内存模式）", zap.String("to", msg.To), zap.String("subject", msg.Subject))
+	return nil
+}
+
+// Messages 返回已发送邮件的副本
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset 清空已发送邮件
+func (s *MemorySender) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
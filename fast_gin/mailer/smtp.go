@@ -0,0 +1,102 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"macg/core"
+)
+
+// SMTPSender 通过 SMTP 发送邮件
+// 配置 TLS 时直接建立 TLS 连接（通常为 465 端口），否则在服务器支持时使用 STARTTLS
+type SMTPSender struct {
+	cfg  core.SMTPConfig
+	from string
+}
+
+// NewSMTPSender 创建 SMTP 发送器
+func NewSMTPSender(cfg core.SMTPConfig, from string) *SMTPSender {
+	return &SMTPSender{cfg: cfg, from: from}
+}
+
+// Send 实现 Sender
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	fromAddr, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return errors.New("发件地址无效：" + err.Error())
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return errors.New("收件地址无效：" + err.Error())
+	}
+
+	client, err := s.dial(ctx)
+	if err != nil {
+		return errors.New("连接 SMTP 服务器失败：" + err.Error())
+	}
+	defer client.Close()
+
+	if !s.cfg.TLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+				return errors.New("STARTTLS 失败：" + err.Error())
+			}
+		}
+	}
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return errors.New("SMTP 认证失败：" + err.Error())
+		}
+	}
+
+	if err := client.Mail(fromAddr.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(toAddr.Address); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(build(s.from, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (s *SMTPSender) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.cfg.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"macg/core"
 	"macg/database"
 	"macg/flags"
 	"macg/gins"
 	"macg/global"
+	"macg/mailer"
 	"macg/models"
+	"macg/ratelimit"
+	"macg/relay"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -86,17 +95,48 @@ func main() {
 		&models.Role{},
 		&models.Permission{},
 		&models.User{},
+		&models.AuditLog{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.UserTwoFactor{},
+		&models.RecoveryCode{},
+		&models.LoginFailureCounter{},
+		&models.LoginHistory{},
+		&models.UsedLoginNonce{},
+		&models.EmailToken{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.Invitation{},
+		&models.SystemSetting{},
+		&models.ImpersonationSession{},
 		// 业务模型
 		&models.ServiceModel{},
+		&models.ServicePrice{},
+		&models.PriceTier{},
 		&models.SupportTicket{},
 		&models.TicketReply{},
 		&models.Announcement{},
 		&models.TokenUsageRecord{},
 		&models.APIKey{},
+		&models.Wallet{},
+		&models.WalletTransaction{},
+		&models.WalletHold{},
+		// 网关模型
+		&models.Channel{},
+		&models.RelayAttempt{},
+		&models.ServiceProbe{},
+		&models.RateLimitBucket{},
 	); err != nil {
 		zap.L().Fatal("数据库迁移失败", zap.Error(err))
 	}
 
+	// 迁移旧版 API 密钥哈希
+	if err := models.MigrateAPIKeyHashes(); err != nil {
+		zap.L().Fatal("API密钥哈希迁移失败", zap.Error(err))
+	}
+
 	// 初始化 RBAC 权限系统（必须在用户之前）
 	models.InitDefaultRBAC()
 
@@ -109,6 +149,25 @@ func main() {
 	models.InitDefaultAnnouncements()
 	models.InitDefaultTokenUsage()
 
+	// 初始化网关限流
+	ratelimit.Init()
+
+	// 初始化邮件发送
+	mailer.Init()
+
+	// 后台任务的上下文，服务器关闭后取消
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// 定期清理过期的刷新令牌和吊销记录
+	models.StartTokenJanitor(bgCtx)
+
+	// 批量写回 API 密钥最近使用时间
+	usageFlushed := models.StartAPIKeyUsageFlusher(bgCtx)
+
+	// 启动上游健康探测
+	relay.StartProber(bgCtx)
+
 	// 打印测试账号信息
 	PrintTestAccounts()
 
@@ -116,10 +175,28 @@ func main() {
 	gins.RouterInit(r)
 	serAddr := core.Cfg.Server.Host + ":" + core.Cfg.Server.Port
 
-	zap.L().Info("服务器启动", zap.String("address", serAddr))
-	if err := r.Run(serAddr); err != nil {
-		zap.L().Fatal("服务器启动失败", zap.Error(err))
+	srv := &http.Server{Addr: serAddr, Handler: r}
+	go func() {
+		zap.L().Info("服务器启动", zap.String("address", serAddr))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Fatal("服务器启动失败", zap.Error(err))
+		}
+	}()
+
+	// 收到退出信号后等待处理中的请求完成，再停止后台任务并写回剩余的密钥使用时间
+	quit, stopSignal := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignal()
+	<-quit.Done()
+
+	zap.L().Info("服务器关闭中")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		zap.L().Error("服务器关闭失败", zap.Error(err))
 	}
+	stopBackground()
+	<-usageFlushed
+	zap.L().Info("服务器已关闭")
 }
 
 // PrintTestAccounts 打印测试账号信息
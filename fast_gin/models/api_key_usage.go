@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// API Key 最近使用时间
+// 每次请求只在内存中记录，由后台任务定期批量写回，避免每个请求都写数据库
+// ============================================================================
+
+// apiKeyUsageFlushInterval 批量写回间隔
+const apiKeyUsageFlushInterval = 30 * time.Second
+
+var (
+	apiKeyUsageMu      sync.Mutex
+	apiKeyUsagePending = make(map[uuid.UUID]time.Time)
+)
+
+// TouchAPIKey 记录密钥的最近使用时间，等待下一次批量写回
+func TouchAPIKey(id uuid.UUID) {
+	apiKeyUsageMu.Lock()
+	apiKeyUsagePending[id] = time.Now()
+	apiKeyUsageMu.Unlock()
+}
+
+// FlushAPIKeyUsage 将待写回的最近使用时间写入数据库
+func FlushAPIKeyUsage() error {
+	apiKeyUsageMu.Lock()
+	pending := apiKeyUsagePending
+	apiKeyUsagePending = make(map[uuid.UUID]time.Time)
+	apiKeyUsageMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// 按时间分组，同一秒内使用的密钥合并为一条 UPDATE
+	groups := make(map[time.Time][]uuid.UUID)
+	for id, at := range pending {
+		at = at.Truncate(time.Second)
+		groups[at] = append(groups[at], id)
+	}
+
+	db := database.GetDB()
+	for at, ids := range groups {
+		if err := db.Model(&APIKey{}).
+			Where("id IN ? AND (last_used_at IS NULL OR last_used_at < ?)", ids, at).
+			UpdateColumn("last_used_at", at).Error; err != nil {
+			// 未写回的记录放回队列，等待下一次写回
+			requeueAPIKeyUsage(groups)
+			return errors.New("更新API密钥使用时间失败：" + err.Error())
+		}
+		delete(groups, at)
+	}
+	return nil
+}
+
+// requeueAPIKeyUsage 将写回失败的记录放回队列，期间有更新的使用时间时保留较新的
+func requeueAPIKeyUsage(groups map[time.Time][]uuid.UUID) {
+	apiKeyUsageMu.Lock()
+	defer apiKeyUsageMu.Unlock()
+
+	for at, ids := range groups {
+		for _, id := range ids {
+			if current, ok := apiKeyUsagePending[id]; !ok || current.Before(at) {
+				apiKeyUsagePending[id] = at
+			}
+		}
+	}
+}
+
+// StartAPIKeyUsageFlusher 启动后台批量写回，ctx 取消时写回剩余记录后退出，
+// 返回的通道在最后一次写回完成后关闭
+func StartAPIKeyUsageFlusher(ctx context.Context) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(apiKeyUsageFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				if err := FlushAPIKeyUsage(); err != nil {
+					zap.L().Warn("写回API密钥使用时间失败", zap.Error(err))
+				}
+				return
+			case <-ticker.C:
+				if err := FlushAPIKeyUsage(); err != nil {
+					zap.L().Warn("写回API密钥使用时间失败", zap.Error(err))
+				}
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 审计日志
+// ============================================================================
+
+// 审计操作类型
+const (
+	AuditRoleCreate            = "role.create"
+	AuditRoleUpdate            = "role.update"
+	AuditRoleDelete            = "role.delete"
+	AuditRolePermissionsUpdate = "role.permissions.update"
+	AuditRoleTwoFactorPolicy   = "role.2fa_policy.update"
+	AuditPermissionCreate      = "permission.create"
+	AuditUserRoleAssign        = "user.role.assign"
+	AuditUserRoleUnassign      = "user.role.unassign"
+	AuditUserUnlock            = "user.unlock"
+	AuditOrgCreate             = "org.create"
+	AuditOrgUpdate             = "org.update"
+	AuditOrgDelete             = "org.delete"
+	AuditOrgStatusUpdate       = "org.status.update"
+	AuditOrgMemberAdd          = "org.member.add"
+	AuditOrgMemberUpdate       = "org.member.update"
+	AuditOrgMemberRemove       = "org.member.remove"
+	AuditOrgWalletCredit       = "org.wallet.credit"
+	AuditInvitationCreate      = "invitation.create"
+	AuditInvitationResend      = "invitation.resend"
+	AuditInvitationRevoke      = "invitation.revoke"
+	AuditSettingUpdate         = "setting.update"
+	AuditImpersonationStart    = "impersonation.start"
+	AuditImpersonationStop     = "impersonation.stop"
+	AuditImpersonationRequest  = "impersonation.request"
+)
+
+// AuditLog 审计日志
+type AuditLog struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index" json:"actor_id"`      // 操作人，系统操作为空
+	Action     string     `gorm:"size:50;index;not null" json:"action"` // 例如 role.create
+	TargetType string     `gorm:"size:50;index" json:"target_type"`     // role, permission, user
+	TargetID   string     `gorm:"size:100;index" json:"target_id"`
+	Detail     string     `gorm:"type:text" json:"detail"` // JSON 格式的变更内容
+	IP         string     `gorm:"size:50" json:"ip"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+func (a *AuditLog) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// RecordAuditLog 记录审计日志，detail 序列化为 JSON 保存
+// 审计失败只记录错误日志，不影响业务操作
+func RecordAuditLog(actorID *uuid.UUID, action, targetType, targetID string, detail interface{}, ip string) {
+	db := database.GetDB()
+
+	log := AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         ip,
+	}
+	if detail != nil {
+		data, err := json.Marshal(detail)
+		if err != nil {
+			zap.L().Error("序列化审计内容失败", zap.String("action", action), zap.Error(err))
+		}
+		log.Detail = string(data)
+	}
+
+	if err := db.Create(&log).Error; err != nil {
+		zap.L().Error("记录审计日志失败", zap.String("action", action), zap.Error(err))
+	}
+}
+
+// GetAuditLogs 分页获取审计日志，可按操作类型和目标过滤
+func GetAuditLogs(action, targetType, targetID string, page, pageSize int) ([]AuditLog, int64, error) {
+	db := database.GetDB()
+	var logs []AuditLog
+	var total int64
+
+	query := db.Model(&AuditLog{})
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("获取记录数失败：" + err.Error())
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).
+		Order("created_at DESC").
+		Find(&logs).Error; err != nil {
+		return nil, 0, errors.New("查询审计日志失败：" + err.Error())
+	}
+
+	return logs, total, nil
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"macg/core"
+	"macg/database"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// 刷新令牌与访问令牌吊销
+// 访问令牌短期有效；刷新令牌只保存哈希，每次使用后轮换。
+// 已轮换的刷新令牌再次出现视为泄露，整个令牌族随即吊销
+// ============================================================================
+
+var (
+	ErrRefreshTokenInvalid = errors.New("刷新令牌无效")
+	ErrRefreshTokenExpired = errors.New("刷新令牌已过期")
+	ErrRefreshTokenReused  = errors.New("刷新令牌已被使用，请重新登录")
+)
+
+// RefreshToken 刷新令牌
+type RefreshToken struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	FamilyID   uuid.UUID  `gorm:"type:uuid;index;not null" json:"family_id"` // 同一次登录轮换出的令牌属于同一族
+	TokenHash  string     `gorm:"size:100;uniqueIndex;not null" json:"-"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *uuid.UUID `gorm:"type:uuid" json:"replaced_by"`
+	IP         string     `gorm:"size:50" json:"ip"`
+	UserAgent  string     `gorm:"size:500" json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// RevokedToken 已吊销的访问令牌，按 jti 记录，过期后可清理
+type RevokedToken struct {
+	JTI       string    `gorm:"size:64;primaryKey" json:"jti"`
+	UserID    uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
+
+// refreshTokenTTL 刷新令牌有效期
+func refreshTokenTTL() time.Duration {
+	if ttl := core.Cfg.Security.RefreshTokenTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return 30 * 24 * time.Hour
+}
+
+// newRefreshToken 生成刷新令牌，返回明文和待保存的记录
+func newRefreshToken(userID, familyID uuid.UUID, ip, userAgent string) (string, *RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, errors.New("生成刷新令牌失败")
+	}
+	raw := hex.EncodeToString(buf)
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+	return raw, &RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: keyedHash(raw),
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+		IP:        ip,
+		UserAgent: userAgent,
+	}, nil
+}
+
+// CreateRefreshToken 登录时为用户创建新的刷新令牌族，明文只返回一次
+func CreateRefreshToken(userID uuid.UUID, ip, userAgent string) (string, error) {
+	db := database.GetDB()
+
+	raw, token, err := newRefreshToken(userID, uuid.New(), ip, userAgent)
+	if err != nil {
+		return "", err
+	}
+	if err := db.Create(token).Error; err != nil {
+		return "", errors.New("保存刷新令牌失败：" + err.Error())
+	}
+	return raw, nil
+}
+
+// RotateRefreshToken 使用刷新令牌换取新的刷新令牌，旧令牌立即失效
+// 返回令牌所属用户和新令牌明文
+func RotateRefreshToken(raw, ip, userAgent string) (*User, string, error) {
+	var userID uuid.UUID
+	var newRaw string
+	var reused bool
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var current RefreshToken
+		if err := database.ForUpdate(tx).Where("token_hash = ?", keyedHash(raw)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenInvalid
+			}
+			return err
+		}
+
+		if current.RevokedAt != nil {
+			// 已轮换的令牌被再次使用，吊销整个令牌族
+			reused = true
+			now := time.Now()
+			if err := tx.Model(&RefreshToken{}).
+				Where("family_id = ? AND revoked_at IS NULL", current.FamilyID).
+				Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+			userID = current.UserID
+			return nil
+		}
+		if current.ExpiresAt.Before(time.Now()) {
+			return ErrRefreshTokenExpired
+		}
+
+		var next *RefreshToken
+		var err error
+		newRaw, next, err = newRefreshToken(current.UserID, current.FamilyID, ip, userAgent)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(next).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&current).Updates(map[string]interface{}{
+			"revoked_at":  now,
+			"replaced_by": next.ID,
+		}).Error; err != nil {
+			return err
+		}
+
+		userID = current.UserID
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenInvalid) || errors.Is(err, ErrRefreshTokenExpired) {
+			return nil, "", err
+		}
+		return nil, "", errors.New("刷新令牌失败：" + err.Error())
+	}
+	if reused {
+		zap.L().Warn("检测到刷新令牌重复使用，已吊销令牌族", zap.String("user_id", userID.String()))
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, newRaw, nil
+}
+
+// RevokeRefreshToken 吊销刷新令牌所在的令牌族（退出当前设备）
+func RevokeRefreshToken(raw string) error {
+	db := database.GetDB()
+
+	var token RefreshToken
+	if err := db.Where("token_hash = ?", keyedHash(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRefreshTokenInvalid
+		}
+		return errors.New("查询刷新令牌失败：" + err.Error())
+	}
+
+	if err := db.Model(&RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", token.FamilyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return errors.New("吊销刷新令牌失败：" + err.Error())
+	}
+	return nil
+}
+
+// RevokeAccessToken 将访问令牌的 jti 加入吊销列表，直到其自然过期
+func RevokeAccessToken(jti string, userID uuid.UUID, expiresAt time.Time) error {
+	db := database.GetDB()
+
+	revoked := RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+		return errors.New("吊销访问令牌失败：" + err.Error())
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked 判断访问令牌是否已被吊销
+func IsAccessTokenRevoked(jti string) (bool, error) {
+	db := database.GetDB()
+
+	var count int64
+	if err := db.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, errors.New("查询令牌吊销状态失败：" + err.Error())
+	}
+	return count > 0, nil
+}
+
+// RevokeAllUserTokens 退出所有设备：递增令牌版本使已签发的访问令牌失效，并吊销全部刷新令牌
+func RevokeAllUserTokens(userID uuid.UUID) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return errors.New("吊销用户令牌失败：" + err.Error())
+	}
+	return nil
+}
+
+// PruneExpiredTokens 清理已过期的刷新令牌和吊销记录
+func PruneExpiredTokens() error {
+	db := database.GetDB()
+	now := time.Now()
+
+	if err := db.Where("expires_at < ?", now).Delete(&RefreshToken{}).Error; err != nil {
+		return errors.New("清理刷新令牌失败：" + err.Error())
+	}
+	if err := db.Where("expires_at < ?", now).Delete(&RevokedToken{}).Error; err != nil {
+		return errors.New("清理吊销记录失败：" + err.Error())
+	}
+	if err := db.Where("expires_at < ?", now).Delete(&EmailToken{}).Error; err != nil {
+		return errors.New("清理邮件令牌失败：" + err.Error())
+	}
+	if err := db.Where("expires_at < ?", now).Delete(&OIDCLoginState{}).Error; err != nil {
+		return errors.New("清理 OIDC 登录状态失败：" + err.Error())
+	}
+	return nil
+}
+
+// StartTokenJanitor 启动后台任务，每小时清理一次过期令牌和登录记录
+func StartTokenJanitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if err := PruneExpiredTokens(); err != nil {
+				zap.L().Warn("清理过期令牌失败", zap.Error(err))
+			}
+			if err := PruneLoginRecords(); err != nil {
+				zap.L().Warn("清理登录记录失败", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
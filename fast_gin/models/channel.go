@@ -0,0 +1,191 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"macg/database"
+	"macg/global"
+	"macg/utils/aesutils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 上游渠道模型
+// ============================================================================
+
+// Channel 上游渠道，同一服务可配置多个渠道，按优先级和权重分配流量
+type Channel struct {
+	ID        uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServiceID uuid.UUID      `gorm:"type:uuid;index;not null" json:"service_id"`
+	Name      string         `gorm:"size:100;not null" json:"name"`
+	BaseURL   string         `gorm:"size:500" json:"base_url"`        // 为空时使用厂商官方地址
+	APIKey    string         `gorm:"size:1000" json:"-"`              // 上游密钥（加密存储）
+	Weight    int            `gorm:"default:1" json:"weight"`         // 同优先级内的流量权重
+	Priority  int            `gorm:"default:0;index" json:"priority"` // 数值越大越优先
+	Enabled   bool           `gorm:"default:true" json:"enabled"`     // 是否启用
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// 关联
+	Service ServiceModel `gorm:"foreignKey:ServiceID" json:"-"`
+}
+
+func (Channel) TableName() string {
+	return "channels"
+}
+
+func (ch *Channel) BeforeCreate(tx *gorm.DB) error {
+	if ch.ID == uuid.Nil {
+		ch.ID = uuid.New()
+	}
+	return nil
+}
+
+// DecryptAPIKey 解密上游密钥
+func (ch *Channel) DecryptAPIKey() (string, error) {
+	if ch.APIKey == "" {
+		return "", nil
+	}
+	key, err := aesutils.DecryptWithKey(ch.APIKey, global.AppConfig.SecretKey)
+	if err != nil {
+		return "", errors.New("解密渠道密钥失败：" + err.Error())
+	}
+	return key, nil
+}
+
+// encryptChannelKey 加密上游密钥
+func encryptChannelKey(apiKey string) (string, error) {
+	if apiKey == "" {
+		return "", nil
+	}
+	encrypted, err := aesutils.EncryptWithKey(apiKey, global.AppConfig.SecretKey)
+	if err != nil {
+		return "", errors.New("加密渠道密钥失败：" + err.Error())
+	}
+	return encrypted, nil
+}
+
+// ============================================================================
+// 渠道 CRUD 操作
+// ============================================================================
+
+// CreateChannel 创建渠道
+func CreateChannel(serviceID uuid.UUID, name, baseURL, apiKey string, weight, priority int, enabled bool) (*Channel, error) {
+	db := database.GetDB()
+
+	if _, err := GetServiceByID(serviceID); err != nil {
+		return nil, err
+	}
+
+	encrypted, err := encryptChannelKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if weight <= 0 {
+		weight = 1
+	}
+
+	channel := Channel{
+		ServiceID: serviceID,
+		Name:      name,
+		BaseURL:   baseURL,
+		APIKey:    encrypted,
+		Weight:    weight,
+		Priority:  priority,
+		Enabled:   enabled,
+	}
+
+	if err := db.Create(&channel).Error; err != nil {
+		return nil, errors.New("创建渠道失败：" + err.Error())
+	}
+	// Enabled 为 false 时 GORM 会使用数据库默认值，需显式写入
+	if !enabled {
+		db.Model(&channel).Update("enabled", false)
+	}
+
+	return &channel, nil
+}
+
+// GetServiceChannels 获取服务下的所有渠道
+func GetServiceChannels(serviceID uuid.UUID) ([]Channel, error) {
+	db := database.GetDB()
+	var channels []Channel
+	if err := db.Where("service_id = ?", serviceID).Order("priority DESC, created_at ASC").Find(&channels).Error; err != nil {
+		return nil, errors.New("查询渠道列表失败：" + err.Error())
+	}
+	return channels, nil
+}
+
+// GetEnabledChannels 获取服务下已启用的渠道
+func GetEnabledChannels(serviceID uuid.UUID) ([]Channel, error) {
+	db := database.GetDB()
+	var channels []Channel
+	if err := db.Where("service_id = ? AND enabled = ?", serviceID, true).Order("priority DESC").Find(&channels).Error; err != nil {
+		return nil, errors.New("查询渠道列表失败：" + err.Error())
+	}
+	return channels, nil
+}
+
+// GetChannelByID 根据ID获取渠道
+func GetChannelByID(id uuid.UUID) (*Channel, error) {
+	db := database.GetDB()
+	var channel Channel
+	if err := db.First(&channel, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("渠道不存在")
+		}
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// UpdateChannel 更新渠道
+func UpdateChannel(id uuid.UUID, updates map[string]interface{}) (*Channel, error) {
+	db := database.GetDB()
+
+	channel, err := GetChannelByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 只允许更新以下字段，密钥需重新加密
+	allowed := map[string]bool{"name": true, "base_url": true, "api_key": true, "weight": true, "priority": true, "enabled": true}
+	for k := range updates {
+		if !allowed[k] {
+			delete(updates, k)
+		}
+	}
+	if apiKey, ok := updates["api_key"].(string); ok {
+		encrypted, err := encryptChannelKey(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		updates["api_key"] = encrypted
+	}
+
+	if err := db.Model(channel).Updates(updates).Error; err != nil {
+		return nil, errors.New("更新渠道失败：" + err.Error())
+	}
+
+	return channel, nil
+}
+
+// DeleteChannel 删除渠道（软删除）
+func DeleteChannel(id uuid.UUID) error {
+	db := database.GetDB()
+
+	result := db.Delete(&Channel{}, id)
+	if result.Error != nil {
+		return errors.New("删除渠道失败：" + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("渠道不存在")
+	}
+
+	return nil
+}
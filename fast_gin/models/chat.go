@@ -0,0 +1,276 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// ============================================================================
+// OpenAI 兼容的对话补全数据结构（网关内部统一格式）
+// ============================================================================
+
+// ChatMessage 对话消息
+type ChatMessage struct {
+	Role       string      `json:"role"`                   // system, user, assistant, tool
+	Content    interface{} `json:"content"`                // 字符串或内容片段数组
+	Name       string      `json:"name,omitempty"`         // 可选的发送者名称
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`   // 助手发起的工具调用
+	ToolCallID string      `json:"tool_call_id,omitempty"` // 工具结果对应的调用ID
+}
+
+// TextContent 提取消息中的纯文本内容
+func (m ChatMessage) TextContent() string {
+	switch v := m.Content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		var sb strings.Builder
+		for _, part := range v {
+			p, ok := part.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if p["type"] == "text" {
+				if text, ok := p["text"].(string); ok {
+					sb.WriteString(text)
+				}
+			}
+		}
+		return sb.String()
+	default:
+		return ""
+	}
+}
+
+// ToolCall 工具调用
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // 仅流式增量中使用
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"` // function
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall 函数调用内容
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"` // JSON 字符串
+}
+
+// Tool 工具定义
+type Tool struct {
+	Type     string             `json:"type"` // function
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition 函数定义
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"` // JSON Schema
+}
+
+// StopSequences 停止序列，兼容字符串和字符串数组两种写法
+type StopSequences []string
+
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "" {
+			*s = StopSequences{single}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// StreamOptions 流式选项
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatCompletionRequest 对话补全请求
+type ChatCompletionRequest struct {
+	Model               string         `json:"model"`
+	Messages            []ChatMessage  `json:"messages"`
+	Temperature         *float64       `json:"temperature,omitempty"`
+	TopP                *float64       `json:"top_p,omitempty"`
+	N                   int            `json:"n,omitempty"`
+	MaxTokens           int            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int            `json:"max_completion_tokens,omitempty"` // 新版 OpenAI 接口中 max_tokens 的替代写法
+	Stop                StopSequences  `json:"stop,omitempty"`
+	PresencePenalty     *float64       `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float64       `json:"frequency_penalty,omitempty"`
+	Stream              bool           `json:"stream,omitempty"`
+	StreamOptions       *StreamOptions `json:"stream_options,omitempty"`
+	Tools               []Tool         `json:"tools,omitempty"`
+	ToolChoice          interface{}    `json:"tool_choice,omitempty"`
+	User                string         `json:"user,omitempty"`
+
+	// Extra 未单独建模的其他参数（response_format、seed、logprobs、logit_bias、parallel_tool_calls 等），
+	// 序列化时原样写回，OpenAI 兼容上游因此能收到完整请求
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// chatCompletionRequestFields ChatCompletionRequest 已建模的 JSON 字段名
+var chatCompletionRequestFields = jsonFieldNames(reflect.TypeOf(ChatCompletionRequest{}))
+
+// jsonFieldNames 结构体各字段 json 标签中的名称
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// chatCompletionRequest 去掉自定义编解码方法的别名，避免递归
+type chatCompletionRequest ChatCompletionRequest
+
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*chatCompletionRequest)(r)); err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	r.Extra = nil
+	for name, value := range fields {
+		if chatCompletionRequestFields[name] {
+			continue
+		}
+		if r.Extra == nil {
+			r.Extra = make(map[string]json.RawMessage)
+		}
+		r.Extra[name] = value
+	}
+	return nil
+}
+
+func (r ChatCompletionRequest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(chatCompletionRequest(r))
+	if err != nil || len(r.Extra) == 0 {
+		return data, err
+	}
+	fields := make(map[string]json.RawMessage, len(r.Extra))
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	// 已建模的字段以结构体中的值为准
+	for name, value := range r.Extra {
+		if _, ok := fields[name]; !ok && !chatCompletionRequestFields[name] {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// OutputTokenLimit 请求的最大输出 Token 数，优先 max_tokens，其次 max_completion_tokens，均未设置时为 0
+func (r *ChatCompletionRequest) OutputTokenLimit() int {
+	if r.MaxTokens > 0 {
+		return r.MaxTokens
+	}
+	return r.MaxCompletionTokens
+}
+
+// ChatUsage Token用量
+type ChatUsage struct {
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails 输入Token明细
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+// ChatChoice 补全结果选项
+type ChatChoice struct {
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"` // stop, length, tool_calls, content_filter
+}
+
+// ChatCompletionResponse 对话补全响应
+type ChatCompletionResponse struct {
+	ID      string       `json:"id"`
+	Object  string       `json:"object"` // chat.completion
+	Created int64        `json:"created"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   *ChatUsage   `json:"usage,omitempty"`
+}
+
+// ChatDelta 流式响应中的增量消息
+type ChatDelta struct {
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// ChatChunkChoice 流式响应选项
+type ChatChunkChoice struct {
+	Index        int       `json:"index"`
+	Delta        ChatDelta `json:"delta"`
+	FinishReason *string   `json:"finish_reason"`
+}
+
+// ChatCompletionChunk 流式响应数据块
+type ChatCompletionChunk struct {
+	ID      string            `json:"id"`
+	Object  string            `json:"object"` // chat.completion.chunk
+	Created int64             `json:"created"`
+	Model   string            `json:"model"`
+	Choices []ChatChunkChoice `json:"choices"`
+	Usage   *ChatUsage        `json:"usage,omitempty"`
+}
+
+// ChatError OpenAI 风格的错误信息
+type ChatError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Code    string `json:"code,omitempty"`
+}
+
+// ChatErrorResponse OpenAI 风格的错误响应
+type ChatErrorResponse struct {
+	Error ChatError `json:"error"`
+}
+
+// ModelPricing 模型价格（每1000 Token）
+type ModelPricing struct {
+	Prompt       float64 `json:"prompt"`
+	Completion   float64 `json:"completion"`
+	CachedPrompt float64 `json:"cached_prompt"`
+	Unit         string  `json:"unit"` // 1K tokens
+}
+
+// ModelObject /v1/models 返回的模型信息，在 OpenAI 格式基础上附加上下文窗口和价格
+type ModelObject struct {
+	ID            string       `json:"id"`
+	Object        string       `json:"object"` // model
+	Created       int64        `json:"created"`
+	OwnedBy       string       `json:"owned_by"`
+	Name          string       `json:"name"`
+	Description   string       `json:"description"`
+	ContextWindow int          `json:"context_window"`
+	MaxTokens     int          `json:"max_tokens"`
+	Pricing       ModelPricing `json:"pricing"`
+}
+
+// ModelList /v1/models 列表响应
+type ModelList struct {
+	Object string        `json:"object"` // list
+	Data   []ModelObject `json:"data"`
+}
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"macg/database"
+	"macg/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 邮件令牌（重置密码、验证邮箱）
+// 令牌明文只出现在邮件链接中，数据库只保存 HMAC，一次性使用
+// ============================================================================
+
+// 邮件令牌用途
+const (
+	EmailTokenPasswordReset = "password_reset"
+	EmailTokenVerifyEmail   = "verify_email"
+)
+
+const (
+	PasswordResetTTL   = time.Hour
+	VerifyEmailTTL     = 24 * time.Hour
+	emailTokenCooldown = time.Minute // 同一用途两次发送的最小间隔
+)
+
+var (
+	ErrEmailTokenInvalid     = errors.New("链接无效或已使用")
+	ErrEmailTokenExpired     = errors.New("链接已过期，请重新申请")
+	ErrEmailTokenTooFrequent = errors.New("发送过于频繁，请稍后再试")
+	ErrEmailNotVerified      = errors.New("邮箱尚未验证，请查收验证邮件")
+)
+
+// EmailToken 邮件令牌
+type EmailToken struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	Purpose   string     `gorm:"size:30;index;not null" json:"purpose"`
+	Email     string     `gorm:"size:255" json:"email"` // 签发时的邮箱，邮箱变更后验证令牌失效
+	TokenHash string     `gorm:"size:100;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"index" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (EmailToken) TableName() string {
+	return "email_tokens"
+}
+
+func (t *EmailToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// createEmailToken 生成邮件令牌并使同一用途的旧令牌失效，返回明文
+func createEmailToken(user *User, purpose string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.New("生成令牌失败")
+	}
+	raw := hex.EncodeToString(buf)
+	now := time.Now()
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var recent int64
+		if err := tx.Model(&EmailToken{}).
+			Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, purpose, now.Add(-emailTokenCooldown)).
+			Count(&recent).Error; err != nil {
+			return err
+		}
+		if recent > 0 {
+			return ErrEmailTokenTooFrequent
+		}
+
+		// 只有最新发出的链接有效
+		if err := tx.Model(&EmailToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&EmailToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			Email:     user.Email,
+			TokenHash: keyedHash(raw),
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrEmailTokenTooFrequent) {
+			return "", err
+		}
+		return "", errors.New("保存令牌失败：" + err.Error())
+	}
+	return raw, nil
+}
+
+// consumeEmailToken 在事务内校验并标记令牌已使用
+func consumeEmailToken(tx *gorm.DB, raw, purpose string) (*EmailToken, error) {
+	var token EmailToken
+	if err := database.ForUpdate(tx).
+		Where("token_hash = ? AND purpose = ?", keyedHash(raw), purpose).
+		First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEmailTokenInvalid
+		}
+		return nil, err
+	}
+	if token.UsedAt != nil {
+		return nil, ErrEmailTokenInvalid
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return nil, ErrEmailTokenExpired
+	}
+
+	if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// getUserByEmail 根据邮箱查找用户，不存在时返回 nil
+func getUserByEmail(email string) (*User, error) {
+	db := database.GetDB()
+	var user User
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.New("查询用户失败：" + err.Error())
+	}
+	return &user, nil
+}
+
+// CreatePasswordResetToken 为邮箱对应的用户生成重置密码令牌
+// 邮箱未注册时返回 nil 用户且不报错，调用方不应向客户端暴露差异
+func CreatePasswordResetToken(email string) (*User, string, error) {
+	user, err := getUserByEmail(email)
+	if err != nil || user == nil {
+		return nil, "", err
+	}
+	raw, err := createEmailToken(user, EmailTokenPasswordReset, PasswordResetTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, raw, nil
+}
+
+// ResetPassword 使用重置令牌设置新密码，同时解除锁定并使所有已登录设备失效
+func ResetPassword(raw, newPassword string) (*User, error) {
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return nil, errors.New("密码加密失败")
+	}
+
+	var user User
+	err = database.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeEmailToken(tx, raw, EmailTokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return ErrEmailTokenInvalid
+		}
+
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"locked_until":  nil,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ResetLoginFailures(user.Username)
+	return &user, nil
+}
+
+// CreateEmailVerificationToken 为用户当前邮箱生成验证令牌
+func CreateEmailVerificationToken(user *User) (string, error) {
+	if user.Email == "" {
+		return "", errors.New("用户未设置邮箱")
+	}
+	return createEmailToken(user, EmailTokenVerifyEmail, VerifyEmailTTL)
+}
+
+// ResendEmailVerification 重新发送验证邮件；邮箱未注册或已验证时返回 nil 用户且不报错
+func ResendEmailVerification(email string) (*User, string, error) {
+	user, err := getUserByEmail(email)
+	if err != nil || user == nil || user.EmailVerified {
+		return nil, "", err
+	}
+	raw, err := CreateEmailVerificationToken(user)
+	if err != nil {
+		return nil, "", err
+	}
+	return user, raw, nil
+}
+
+// VerifyEmail 使用验证令牌确认邮箱，注册时等待验证的账号随即激活
+func VerifyEmail(raw string) (*User, error) {
+	var user User
+	err := database.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeEmailToken(tx, raw, EmailTokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+		if err := database.ForUpdate(tx).First(&user, token.UserID).Error; err != nil {
+			return ErrEmailTokenInvalid
+		}
+		if user.Email != token.Email {
+			return ErrEmailTokenInvalid
+		}
+
+		now := time.Now()
+		updates := map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": now,
+		}
+		// 只激活注册时等待验证的账号，管理员禁用的账号不受影响
+		if user.AwaitingVerification {
+			updates["status"] = "active"
+			updates["awaiting_verification"] = false
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// MarkAwaitingVerification 将新注册的账号置为 inactive，验证邮箱后激活
+func MarkAwaitingVerification(user *User) error {
+	db := database.GetDB()
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"status":                "inactive",
+		"awaiting_verification": true,
+	}).Error; err != nil {
+		return errors.New("更新用户状态失败：" + err.Error())
+	}
+	return nil
+}
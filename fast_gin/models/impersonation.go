@@ -0,0 +1,166 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// 模拟登录
+// 超级管理员以目标用户身份查看系统，令牌的 act 声明记录实际操作人，
+// 每次模拟对应一条会话记录，结束或到期后令牌失效
+// ============================================================================
+
+// ImpersonatorRole 可发起模拟登录的角色
+const ImpersonatorRole = "super_admin"
+
+var (
+	ErrImpersonateSelf       = errors.New("不能模拟自己")
+	ErrImpersonateAdmin      = errors.New("不能模拟超级管理员")
+	ErrImpersonateInactive   = errors.New("目标账号未启用，无法模拟")
+	ErrImpersonationEnded    = errors.New("模拟会话已结束")
+	ErrImpersonationNotFound = errors.New("模拟会话不存在")
+)
+
+// ImpersonationSession 模拟登录会话
+type ImpersonationSession struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AdminID      uuid.UUID  `gorm:"type:uuid;index;not null" json:"admin_id"`       // 实际操作的管理员
+	TargetUserID uuid.UUID  `gorm:"type:uuid;index;not null" json:"target_user_id"` // 被模拟的用户
+	Reason       string     `gorm:"size:500" json:"reason"`
+	TicketID     *uuid.UUID `gorm:"type:uuid;index" json:"ticket_id"` // 关联的工单
+	TokenJTI     string     `gorm:"size:100;uniqueIndex;not null" json:"-"`
+	IP           string     `gorm:"size:50" json:"ip"`
+	ExpiresAt    time.Time  `gorm:"index" json:"expires_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	CreatedAt    time.Time  `gorm:"index" json:"created_at"`
+
+	// 关联
+	Admin      *User `gorm:"foreignKey:AdminID" json:"admin,omitempty"`
+	TargetUser *User `gorm:"foreignKey:TargetUserID" json:"target_user,omitempty"`
+}
+
+func (ImpersonationSession) TableName() string {
+	return "impersonation_sessions"
+}
+
+func (s *ImpersonationSession) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// Active 会话未结束且未过期
+func (s *ImpersonationSession) Active() bool {
+	return s.EndedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// CheckImpersonationTarget 校验管理员能否模拟目标用户
+func CheckImpersonationTarget(adminID uuid.UUID, target *User) error {
+	if target.ID == adminID {
+		return ErrImpersonateSelf
+	}
+	if target.Status != "active" {
+		return ErrImpersonateInactive
+	}
+	for _, role := range target.Roles {
+		if role.Name == ImpersonatorRole {
+			return ErrImpersonateAdmin
+		}
+	}
+	return nil
+}
+
+// CreateImpersonationSession 保存模拟会话
+func CreateImpersonationSession(session *ImpersonationSession) error {
+	db := database.GetDB()
+
+	if err := db.Create(session).Error; err != nil {
+		return errors.New("创建模拟会话失败：" + err.Error())
+	}
+	return nil
+}
+
+// GetImpersonationSessionByJTI 根据令牌 jti 获取模拟会话
+func GetImpersonationSessionByJTI(jti string) (*ImpersonationSession, error) {
+	db := database.GetDB()
+
+	var session ImpersonationSession
+	if err := db.Where("token_jti = ?", jti).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrImpersonationNotFound
+		}
+		return nil, errors.New("查询模拟会话失败：" + err.Error())
+	}
+	return &session, nil
+}
+
+// EndImpersonationSession 结束模拟会话并吊销其令牌，已结束的会话返回 ErrImpersonationEnded
+func EndImpersonationSession(id uuid.UUID) (*ImpersonationSession, error) {
+	var session ImpersonationSession
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).First(&session, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrImpersonationNotFound
+			}
+			return err
+		}
+		if session.EndedAt != nil {
+			return ErrImpersonationEnded
+		}
+
+		now := time.Now()
+		session.EndedAt = &now
+		if err := tx.Model(&session).Update("ended_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&RevokedToken{
+			JTI:       session.TokenJTI,
+			UserID:    session.TargetUserID,
+			ExpiresAt: session.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrImpersonationNotFound) || errors.Is(err, ErrImpersonationEnded) {
+			return nil, err
+		}
+		return nil, errors.New("结束模拟会话失败：" + err.Error())
+	}
+	return &session, nil
+}
+
+// GetImpersonationSessions 分页获取模拟会话，可按管理员或目标用户过滤
+func GetImpersonationSessions(adminID, targetUserID *uuid.UUID, page, pageSize int) ([]ImpersonationSession, int64, error) {
+	db := database.GetDB()
+	var sessions []ImpersonationSession
+	var total int64
+
+	query := db.Model(&ImpersonationSession{})
+	if adminID != nil {
+		query = query.Where("admin_id = ?", *adminID)
+	}
+	if targetUserID != nil {
+		query = query.Where("target_user_id = ?", *targetUserID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("获取记录数失败：" + err.Error())
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).
+		Preload("Admin").Preload("TargetUser").
+		Order("created_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, 0, errors.New("查询模拟会话失败：" + err.Error())
+	}
+
+	return sessions, total, nil
+}
@@ -0,0 +1,392 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 邀请
+// 邀请指定邮箱注册账号或加入组织，令牌明文只出现在邀请邮件中，一次性使用
+// ============================================================================
+
+// 邀请状态
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+)
+
+// InvitationTTL 邀请有效期，重新发送时重新计算
+const InvitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvitationInvalid       = errors.New("邀请无效或已使用")
+	ErrInvitationExpired       = errors.New("邀请已过期，请联系邀请人重新发送")
+	ErrInvitationEmailMismatch = errors.New("邀请发送给其他邮箱，请使用受邀邮箱登录或注册")
+	ErrInvitationNotFound      = errors.New("邀请不存在")
+	ErrInvitationNotPending    = errors.New("邀请已被接受或撤销")
+	ErrInvitationRequired      = errors.New("当前仅支持凭邀请注册")
+	ErrInvitationRegistered    = errors.New("该邮箱已注册，无需邀请注册")
+)
+
+// Invitation 邀请记录
+type Invitation struct {
+	ID             uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Email          string     `gorm:"size:255;index;not null" json:"email"`
+	InviterID      uuid.UUID  `gorm:"type:uuid;index;not null" json:"inviter_id"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id"` // 为空时只邀请注册
+	OrgRole        string     `gorm:"size:20" json:"org_role"`                // 加入组织后的成员角色
+	TokenHash      string     `gorm:"size:100;uniqueIndex;not null" json:"-"`
+	Status         string     `gorm:"size:20;default:'pending';index" json:"status"` // pending, accepted, revoked
+	ExpiresAt      time.Time  `gorm:"index" json:"expires_at"`
+	AcceptedBy     *uuid.UUID `gorm:"type:uuid" json:"accepted_by"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// 关联
+	Inviter      *User         `gorm:"foreignKey:InviterID" json:"inviter,omitempty"`
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (Invitation) TableName() string {
+	return "invitations"
+}
+
+func (i *Invitation) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// normalizeEmail 邮箱比较不区分大小写
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// newInvitationToken 生成邀请令牌明文
+func newInvitationToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.New("生成邀请令牌失败")
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateInvitation 创建邀请，返回令牌明文；同一邮箱对同一目标的未处理邀请会被撤销
+// orgID 不为空时 role 为组织角色，actorRole 为邀请人的组织角色
+func CreateInvitation(inviterID uuid.UUID, email string, orgID *uuid.UUID, role, actorRole string) (*Invitation, string, error) {
+	email = normalizeEmail(email)
+	if orgID == nil {
+		role = ""
+	} else {
+		if role == "" {
+			role = OrgRoleMember
+		}
+		if !ValidOrgRole(role) {
+			return nil, "", ErrInvalidOrgRole
+		}
+		if role == OrgRoleOwner && actorRole != OrgRoleOwner {
+			return nil, "", ErrOrgOwnerRequired
+		}
+	}
+
+	raw, err := newInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+	invitation := Invitation{
+		Email:          email,
+		InviterID:      inviterID,
+		OrganizationID: orgID,
+		OrgRole:        role,
+		TokenHash:      keyedHash(raw),
+		Status:         InvitationPending,
+		ExpiresAt:      time.Now().Add(InvitationTTL),
+	}
+
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if orgID != nil {
+			var members int64
+			if err := tx.Model(&OrganizationMember{}).
+				Joins("JOIN users ON users.id = organization_members.user_id").
+				Where("organization_members.organization_id = ? AND LOWER(users.email) = ?", *orgID, email).
+				Count(&members).Error; err != nil {
+				return err
+			}
+			if members > 0 {
+				return ErrOrgMemberExists
+			}
+		} else {
+			var users int64
+			if err := tx.Model(&User{}).Where("LOWER(email) = ?", email).Count(&users).Error; err != nil {
+				return err
+			}
+			if users > 0 {
+				return ErrInvitationRegistered
+			}
+		}
+
+		// 只有最新发出的邀请有效
+		stale := tx.Model(&Invitation{}).Where("email = ? AND status = ?", email, InvitationPending)
+		if orgID != nil {
+			stale = stale.Where("organization_id = ?", *orgID)
+		} else {
+			stale = stale.Where("organization_id IS NULL")
+		}
+		if err := stale.Update("status", InvitationRevoked).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrOrgMemberExists) || errors.Is(err, ErrInvitationRegistered) {
+			return nil, "", err
+		}
+		return nil, "", errors.New("创建邀请失败：" + err.Error())
+	}
+	return &invitation, raw, nil
+}
+
+// GetInvitations 分页获取邀请，orgID 不为空时只返回该组织的邀请
+func GetInvitations(orgID *uuid.UUID, status string, page, pageSize int) ([]Invitation, int64, error) {
+	db := database.GetDB()
+	var invitations []Invitation
+	var total int64
+
+	query := db.Model(&Invitation{})
+	if orgID != nil {
+		query = query.Where("organization_id = ?", *orgID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("获取邀请总数失败：" + err.Error())
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Preload("Inviter").Preload("Organization").
+		Offset(offset).Limit(pageSize).
+		Order("created_at DESC").
+		Find(&invitations).Error; err != nil {
+		return nil, 0, errors.New("查询邀请失败：" + err.Error())
+	}
+	return invitations, total, nil
+}
+
+// lockPendingInvitation 锁定未处理的邀请，orgID 不为空时要求属于该组织
+func lockPendingInvitation(tx *gorm.DB, id uuid.UUID, orgID *uuid.UUID, invitation *Invitation) error {
+	query := database.ForUpdate(tx).Where("id = ?", id)
+	if orgID != nil {
+		query = query.Where("organization_id = ?", *orgID)
+	}
+	if err := query.First(invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvitationNotFound
+		}
+		return err
+	}
+	if invitation.Status != InvitationPending {
+		return ErrInvitationNotPending
+	}
+	return nil
+}
+
+// ResendInvitation 重新生成邀请令牌并延长有效期，旧链接失效
+func ResendInvitation(id uuid.UUID, orgID *uuid.UUID) (*Invitation, string, error) {
+	raw, err := newInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var invitation Invitation
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingInvitation(tx, id, orgID, &invitation); err != nil {
+			return err
+		}
+		invitation.TokenHash = keyedHash(raw)
+		invitation.ExpiresAt = time.Now().Add(InvitationTTL)
+		return tx.Model(&invitation).Updates(map[string]interface{}{
+			"token_hash": invitation.TokenHash,
+			"expires_at": invitation.ExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, "", invitationError(err, "重新发送邀请失败：")
+	}
+	return &invitation, raw, nil
+}
+
+// RevokeInvitation 撤销未处理的邀请
+func RevokeInvitation(id uuid.UUID, orgID *uuid.UUID) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var invitation Invitation
+		if err := lockPendingInvitation(tx, id, orgID, &invitation); err != nil {
+			return err
+		}
+		return tx.Model(&invitation).Update("status", InvitationRevoked).Error
+	})
+	return invitationError(err, "撤销邀请失败：")
+}
+
+// findPendingInvitation 按令牌查找可用的邀请
+func findPendingInvitation(db *gorm.DB, raw string, invitation *Invitation) error {
+	if err := db.Where("token_hash = ?", keyedHash(raw)).First(invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvitationInvalid
+		}
+		return err
+	}
+	if invitation.Status != InvitationPending {
+		return ErrInvitationInvalid
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return ErrInvitationExpired
+	}
+	return nil
+}
+
+// GetInvitationByToken 按令牌获取可用的邀请（含邀请人和组织），用于接受前展示
+func GetInvitationByToken(raw string) (*Invitation, error) {
+	var invitation Invitation
+	db := database.GetDB().Preload("Inviter").Preload("Organization")
+	if err := findPendingInvitation(db, raw, &invitation); err != nil {
+		return nil, invitationError(err, "查询邀请失败：")
+	}
+	return &invitation, nil
+}
+
+// InvitationEmailRegistered 受邀邮箱是否已有账号
+func InvitationEmailRegistered(invitation *Invitation) (bool, error) {
+	var count int64
+	if err := database.GetDB().Model(&User{}).Where("LOWER(email) = ?", invitation.Email).Count(&count).Error; err != nil {
+		return false, errors.New("查询用户失败：" + err.Error())
+	}
+	return count > 0, nil
+}
+
+// AcceptInvitation 接受邀请：用户邮箱必须与受邀邮箱一致，邀请邮件同时证明了邮箱归属，
+// 邮箱随即标记为已验证；组织邀请会把用户加入组织，已是成员时保留原角色
+func AcceptInvitation(raw string, user *User) (*Invitation, error) {
+	var invitation Invitation
+	err := database.Transaction(func(tx *gorm.DB) error {
+		return acceptInvitation(tx, raw, user, &invitation)
+	})
+	if err != nil {
+		return nil, invitationError(err, "接受邀请失败：")
+	}
+	return &invitation, nil
+}
+
+// RegisterWithInvitation 凭邀请注册：创建用户和接受邀请在同一事务中完成，
+// 邀请已被并发使用或接受失败时不会留下新用户
+func RegisterWithInvitation(raw, username, email, password, name, role string) (*User, *Invitation, error) {
+	var user *User
+	var invitation Invitation
+	var createErr error
+	err := database.Transaction(func(tx *gorm.DB) error {
+		user, createErr = createUser(tx, username, email, password, name, role)
+		if createErr != nil {
+			return createErr
+		}
+		return acceptInvitation(tx, raw, user, &invitation)
+	})
+	if createErr != nil {
+		// createUser 的错误已带有说明
+		return nil, nil, createErr
+	}
+	if err != nil {
+		return nil, nil, invitationError(err, "接受邀请失败：")
+	}
+	return user, &invitation, nil
+}
+
+// acceptInvitation 在事务中锁定并接受邀请
+func acceptInvitation(tx *gorm.DB, raw string, user *User, invitation *Invitation) error {
+	if normalizeEmail(user.Email) == "" {
+		return ErrInvitationEmailMismatch
+	}
+	if err := findPendingInvitation(database.ForUpdate(tx), raw, invitation); err != nil {
+		return err
+	}
+	if normalizeEmail(user.Email) != invitation.Email {
+		return ErrInvitationEmailMismatch
+	}
+
+	if invitation.OrganizationID != nil {
+		var org Organization
+		if err := tx.First(&org, *invitation.OrganizationID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvitationInvalid
+			}
+			return err
+		}
+		var existing int64
+		if err := tx.Model(&OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", org.ID, user.ID).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing == 0 {
+			if err := tx.Create(&OrganizationMember{
+				OrganizationID: org.ID,
+				UserID:         user.ID,
+				Role:           invitation.OrgRole,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	now := time.Now()
+	if !user.EmailVerified {
+		updates := map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": now,
+		}
+		if user.AwaitingVerification {
+			updates["status"] = "active"
+			updates["awaiting_verification"] = false
+		}
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	invitation.Status = InvitationAccepted
+	invitation.AcceptedBy = &user.ID
+	invitation.AcceptedAt = &now
+	return tx.Model(invitation).Updates(map[string]interface{}{
+		"status":      InvitationAccepted,
+		"accepted_by": user.ID,
+		"accepted_at": now,
+	}).Error
+}
+
+// invitationError 业务错误原样返回，数据库错误加上前缀
+func invitationError(err error, prefix string) error {
+	if err == nil {
+		return nil
+	}
+	for _, known := range []error{
+		ErrInvitationInvalid, ErrInvitationExpired, ErrInvitationEmailMismatch,
+		ErrInvitationNotFound, ErrInvitationNotPending,
+	} {
+		if errors.Is(err, known) {
+			return err
+		}
+	}
+	return errors.New(prefix + err.Error())
+}
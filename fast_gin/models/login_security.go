@@ -0,0 +1,358 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"macg/core"
+	"macg/database"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// 登录防暴力破解与登录历史
+// ============================================================================
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrAccountDisabled    = errors.New("账号已被禁用")
+	ErrAccountLocked      = errors.New("登录失败次数过多，账号已被临时锁定")
+	ErrLoginNonceReused   = errors.New("登录请求已被使用，请重新提交")
+)
+
+// 登录历史的失败原因
+const (
+	LoginFailInvalidCredentials = "invalid_credentials"
+	LoginFailInvalidTwoFactor   = "invalid_2fa"
+	LoginFailAccountLocked      = "account_locked"
+	LoginFailAccountDisabled    = "account_disabled"
+	LoginFailEmailNotVerified   = "email_not_verified"
+	LoginFailThrottled          = "throttled"
+	LoginFailSSONotProvisioned  = "sso_not_provisioned"
+)
+
+// LoginThrottledError 账号或 IP 处于退避期，RetryAfter 后才能再次尝试
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("登录尝试过于频繁，请 %d 秒后重试", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// LoginFailureCounter 按账号或 IP 统计的连续失败次数
+type LoginFailureCounter struct {
+	CounterKey   string     `gorm:"size:200;primaryKey" json:"counter_key"` // user:<username> 或 ip:<ip>
+	Failures     int        `json:"failures"`
+	BlockedUntil *time.Time `json:"blocked_until"` // 退避或封禁截止时间
+	UpdatedAt    time.Time  `gorm:"index" json:"updated_at"`
+}
+
+func (LoginFailureCounter) TableName() string {
+	return "login_failure_counters"
+}
+
+// LoginHistory 登录历史，记录每次登录尝试
+type LoginHistory struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    *uuid.UUID `gorm:"type:uuid;index" json:"user_id"` // 用户名不存在时为空
+	Username  string     `gorm:"size:100;index" json:"username"`
+	IP        string     `gorm:"size:50;index" json:"ip"`
+	UserAgent string     `gorm:"size:500" json:"user_agent"`
+	Success   bool       `json:"success"`
+	Reason    string     `gorm:"size:50" json:"reason"` // 失败原因，成功时为空
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+}
+
+func (LoginHistory) TableName() string {
+	return "login_histories"
+}
+
+func (h *LoginHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
+// UsedLoginNonce 已使用的加密登录载荷 nonce，有效期内重复出现视为重放
+type UsedLoginNonce struct {
+	Nonce     string    `gorm:"size:100;primaryKey" json:"nonce"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
+
+func (UsedLoginNonce) TableName() string {
+	return "used_login_nonces"
+}
+
+// loginProtection 读取登录防护配置，未配置的项使用默认值
+func loginProtection() core.LoginProtectionConfig {
+	cfg := core.Cfg.Security.Login
+	defaults := []struct {
+		value *int
+		def   int
+	}{
+		{&cfg.FreeAttempts, 3},
+		{&cfg.BackoffSeconds, 2},
+		{&cfg.MaxBackoff, 300},
+		{&cfg.MaxFailures, 10},
+		{&cfg.LockMinutes, 30},
+		{&cfg.IPFreeAttempts, 20},
+		{&cfg.IPMaxFailures, 50},
+		{&cfg.IPBlockMinutes, 60},
+		{&cfg.WindowMinutes, 60},
+		{&cfg.HistoryRetention, 90},
+	}
+	for _, d := range defaults {
+		if *d.value <= 0 {
+			*d.value = d.def
+		}
+	}
+	return cfg
+}
+
+func userCounterKey(username string) string {
+	return "user:" + username
+}
+
+func ipCounterKey(ip string) string {
+	return "ip:" + ip
+}
+
+// backoffUntil 超过免费次数后按 2 的幂次退避，返回退避截止时间
+func backoffUntil(now time.Time, failures, free int, cfg core.LoginProtectionConfig) *time.Time {
+	if failures <= free {
+		return nil
+	}
+	delay := time.Duration(cfg.MaxBackoff) * time.Second
+	if exp := failures - free - 1; exp < 20 {
+		if d := time.Duration(cfg.BackoffSeconds) * time.Second << exp; d < delay {
+			delay = d
+		}
+	}
+	until := now.Add(delay)
+	return &until
+}
+
+// IsLocked 判断账号是否处于临时锁定期
+func (u *User) IsLocked() bool {
+	return u.LockedUntil != nil && u.LockedUntil.After(time.Now())
+}
+
+// CheckLoginAllowed 校验密码前检查账号和 IP 是否处于退避或封禁期
+func CheckLoginAllowed(username, ip string) error {
+	db := database.GetDB()
+
+	var counters []LoginFailureCounter
+	if err := db.Where("counter_key IN ?", []string{userCounterKey(username), ipCounterKey(ip)}).
+		Find(&counters).Error; err != nil {
+		return errors.New("查询登录失败记录失败：" + err.Error())
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, counter := range counters {
+		if counter.BlockedUntil != nil && counter.BlockedUntil.After(now) {
+			if d := counter.BlockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// RecordLoginFailure 记录一次失败的登录，更新退避时间，达到上限时锁定账号或封禁 IP
+func RecordLoginFailure(username, ip string) error {
+	cfg := loginProtection()
+	now := time.Now()
+	window := time.Duration(cfg.WindowMinutes) * time.Minute
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		counter, err := bumpLoginCounter(tx, userCounterKey(username), now, window)
+		if err != nil {
+			return err
+		}
+		blocked := backoffUntil(now, counter.Failures, cfg.FreeAttempts, cfg)
+		if counter.Failures >= cfg.MaxFailures {
+			// 锁定账号后重新计数，解锁后重新获得免费尝试次数
+			lockedUntil := now.Add(time.Duration(cfg.LockMinutes) * time.Minute)
+			result := tx.Model(&User{}).Where("username = ?", username).Update("locked_until", lockedUntil)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				zap.L().Warn("登录失败次数过多，账号已锁定", zap.String("username", username), zap.String("ip", ip))
+			}
+			counter.Failures = 0
+			blocked = nil
+		}
+		if err := saveLoginCounter(tx, counter, blocked); err != nil {
+			return err
+		}
+
+		counter, err = bumpLoginCounter(tx, ipCounterKey(ip), now, window)
+		if err != nil {
+			return err
+		}
+		blocked = backoffUntil(now, counter.Failures, cfg.IPFreeAttempts, cfg)
+		if counter.Failures >= cfg.IPMaxFailures {
+			until := now.Add(time.Duration(cfg.IPBlockMinutes) * time.Minute)
+			blocked = &until
+			zap.L().Warn("登录失败次数过多，IP 已封禁", zap.String("ip", ip))
+		}
+		return saveLoginCounter(tx, counter, blocked)
+	})
+	if err != nil {
+		return errors.New("记录登录失败失败：" + err.Error())
+	}
+	return nil
+}
+
+// bumpLoginCounter 在行锁内将失败次数加一，超过计数窗口未失败时重新计数
+func bumpLoginCounter(tx *gorm.DB, key string, now time.Time, window time.Duration) (*LoginFailureCounter, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&LoginFailureCounter{CounterKey: key, UpdatedAt: now}).Error; err != nil {
+		return nil, err
+	}
+
+	var counter LoginFailureCounter
+	if err := database.ForUpdate(tx).Where("counter_key = ?", key).First(&counter).Error; err != nil {
+		return nil, err
+	}
+	if now.Sub(counter.UpdatedAt) > window {
+		counter.Failures = 0
+	}
+	counter.Failures++
+	return &counter, nil
+}
+
+func saveLoginCounter(tx *gorm.DB, counter *LoginFailureCounter, blockedUntil *time.Time) error {
+	return tx.Model(&LoginFailureCounter{}).Where("counter_key = ?", counter.CounterKey).
+		Updates(map[string]interface{}{
+			"failures":      counter.Failures,
+			"blocked_until": blockedUntil,
+			"updated_at":    time.Now(),
+		}).Error
+}
+
+// ResetLoginFailures 登录成功后清除账号的失败计数；IP 计数按窗口自然过期
+func ResetLoginFailures(username string) {
+	db := database.GetDB()
+	if err := db.Where("counter_key = ?", userCounterKey(username)).Delete(&LoginFailureCounter{}).Error; err != nil {
+		zap.L().Warn("清除登录失败计数失败", zap.String("username", username), zap.Error(err))
+	}
+}
+
+// UnlockUser 管理员解除账号锁定并清除失败计数
+func UnlockUser(id uuid.UUID) (*User, error) {
+	user, err := GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("locked_until", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("counter_key = ?", userCounterKey(user.Username)).Delete(&LoginFailureCounter{}).Error
+	})
+	if err != nil {
+		return nil, errors.New("解除账号锁定失败：" + err.Error())
+	}
+
+	user.LockedUntil = nil
+	return user, nil
+}
+
+// RecordLoginHistory 记录一次登录尝试，失败只记录错误日志，不影响登录流程
+func RecordLoginHistory(username, ip, userAgent string, success bool, reason string) {
+	db := database.GetDB()
+
+	history := LoginHistory{
+		Username:  username,
+		IP:        ip,
+		UserAgent: userAgent,
+		Success:   success,
+		Reason:    reason,
+	}
+	if len(history.UserAgent) > 500 {
+		history.UserAgent = history.UserAgent[:500]
+	}
+
+	var user User
+	if err := db.Select("id").Where("username = ?", username).First(&user).Error; err == nil {
+		history.UserID = &user.ID
+	}
+
+	if err := db.Create(&history).Error; err != nil {
+		zap.L().Error("记录登录历史失败", zap.String("username", username), zap.Error(err))
+	}
+}
+
+// GetLoginHistory 分页获取用户的登录历史
+func GetLoginHistory(userID uuid.UUID, page, pageSize int) ([]LoginHistory, int64, error) {
+	db := database.GetDB()
+	var histories []LoginHistory
+	var total int64
+
+	query := db.Model(&LoginHistory{}).Where("user_id = ?", userID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("获取记录数失败：" + err.Error())
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).
+		Order("created_at DESC").
+		Find(&histories).Error; err != nil {
+		return nil, 0, errors.New("查询登录历史失败：" + err.Error())
+	}
+
+	return histories, total, nil
+}
+
+// ConsumeLoginNonce 记录加密登录载荷的 nonce，已使用过时返回 ErrLoginNonceReused
+func ConsumeLoginNonce(nonce string, expiresAt time.Time) error {
+	db := database.GetDB()
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&UsedLoginNonce{Nonce: nonce, ExpiresAt: expiresAt})
+	if result.Error != nil {
+		return errors.New("记录登录 nonce 失败：" + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return ErrLoginNonceReused
+	}
+	return nil
+}
+
+// PruneLoginRecords 清理过期的失败计数、nonce 和超过保留期的登录历史
+func PruneLoginRecords() error {
+	db := database.GetDB()
+	cfg := loginProtection()
+	now := time.Now()
+
+	staleBefore := now.Add(-time.Duration(cfg.WindowMinutes) * time.Minute)
+	if err := db.Where("updated_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", staleBefore, now).
+		Delete(&LoginFailureCounter{}).Error; err != nil {
+		return errors.New("清理登录失败计数失败：" + err.Error())
+	}
+
+	if err := db.Where("expires_at < ?", now).Delete(&UsedLoginNonce{}).Error; err != nil {
+		return errors.New("清理登录 nonce 失败：" + err.Error())
+	}
+
+	retainAfter := now.AddDate(0, 0, -cfg.HistoryRetention)
+	if err := db.Where("created_at < ?", retainAfter).Delete(&LoginHistory{}).Error; err != nil {
+		return errors.New("清理登录历史失败：" + err.Error())
+	}
+	return nil
+}
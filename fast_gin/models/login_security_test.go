@@ -0,0 +1,126 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"macg/core"
+	"macg/database/dbtest"
+)
+
+func TestBackoffUntil(t *testing.T) {
+	cfg := core.LoginProtectionConfig{BackoffSeconds: 2, MaxBackoff: 300}
+	now := time.Unix(1700000000, 0)
+
+	cases := []struct {
+		failures int
+		want     time.Duration // 0 表示不退避
+	}{
+		{0, 0},
+		{3, 0},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{11, 256 * time.Second},
+		{12, 300 * time.Second}, // 512 秒超过上限
+		{100, 300 * time.Second},
+	}
+	for _, tc := range cases {
+		until := backoffUntil(now, tc.failures, 3, cfg)
+		switch {
+		case tc.want == 0 && until != nil:
+			t.Errorf("failures=%d: backoff until %s, want none", tc.failures, until)
+		case tc.want != 0 && (until == nil || until.Sub(now) != tc.want):
+			t.Errorf("failures=%d: backoff until %v, want %s", tc.failures, until, tc.want)
+		}
+	}
+}
+
+func TestRecordLoginFailureThresholds(t *testing.T) {
+	db := dbtest.Open(t, &Role{}, &User{}, &LoginFailureCounter{})
+	if err := db.Create(&User{Username: "alice", Email: "alice@example.com", Password: "x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	saved := core.Cfg.Security.Login
+	core.Cfg.Security.Login = core.LoginProtectionConfig{
+		FreeAttempts:   2,
+		BackoffSeconds: 60,
+		MaxFailures:    4,
+		LockMinutes:    30,
+		IPFreeAttempts: 100,
+		IPMaxFailures:  6,
+		IPBlockMinutes: 60,
+	}
+	t.Cleanup(func() { core.Cfg.Security.Login = saved })
+
+	fail := func(username, ip string) {
+		t.Helper()
+		if err := RecordLoginFailure(username, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	throttled := func(username, ip string) time.Duration {
+		t.Helper()
+		err := CheckLoginAllowed(username, ip)
+		var te *LoginThrottledError
+		if errors.As(err, &te) {
+			return te.RetryAfter
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return 0
+	}
+	lockedUntil := func() *time.Time {
+		t.Helper()
+		u, err := GetUserByUsername("alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.LockedUntil
+	}
+
+	// 免费次数内不退避
+	fail("alice", "10.0.0.1")
+	fail("alice", "10.0.0.1")
+	if d := throttled("alice", "10.0.0.1"); d != 0 {
+		t.Fatalf("throttled for %s within free attempts", d)
+	}
+
+	// 超过免费次数后退避
+	fail("alice", "10.0.0.1")
+	if d := throttled("alice", "10.0.0.1"); d <= 0 || d > time.Minute {
+		t.Fatalf("retry after %s, want up to 1m", d)
+	}
+	if lockedUntil() != nil {
+		t.Fatal("account locked before max failures")
+	}
+
+	// 达到上限后锁定账号，计数归零，退避解除
+	fail("alice", "10.0.0.1")
+	if until := lockedUntil(); until == nil || time.Until(*until) < 29*time.Minute {
+		t.Fatalf("locked until %v, want about 30m", until)
+	}
+	var counter LoginFailureCounter
+	if err := db.First(&counter, "counter_key = ?", userCounterKey("alice")).Error; err != nil {
+		t.Fatal(err)
+	}
+	if counter.Failures != 0 || counter.BlockedUntil != nil {
+		t.Fatalf("counter after lock = %+v", counter)
+	}
+
+	// 同一 IP 对不同账号的失败累计到上限后封禁 IP
+	fail("bob", "10.0.0.1")
+	if d := throttled("carol", "10.0.0.1"); d != 0 {
+		t.Fatalf("ip throttled for %s below ip max failures", d)
+	}
+	fail("carol", "10.0.0.1")
+	if d := throttled("dave", "10.0.0.1"); d < 59*time.Minute {
+		t.Fatalf("ip retry after %s, want about 1h", d)
+	}
+	if d := throttled("dave", "10.0.0.2"); d != 0 {
+		t.Fatalf("other ip throttled for %s", d)
+	}
+}
@@ -66,17 +66,21 @@ type UserRequest struct {
 
 // 服务 DTO (用于 API 响应)
 type ServiceDTO struct {
-	ID          int     `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Status      string  `json:"status"`
-	Uptime      string  `json:"uptime"`
-	Icon        string  `json:"icon"`
-	Bg          string  `json:"bg"`
-	ModelID     string  `json:"model_id,omitempty"`
-	MaxTokens   int     `json:"max_tokens,omitempty"`
-	RateLimit   int     `json:"rate_limit,omitempty"`
-	Price       float64 `json:"price,omitempty"`
+	ID            int     `json:"id"`
+	Name          string  `json:"name"`
+	Description   string  `json:"description"`
+	Status        string  `json:"status"`
+	Uptime        string  `json:"uptime"`
+	AutoStatus    bool    `json:"auto_status"`
+	Icon          string  `json:"icon"`
+	Bg            string  `json:"bg"`
+	ModelID       string  `json:"model_id,omitempty"`
+	Provider      string  `json:"provider,omitempty"`
+	MaxTokens     int     `json:"max_tokens,omitempty"`
+	ContextWindow int     `json:"context_window,omitempty"`
+	RateLimit     int     `json:"rate_limit,omitempty"`
+	TokenLimit    int     `json:"token_limit,omitempty"`
+	Price         float64 `json:"price,omitempty"`
 }
 
 // 服务列表响应
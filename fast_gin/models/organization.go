@@ -0,0 +1,436 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"macg/core"
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 组织与成员
+// 组织拥有自己的 API 密钥、钱包和用量，成员在组织内的权限由成员角色决定
+// ============================================================================
+
+// 组织成员角色
+const (
+	OrgRoleOwner   = "owner"   // 所有者，拥有组织内全部权限，可删除组织
+	OrgRoleAdmin   = "admin"   // 管理员，管理成员和 API 密钥
+	OrgRoleMember  = "member"  // 成员，使用和创建 API 密钥
+	OrgRoleBilling = "billing" // 财务，查看钱包和用量
+)
+
+// orgRolePermissions 组织角色在组织上下文中授予的权限，通配符规则同 PermissionImplies
+var orgRolePermissions = map[string][]string{
+	OrgRoleOwner:   {"*"},
+	OrgRoleAdmin:   {"org:read", "org:write", "member:manage", "apikey:manage", "wallet:read", "usage:read"},
+	OrgRoleMember:  {"org:read", "member:read", "apikey:read", "apikey:write", "usage:read"},
+	OrgRoleBilling: {"org:read", "member:read", "wallet:read", "usage:read"},
+}
+
+// orgScopedResources 在组织上下文中按成员角色判断的资源，其余资源只看全局角色
+var orgScopedResources = map[string]bool{
+	"org":    true,
+	"member": true,
+	"apikey": true,
+	"wallet": true,
+	"usage":  true,
+}
+
+var (
+	ErrOrganizationNotFound = errors.New("组织不存在")
+	ErrNotOrgMember         = errors.New("不是该组织的成员")
+	ErrInvalidOrgRole       = errors.New("无效的组织角色")
+	ErrLastOrgOwner         = errors.New("组织至少需要保留一名所有者")
+	ErrOrgOwnerRequired     = errors.New("只有所有者可以授予或变更所有者角色")
+	ErrOrgMemberExists      = errors.New("该用户已是组织成员")
+	ErrOrgSlugExists        = errors.New("组织标识已被使用")
+	ErrOrgLimitReached      = errors.New("创建的组织数量已达上限")
+)
+
+// Organization 组织
+type Organization struct {
+	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name        string         `gorm:"size:100;not null" json:"name"`
+	Slug        string         `gorm:"size:100;uniqueIndex;not null" json:"slug"` // URL 友好的唯一标识
+	Description string         `gorm:"size:500" json:"description"`
+	Status      string         `gorm:"size:20;default:'active'" json:"status"` // active, suspended
+	CreatedBy   uuid.UUID      `gorm:"type:uuid;index" json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// OrganizationMember 组织成员
+type OrganizationMember struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey" json:"organization_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	Role           string    `gorm:"size:20;not null;default:'member'" json:"role"` // owner, admin, member, billing
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// 关联
+	User         *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+}
+
+func (OrganizationMember) TableName() string {
+	return "organization_members"
+}
+
+// ValidOrgRole 判断是否为有效的组织角色
+func ValidOrgRole(role string) bool {
+	_, ok := orgRolePermissions[role]
+	return ok
+}
+
+// IsOrgScopedPermission 判断权限是否属于组织资源
+func IsOrgScopedPermission(permission string) bool {
+	resource, _, _ := strings.Cut(permission, ":")
+	return orgScopedResources[resource]
+}
+
+// OrgRoleHasPermission 判断组织角色是否授予指定权限，只对组织资源生效
+func OrgRoleHasPermission(role, permission string) bool {
+	if !IsOrgScopedPermission(permission) {
+		return false
+	}
+	for _, granted := range orgRolePermissions[role] {
+		if PermissionImplies(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+var slugDisallowed = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// normalizeSlug 转为小写字母、数字和连字符
+func normalizeSlug(slug string) string {
+	slug = slugDisallowed.ReplaceAllString(strings.ToLower(strings.TrimSpace(slug)), "-")
+	return strings.Trim(slug, "-")
+}
+
+// defaultMaxOrgsPerUser 未配置 organization.max_per_user 时每个用户最多创建的组织数
+const defaultMaxOrgsPerUser = 5
+
+// maxOrgsPerUser 每个用户最多创建的组织数
+func maxOrgsPerUser() int {
+	if n := core.Cfg.Org.MaxPerUser; n > 0 {
+		return n
+	}
+	return defaultMaxOrgsPerUser
+}
+
+// CreateOrganization 创建组织，创建者成为所有者
+func CreateOrganization(creatorID uuid.UUID, name, slug, description string) (*Organization, error) {
+	slug = normalizeSlug(slug)
+	if slug == "" {
+		return nil, errors.New("组织标识不能为空")
+	}
+
+	org := Organization{
+		Name:        name,
+		Slug:        slug,
+		Description: description,
+		Status:      "active",
+		CreatedBy:   creatorID,
+	}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		// 锁定创建者，并发创建时按顺序计数；已删除的组织也计入，防止删除后反复创建
+		if err := database.ForUpdate(tx).Select("id").First(&User{}, creatorID).Error; err != nil {
+			return err
+		}
+		var created int64
+		if err := tx.Unscoped().Model(&Organization{}).Where("created_by = ?", creatorID).Count(&created).Error; err != nil {
+			return err
+		}
+		if created >= int64(maxOrgsPerUser()) {
+			return ErrOrgLimitReached
+		}
+
+		var count int64
+		if err := tx.Unscoped().Model(&Organization{}).Where("slug = ?", slug).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrgSlugExists
+		}
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationID: org.ID,
+			UserID:         creatorID,
+			Role:           OrgRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrOrgSlugExists) || errors.Is(err, ErrOrgLimitReached) {
+			return nil, err
+		}
+		return nil, errors.New("创建组织失败：" + err.Error())
+	}
+	return &org, nil
+}
+
+// GetOrganizationByID 获取组织
+func GetOrganizationByID(id uuid.UUID) (*Organization, error) {
+	var org Organization
+	if err := database.GetDB().First(&org, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+// GetAllOrganizations 分页获取所有组织（平台管理员）
+func GetAllOrganizations(page, pageSize int) ([]Organization, int64, error) {
+	db := database.GetDB()
+	var orgs []Organization
+	var total int64
+
+	if err := db.Model(&Organization{}).Count(&total).Error; err != nil {
+		return nil, 0, errors.New("获取组织总数失败：" + err.Error())
+	}
+
+	offset := (page - 1) * pageSize
+	if err := db.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&orgs).Error; err != nil {
+		return nil, 0, errors.New("查询组织列表失败：" + err.Error())
+	}
+	return orgs, total, nil
+}
+
+// GetUserOrganizations 获取用户加入的组织及其成员角色
+func GetUserOrganizations(userID uuid.UUID) ([]OrganizationMember, error) {
+	var memberships []OrganizationMember
+	err := database.GetDB().
+		Joins("JOIN organizations ON organizations.id = organization_members.organization_id AND organizations.deleted_at IS NULL").
+		Preload("Organization").
+		Where("organization_members.user_id = ?", userID).
+		Order("organization_members.created_at").
+		Find(&memberships).Error
+	if err != nil {
+		return nil, errors.New("查询组织失败：" + err.Error())
+	}
+	return memberships, nil
+}
+
+// GetOrgMembership 获取用户在组织中的成员记录，不是成员时返回 ErrNotOrgMember
+func GetOrgMembership(orgID, userID uuid.UUID) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := database.GetDB().Where("organization_id = ? AND user_id = ?", orgID, userID).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotOrgMember
+		}
+		return nil, errors.New("查询组织成员失败：" + err.Error())
+	}
+	return &member, nil
+}
+
+// UpdateOrganization 更新组织名称和描述
+func UpdateOrganization(id uuid.UUID, name, description *string) (*Organization, error) {
+	org, err := GetOrganizationByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if name != nil {
+		updates["name"] = *name
+	}
+	if description != nil {
+		updates["description"] = *description
+	}
+	if len(updates) > 0 {
+		if err := database.GetDB().Model(org).Updates(updates).Error; err != nil {
+			return nil, errors.New("更新组织失败：" + err.Error())
+		}
+	}
+	return org, nil
+}
+
+// SetOrganizationStatus 启用或停用组织，停用后组织的 API 密钥无法使用
+func SetOrganizationStatus(id uuid.UUID, status string) (*Organization, error) {
+	if status != "active" && status != "suspended" {
+		return nil, errors.New("无效的组织状态")
+	}
+	org, err := GetOrganizationByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.GetDB().Model(org).Update("status", status).Error; err != nil {
+		return nil, errors.New("更新组织状态失败：" + err.Error())
+	}
+	return org, nil
+}
+
+// DeleteOrganization 删除组织（软删除），同时撤销组织的 API 密钥并移除所有成员
+func DeleteOrganization(id uuid.UUID) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&Organization{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationNotFound
+		}
+		if err := tx.Model(&APIKey{}).Where("organization_id = ?", id).Update("status", "revoked").Error; err != nil {
+			return err
+		}
+		return tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrOrganizationNotFound) {
+			return err
+		}
+		return errors.New("删除组织失败：" + err.Error())
+	}
+	return nil
+}
+
+// GetOrgMembers 获取组织成员列表
+func GetOrgMembers(orgID uuid.UUID) ([]OrganizationMember, error) {
+	var members []OrganizationMember
+	if err := database.GetDB().Preload("User").Where("organization_id = ?", orgID).
+		Order("created_at").Find(&members).Error; err != nil {
+		return nil, errors.New("查询组织成员失败：" + err.Error())
+	}
+	return members, nil
+}
+
+// AddOrgMember 添加组织成员，actorRole 为操作者的组织角色
+func AddOrgMember(orgID, userID uuid.UUID, role, actorRole string) (*OrganizationMember, error) {
+	if !ValidOrgRole(role) {
+		return nil, ErrInvalidOrgRole
+	}
+	if role == OrgRoleOwner && actorRole != OrgRoleOwner {
+		return nil, ErrOrgOwnerRequired
+	}
+	if _, err := GetUserByID(userID); err != nil {
+		return nil, err
+	}
+
+	member := OrganizationMember{OrganizationID: orgID, UserID: userID, Role: role}
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", orgID, userID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrOrgMemberExists
+		}
+		return tx.Create(&member).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrOrgMemberExists) {
+			return nil, err
+		}
+		return nil, errors.New("添加组织成员失败：" + err.Error())
+	}
+	return &member, nil
+}
+
+// UpdateOrgMemberRole 变更成员角色，所有者角色只能由所有者授予或变更，且至少保留一名所有者
+func UpdateOrgMemberRole(orgID, userID uuid.UUID, role, actorRole string) (*OrganizationMember, error) {
+	if !ValidOrgRole(role) {
+		return nil, ErrInvalidOrgRole
+	}
+
+	var member OrganizationMember
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := lockOrgMember(tx, orgID, userID, &member); err != nil {
+			return err
+		}
+		if (role == OrgRoleOwner || member.Role == OrgRoleOwner) && actorRole != OrgRoleOwner {
+			return ErrOrgOwnerRequired
+		}
+		if member.Role == OrgRoleOwner && role != OrgRoleOwner {
+			if err := ensureAnotherOwner(tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		member.Role = role
+		return tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", orgID, userID).Update("role", role).Error
+	})
+	if err != nil {
+		return nil, orgMemberError(err, "变更成员角色失败：")
+	}
+	return &member, nil
+}
+
+// RemoveOrgMember 移除组织成员（包括成员主动退出），不能移除最后一名所有者
+func RemoveOrgMember(orgID, userID uuid.UUID, actorRole string, self bool) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var member OrganizationMember
+		if err := lockOrgMember(tx, orgID, userID, &member); err != nil {
+			return err
+		}
+		if member.Role == OrgRoleOwner {
+			if !self && actorRole != OrgRoleOwner {
+				return ErrOrgOwnerRequired
+			}
+			if err := ensureAnotherOwner(tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&OrganizationMember{}).Error
+	})
+	return orgMemberError(err, "移除组织成员失败：")
+}
+
+// lockOrgMember 锁定成员记录
+func lockOrgMember(tx *gorm.DB, orgID, userID uuid.UUID, member *OrganizationMember) error {
+	err := database.ForUpdate(tx).Where("organization_id = ? AND user_id = ?", orgID, userID).First(member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotOrgMember
+	}
+	return err
+}
+
+// ensureAnotherOwner 确认除指定用户外还有其他所有者，锁定所有者行避免并发降级
+func ensureAnotherOwner(tx *gorm.DB, orgID, exceptUserID uuid.UUID) error {
+	var owners []OrganizationMember
+	if err := database.ForUpdate(tx).Where("organization_id = ? AND role = ? AND user_id <> ?", orgID, OrgRoleOwner, exceptUserID).
+		Find(&owners).Error; err != nil {
+		return err
+	}
+	if len(owners) == 0 {
+		return ErrLastOrgOwner
+	}
+	return nil
+}
+
+// orgMemberError 业务错误原样返回，数据库错误加上前缀
+func orgMemberError(err error, prefix string) error {
+	if err == nil {
+		return nil
+	}
+	for _, known := range []error{ErrNotOrgMember, ErrOrgOwnerRequired, ErrLastOrgOwner} {
+		if errors.Is(err, known) {
+			return err
+		}
+	}
+	return errors.New(prefix + err.Error())
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// 权限解析
+// resource:manage 包含该资源的所有操作；支持 * 和 resource:* 通配符。
+// 每个用户的有效权限集合带缓存，角色或角色权限变更时失效
+// ============================================================================
+
+// permissionCacheTTL 权限缓存有效期，兜底处理未经本进程的变更
+const permissionCacheTTL = 5 * time.Minute
+
+// PermissionActionManage 资源的完整管理权限
+const PermissionActionManage = "manage"
+
+// userPermissionSet 用户的权限集合
+type userPermissionSet struct {
+	granted   []string        // 角色直接授予的权限名（可能包含通配符）
+	effective map[string]bool // 展开后的有效权限名
+	expiresAt time.Time
+}
+
+var (
+	permissionCacheMu sync.RWMutex
+	permissionCache   = make(map[uuid.UUID]*userPermissionSet)
+)
+
+// PermissionImplies 判断已授予的权限是否包含所需权限
+func PermissionImplies(granted, required string) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+
+	grantedResource, grantedAction, ok := strings.Cut(granted, ":")
+	if !ok {
+		return false
+	}
+	requiredResource, _, ok := strings.Cut(required, ":")
+	if !ok || grantedResource != requiredResource {
+		return false
+	}
+	return grantedAction == "*" || grantedAction == PermissionActionManage
+}
+
+// loadUserPermissionSet 从数据库加载并展开用户的权限集合
+func loadUserPermissionSet(userID uuid.UUID) (*userPermissionSet, error) {
+	permissions, err := GetUserPermissions(userID)
+	if err != nil {
+		return nil, err
+	}
+	all, err := GetAllPermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &userPermissionSet{
+		effective: make(map[string]bool),
+		expiresAt: time.Now().Add(permissionCacheTTL),
+	}
+	for _, perm := range permissions {
+		set.granted = append(set.granted, perm.Name)
+		set.effective[perm.Name] = true
+	}
+	for _, perm := range all {
+		for _, granted := range set.granted {
+			if PermissionImplies(granted, perm.Name) {
+				set.effective[perm.Name] = true
+				break
+			}
+		}
+	}
+	return set, nil
+}
+
+// getUserPermissionSet 获取用户的权限集合，优先读取缓存
+func getUserPermissionSet(userID uuid.UUID) (*userPermissionSet, error) {
+	permissionCacheMu.RLock()
+	set, ok := permissionCache[userID]
+	permissionCacheMu.RUnlock()
+	if ok && time.Now().Before(set.expiresAt) {
+		return set, nil
+	}
+
+	set, err := loadUserPermissionSet(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissionCacheMu.Lock()
+	permissionCache[userID] = set
+	permissionCacheMu.Unlock()
+	return set, nil
+}
+
+// GetUserEffectivePermissions 获取用户展开后的有效权限名，按名称排序
+func GetUserEffectivePermissions(userID uuid.UUID) ([]string, error) {
+	set, err := getUserPermissionSet(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(set.effective))
+	for name := range set.effective {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// InvalidateUserPermissions 清除指定用户的权限缓存
+func InvalidateUserPermissions(userID uuid.UUID) {
+	permissionCacheMu.Lock()
+	delete(permissionCache, userID)
+	permissionCacheMu.Unlock()
+}
+
+// InvalidateAllPermissions 清除所有用户的权限缓存，角色权限变更时使用
+func InvalidateAllPermissions() {
+	permissionCacheMu.Lock()
+	permissionCache = make(map[uuid.UUID]*userPermissionSet)
+	permissionCacheMu.Unlock()
+}
@@ -0,0 +1,352 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 服务定价
+// 每次调价新增一条 ServicePrice 版本，按 EffectiveFrom 选择生效价格；
+// 未配置价格版本的服务沿用 ServiceModel.Price 作为输入、输出和缓存单价
+// ============================================================================
+
+// ServicePrice 服务价格版本（单价均为每1000 Token）
+type ServicePrice struct {
+	ID               uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServiceID        uuid.UUID  `gorm:"type:uuid;not null;index:idx_service_price_effective" json:"service_id"`
+	InputPrice       float64    `gorm:"type:decimal(12,6);default:0" json:"input_price"`        // 输入单价
+	OutputPrice      float64    `gorm:"type:decimal(12,6);default:0" json:"output_price"`       // 输出单价
+	CachedInputPrice float64    `gorm:"type:decimal(12,6);default:0" json:"cached_input_price"` // 命中缓存的输入单价
+	EffectiveFrom    time.Time  `gorm:"not null;index:idx_service_price_effective" json:"effective_from"`
+	Note             string     `gorm:"size:500" json:"note"`
+	CreatedBy        *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+
+	// 关联
+	Tiers []PriceTier `gorm:"foreignKey:PriceID;constraint:OnDelete:CASCADE" json:"tiers"`
+}
+
+func (ServicePrice) TableName() string {
+	return "service_prices"
+}
+
+func (p *ServicePrice) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// PriceTier 阶梯价格：用户当月在该服务的用量达到 MinTokens 后使用该档单价
+type PriceTier struct {
+	ID               uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	PriceID          uuid.UUID `gorm:"type:uuid;index;not null" json:"price_id"`
+	MinTokens        int64     `gorm:"not null" json:"min_tokens"`
+	InputPrice       float64   `gorm:"type:decimal(12,6);default:0" json:"input_price"`
+	OutputPrice      float64   `gorm:"type:decimal(12,6);default:0" json:"output_price"`
+	CachedInputPrice float64   `gorm:"type:decimal(12,6);default:0" json:"cached_input_price"`
+}
+
+func (PriceTier) TableName() string {
+	return "price_tiers"
+}
+
+func (t *PriceTier) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// Rates 实际计费使用的单价
+type Rates struct {
+	Input       float64
+	Output      float64
+	CachedInput float64
+}
+
+// Cost 按单价计算花费，cachedTokens 为 inputTokens 中命中缓存的部分，超出 [0, inputTokens] 时截断
+func (r Rates) Cost(inputTokens, outputTokens, cachedTokens int) float64 {
+	cachedTokens = max(0, min(cachedTokens, inputTokens))
+	return float64(inputTokens-cachedTokens)/1000*r.Input +
+		float64(cachedTokens)/1000*r.CachedInput +
+		float64(outputTokens)/1000*r.Output
+}
+
+// ratesFor 根据当月用量选择阶梯单价：门槛不超过用量的最高一档，未达到任何门槛时使用基础单价
+func (p *ServicePrice) ratesFor(volume int64) Rates {
+	rates := Rates{Input: p.InputPrice, Output: p.OutputPrice, CachedInput: p.CachedInputPrice}
+	var threshold int64
+	for _, tier := range p.Tiers {
+		if volume >= tier.MinTokens && tier.MinTokens > threshold {
+			threshold = tier.MinTokens
+			rates = Rates{Input: tier.InputPrice, Output: tier.OutputPrice, CachedInput: tier.CachedInputPrice}
+		}
+	}
+	return rates
+}
+
+// legacyRates 未配置价格版本时使用服务的统一单价
+func legacyRates(service *ServiceModel) Rates {
+	return Rates{Input: service.Price, Output: service.Price, CachedInput: service.Price}
+}
+
+// ============================================================================
+// 价格版本操作
+// ============================================================================
+
+// CreateServicePrice 新增价格版本，effectiveFrom 为空时立即生效
+func CreateServicePrice(serviceID uuid.UUID, inputPrice, outputPrice, cachedInputPrice float64, effectiveFrom *time.Time, tiers []PriceTier, note string, createdBy *uuid.UUID) (*ServicePrice, error) {
+	db := database.GetDB()
+
+	if _, err := GetServiceByID(serviceID); err != nil {
+		return nil, err
+	}
+	if inputPrice < 0 || outputPrice < 0 || cachedInputPrice < 0 {
+		return nil, errors.New("价格不能为负数")
+	}
+
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinTokens < tiers[j].MinTokens })
+	for i := range tiers {
+		tiers[i].ID = uuid.Nil
+		if tiers[i].MinTokens <= 0 {
+			return nil, errors.New("阶梯用量门槛必须大于0")
+		}
+	}
+
+	price := ServicePrice{
+		ServiceID:        serviceID,
+		InputPrice:       inputPrice,
+		OutputPrice:      outputPrice,
+		CachedInputPrice: cachedInputPrice,
+		EffectiveFrom:    time.Now(),
+		Note:             note,
+		CreatedBy:        createdBy,
+		Tiers:            tiers,
+	}
+	if effectiveFrom != nil {
+		price.EffectiveFrom = *effectiveFrom
+	}
+
+	if err := db.Create(&price).Error; err != nil {
+		return nil, errors.New("创建价格版本失败：" + err.Error())
+	}
+	return &price, nil
+}
+
+// GetServicePrices 获取服务的全部价格版本（按生效时间倒序）
+func GetServicePrices(serviceID uuid.UUID) ([]ServicePrice, error) {
+	db := database.GetDB()
+	var prices []ServicePrice
+	if err := db.Preload("Tiers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("min_tokens ASC")
+	}).Where("service_id = ?", serviceID).Order("effective_from DESC").Find(&prices).Error; err != nil {
+		return nil, errors.New("查询价格版本失败：" + err.Error())
+	}
+	return prices, nil
+}
+
+// GetEffectivePrice 获取指定时间生效的价格版本，未配置时返回 nil
+func GetEffectivePrice(serviceID uuid.UUID, at time.Time) (*ServicePrice, error) {
+	db := database.GetDB()
+	var price ServicePrice
+	err := db.Preload("Tiers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("min_tokens ASC")
+	}).Where("service_id = ? AND effective_from <= ?", serviceID, at).Order("effective_from DESC").First(&price).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.New("查询生效价格失败：" + err.Error())
+	}
+	return &price, nil
+}
+
+// ============================================================================
+// 计费
+// ============================================================================
+
+// monthStart 返回所在自然月的第一天
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// monthlyVolume 统计用户当月在服务上截至 before 的 Token 用量
+func monthlyVolume(userID, serviceID uuid.UUID, before time.Time) (int64, error) {
+	db := database.GetDB()
+	var volume int64
+	if err := db.Model(&TokenUsageRecord{}).
+		Select("COALESCE(SUM(total_tokens), 0)").
+		Where("user_id = ? AND service_id = ? AND created_at >= ? AND created_at < ?", userID, serviceID, monthStart(before), before).
+		Scan(&volume).Error; err != nil {
+		return 0, errors.New("统计当月用量失败：" + err.Error())
+	}
+	return volume, nil
+}
+
+// GetServiceRates 获取指定时间、指定用量下的计费单价
+func GetServiceRates(service *ServiceModel, at time.Time, volume int64) (Rates, error) {
+	price, err := GetEffectivePrice(service.ID, at)
+	if err != nil {
+		return Rates{}, err
+	}
+	if price == nil {
+		return legacyRates(service), nil
+	}
+	return price.ratesFor(volume), nil
+}
+
+// CalculateUsageCost 计算用户一次调用的花费，阶梯价格按用户当月已用量确定
+func CalculateUsageCost(service *ServiceModel, userID uuid.UUID, inputTokens, outputTokens, cachedTokens int, at time.Time) (float64, error) {
+	price, err := GetEffectivePrice(service.ID, at)
+	if err != nil {
+		return 0, err
+	}
+	if price == nil {
+		return legacyRates(service).Cost(inputTokens, outputTokens, cachedTokens), nil
+	}
+
+	var volume int64
+	if len(price.Tiers) > 0 {
+		if volume, err = monthlyVolume(userID, service.ID, at); err != nil {
+			return 0, err
+		}
+	}
+	return price.ratesFor(volume).Cost(inputTokens, outputTokens, cachedTokens), nil
+}
+
+// EstimateCost 按当前基础单价估算花费上限（不考虑阶梯折扣），用于预扣
+func EstimateCost(service *ServiceModel, inputTokens, outputTokens int) (float64, error) {
+	rates, err := GetServiceRates(service, time.Now(), 0)
+	if err != nil {
+		return 0, err
+	}
+	return rates.Cost(inputTokens, outputTokens, 0), nil
+}
+
+// ============================================================================
+// 花费重算
+// ============================================================================
+
+// RecomputeResult 花费重算结果
+type RecomputeResult struct {
+	Records  int              `json:"records"`   // 重算的记录数
+	Changed  int              `json:"changed"`   // 花费发生变化的记录数
+	OldTotal float64          `json:"old_total"` // 重算前总花费
+	NewTotal float64          `json:"new_total"` // 重算后总花费
+	Deltas   []RecomputeDelta `json:"deltas"`    // 按钱包归属汇总的花费差额
+}
+
+// RecomputeDelta 单个钱包的花费差额，组织密钥产生的记录计入组织钱包
+type RecomputeDelta struct {
+	OwnerType string    `json:"owner_type"`
+	OwnerID   uuid.UUID `json:"owner_id"`
+	Amount    float64   `json:"amount"` // 新 - 旧
+}
+
+// RecomputeUsageCosts 按当时生效的价格重算时间范围内的调用花费
+// serviceID 为空时重算全部服务；adjustWallets 为 true 时将差额计入记录所属的用户或组织钱包
+func RecomputeUsageCosts(serviceID *uuid.UUID, start, end time.Time, adjustWallets bool, operatorID *uuid.UUID) (*RecomputeResult, error) {
+	db := database.GetDB()
+
+	query := db.Where("service_id IS NOT NULL AND created_at >= ? AND created_at < ?", start, end)
+	if serviceID != nil {
+		query = query.Where("service_id = ?", *serviceID)
+	}
+	var records []TokenUsageRecord
+	if err := query.Order("created_at ASC").Find(&records).Error; err != nil {
+		return nil, errors.New("查询调用记录失败：" + err.Error())
+	}
+
+	result := &RecomputeResult{Deltas: []RecomputeDelta{}}
+	// 钱包归属 -> result.Deltas 下标
+	deltaIndex := map[RecomputeDelta]int{}
+	services := map[uuid.UUID]*ServiceModel{}
+	// 用户+服务+月份 -> 当月累计用量，首次遇到时查询范围开始前的用量
+	type volumeKey struct {
+		userID, serviceID uuid.UUID
+		month             time.Time
+	}
+	volumes := map[volumeKey]int64{}
+
+	// 记录更新与钱包调整在同一事务中，中途失败时全部回滚，避免重跑时重复调整余额
+	err := database.Transaction(func(tx *gorm.DB) error {
+		for i := range records {
+			r := &records[i]
+
+			service, ok := services[*r.ServiceID]
+			if !ok {
+				var s ServiceModel
+				if err := tx.Unscoped().First(&s, *r.ServiceID).Error; err != nil {
+					return errors.New("查询服务失败：" + err.Error())
+				}
+				service = &s
+				services[s.ID] = service
+			}
+
+			key := volumeKey{r.UserID, service.ID, monthStart(r.CreatedAt)}
+			volume, ok := volumes[key]
+			if !ok {
+				v, err := monthlyVolume(r.UserID, service.ID, r.CreatedAt)
+				if err != nil {
+					return err
+				}
+				volume = v
+			}
+			volumes[key] = volume + int64(r.TotalTokens)
+
+			rates, err := GetServiceRates(service, r.CreatedAt, volume)
+			if err != nil {
+				return err
+			}
+			cost := rates.Cost(r.InputTokens, r.OutputTokens, r.CachedTokens)
+
+			result.Records++
+			result.OldTotal += r.Cost
+			result.NewTotal += cost
+			if math.Abs(cost-r.Cost) < 1e-6 {
+				continue
+			}
+
+			if err := tx.Model(r).Update("cost", cost).Error; err != nil {
+				return errors.New("更新调用花费失败：" + err.Error())
+			}
+			result.Changed++
+
+			owner := RecomputeDelta{OwnerType: WalletOwnerUser, OwnerID: r.UserID}
+			if r.OrganizationID != nil {
+				owner = RecomputeDelta{OwnerType: WalletOwnerOrganization, OwnerID: *r.OrganizationID}
+			}
+			idx, ok := deltaIndex[owner]
+			if !ok {
+				idx = len(result.Deltas)
+				deltaIndex[owner] = idx
+				result.Deltas = append(result.Deltas, owner)
+			}
+			result.Deltas[idx].Amount += cost - r.Cost
+		}
+
+		if !adjustWallets {
+			return nil
+		}
+		for _, delta := range result.Deltas {
+			if err := adjustWallet(tx, delta.OwnerType, delta.OwnerID, -delta.Amount, "价格修正重算", operatorID); err != nil {
+				return errors.New("调整余额失败：" + err.Error())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"macg/database/dbtest"
+
+	"github.com/google/uuid"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRatesCost(t *testing.T) {
+	rates := Rates{Input: 1, Output: 2, CachedInput: 0.25}
+
+	cases := []struct {
+		name                  string
+		input, output, cached int
+		want                  float64
+	}{
+		{"no cache", 1000, 500, 0, 1 + 1},
+		{"partial cache", 1000, 0, 400, 0.6 + 0.1},
+		{"all cached", 2000, 1000, 2000, 0.5 + 2},
+		{"cached clamped to input", 1000, 0, 5000, 0.25},
+		{"negative cached ignored", 1000, 0, -100, 1},
+		{"zero tokens", 0, 0, 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rates.Cost(tc.input, tc.output, tc.cached); !approxEqual(got, tc.want) {
+				t.Errorf("Cost(%d, %d, %d) = %v, want %v", tc.input, tc.output, tc.cached, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRatesForTiers(t *testing.T) {
+	price := &ServicePrice{
+		InputPrice: 3, OutputPrice: 6, CachedInputPrice: 1,
+		// 故意乱序，选择不依赖加载顺序
+		Tiers: []PriceTier{
+			{MinTokens: 10_000_000, InputPrice: 1, OutputPrice: 2, CachedInputPrice: 0.2},
+			{MinTokens: 1_000_000, InputPrice: 2, OutputPrice: 4, CachedInputPrice: 0.5},
+		},
+	}
+
+	cases := []struct {
+		volume int64
+		want   Rates
+	}{
+		{0, Rates{Input: 3, Output: 6, CachedInput: 1}},
+		{999_999, Rates{Input: 3, Output: 6, CachedInput: 1}},
+		{1_000_000, Rates{Input: 2, Output: 4, CachedInput: 0.5}},
+		{9_999_999, Rates{Input: 2, Output: 4, CachedInput: 0.5}},
+		{10_000_000, Rates{Input: 1, Output: 2, CachedInput: 0.2}},
+		{50_000_000, Rates{Input: 1, Output: 2, CachedInput: 0.2}},
+	}
+	for _, tc := range cases {
+		if got := price.ratesFor(tc.volume); got != tc.want {
+			t.Errorf("ratesFor(%d) = %+v, want %+v", tc.volume, got, tc.want)
+		}
+	}
+
+	if got := (&ServicePrice{InputPrice: 3, OutputPrice: 6}).ratesFor(1 << 40); got != (Rates{Input: 3, Output: 6}) {
+		t.Errorf("ratesFor without tiers = %+v", got)
+	}
+}
+
+func TestCalculateUsageCostPriceHistory(t *testing.T) {
+	db := dbtest.Open(t, &ServiceModel{}, &ServicePrice{}, &PriceTier{}, &TokenUsageRecord{})
+	service := &ServiceModel{ID: uuid.New(), Name: "test", ModelID: "test-model", Price: 5}
+	if err := db.Create(service).Error; err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local) // 月中，避免跨月影响当月用量
+
+	// 未配置价格版本时沿用服务统一单价
+	cost, err := CalculateUsageCost(service, userID, 1000, 1000, 0, now)
+	if err != nil || !approxEqual(cost, 10) {
+		t.Fatalf("legacy cost = %v, %v; want 10", cost, err)
+	}
+
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	if _, err := CreateServicePrice(service.ID, 1, 2, 0.5, &past, []PriceTier{{MinTokens: 5000, InputPrice: 0.5, OutputPrice: 1}}, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateServicePrice(service.ID, 100, 100, 100, &future, nil, "尚未生效", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// 当前生效的是过去的版本，用量未达到阶梯门槛
+	cost, err = CalculateUsageCost(service, userID, 1000, 1000, 200, now)
+	if err != nil || !approxEqual(cost, 0.8+0.1+2) {
+		t.Fatalf("base tier cost = %v, %v; want 2.9", cost, err)
+	}
+
+	// 当月用量达到门槛后使用阶梯单价
+	if err := db.Create(&TokenUsageRecord{UserID: userID, ServiceID: &service.ID, InputTokens: 4000, OutputTokens: 2000, CreatedAt: now.Add(-time.Minute)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	cost, err = CalculateUsageCost(service, userID, 1000, 1000, 0, now)
+	if err != nil || !approxEqual(cost, 0.5+1) {
+		t.Fatalf("volume tier cost = %v, %v; want 1.5", cost, err)
+	}
+
+	// 生效时间之后使用新版本
+	cost, err = CalculateUsageCost(service, userID, 1000, 0, 0, future.Add(time.Minute))
+	if err != nil || !approxEqual(cost, 100) {
+		t.Fatalf("future version cost = %v, %v; want 100", cost, err)
+	}
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"macg/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// 限流令牌桶（数据库存储，多实例共享）
+// ============================================================================
+
+// RateLimitBucket 令牌桶状态
+type RateLimitBucket struct {
+	BucketKey string    `gorm:"size:200;primaryKey" json:"bucket_key"` // 例如 key:<id>:rpm
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `gorm:"index" json:"updated_at"`
+}
+
+func (RateLimitBucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// UpdateRateLimitBucket 在行锁内读取并更新令牌桶
+// 桶不存在时以 initial 个令牌创建；fn 原地修改令牌数和更新时间
+func UpdateRateLimitBucket(key string, initial float64, fn func(tokens *float64, updatedAt *time.Time)) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&RateLimitBucket{BucketKey: key, Tokens: initial, UpdatedAt: now}).Error; err != nil {
+			return err
+		}
+
+		var b RateLimitBucket
+		if err := database.ForUpdate(tx).Where("bucket_key = ?", key).First(&b).Error; err != nil {
+			return err
+		}
+
+		fn(&b.Tokens, &b.UpdatedAt)
+
+		return tx.Model(&RateLimitBucket{}).Where("bucket_key = ?", key).
+			Updates(map[string]interface{}{"tokens": b.Tokens, "updated_at": b.UpdatedAt}).Error
+	})
+	if err != nil {
+		return errors.New("更新限流令牌桶失败：" + err.Error())
+	}
+	return nil
+}
+
+// PruneRateLimitBuckets 清理指定时间之前未更新的令牌桶
+func PruneRateLimitBuckets(before time.Time) (int64, error) {
+	db := database.GetDB()
+	result := db.Where("updated_at < ?", before).Delete(&RateLimitBucket{})
+	if result.Error != nil {
+		return 0, errors.New("清理限流令牌桶失败：" + result.Error.Error())
+	}
+	return result.RowsAffected, nil
+}
@@ -21,7 +21,8 @@ type Role struct {
 	Name        string         `gorm:"uniqueIndex;size:50;not null" json:"name"` // super_admin, admin, user, guest
 	DisplayName string         `gorm:"size:100" json:"display_name"`             // 超级管理员, 管理员, 普通用户, 访客
 	Description string         `gorm:"size:500" json:"description"`
-	IsSystem    bool           `gorm:"default:false" json:"is_system"` // 系统内置角色不可删除
+	IsSystem    bool           `gorm:"default:false" json:"is_system"`   // 系统内置角色不可删除
+	Require2FA  bool           `gorm:"default:false" json:"require_2fa"` // 拥有该角色的用户必须启用双因素认证
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
@@ -172,6 +173,7 @@ func AssignPermissionsToRole(roleID uuid.UUID, permissionIDs []uuid.UUID) error
 		return errors.New("分配权限失败：" + err.Error())
 	}
 
+	InvalidateAllPermissions()
 	return nil
 }
 
@@ -196,6 +198,7 @@ func CreatePermission(name, displayName, description, resource, action string) (
 		return nil, errors.New("创建权限失败：" + err.Error())
 	}
 
+	InvalidateAllPermissions()
 	return &permission, nil
 }
 
@@ -227,6 +230,139 @@ func AssignRolesToUser(userID uuid.UUID, roleIDs []uuid.UUID) error {
 		return errors.New("分配角色失败：" + err.Error())
 	}
 
+	InvalidateUserPermissions(userID)
+	return nil
+}
+
+// ErrSystemRole 系统内置角色不可修改或删除
+var ErrSystemRole = errors.New("系统内置角色不可修改或删除")
+
+// UpdateRole 更新自定义角色的显示名称和描述
+func UpdateRole(id uuid.UUID, displayName, description string) (*Role, error) {
+	db := database.GetDB()
+
+	role, err := GetRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if role.IsSystem {
+		return nil, ErrSystemRole
+	}
+
+	updates := map[string]interface{}{"display_name": displayName, "description": description}
+	if err := db.Model(role).Updates(updates).Error; err != nil {
+		return nil, errors.New("更新角色失败：" + err.Error())
+	}
+
+	return role, nil
+}
+
+// UpdateRolePermissions 替换自定义角色的权限集合
+func UpdateRolePermissions(id uuid.UUID, permissionIDs []uuid.UUID) (*Role, error) {
+	role, err := GetRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if role.IsSystem {
+		return nil, ErrSystemRole
+	}
+
+	if err := AssignPermissionsToRole(id, permissionIDs); err != nil {
+		return nil, err
+	}
+
+	return GetRoleByID(id)
+}
+
+// DeleteRole 删除自定义角色，同时解除其与用户和权限的关联
+func DeleteRole(id uuid.UUID) error {
+	role, err := GetRoleByID(id)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return ErrSystemRole
+	}
+
+	err = database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(role).Error
+	})
+	if err != nil {
+		return errors.New("删除角色失败：" + err.Error())
+	}
+
+	InvalidateAllPermissions()
+	return nil
+}
+
+// SetRoleTwoFactorPolicy 设置角色是否要求双因素认证，系统内置角色同样适用
+func SetRoleTwoFactorPolicy(id uuid.UUID, require bool) (*Role, error) {
+	db := database.GetDB()
+
+	role, err := GetRoleByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Model(role).Update("require_2fa", require).Error; err != nil {
+		return nil, errors.New("更新角色双因素认证策略失败：" + err.Error())
+	}
+	role.Require2FA = require
+
+	return role, nil
+}
+
+// GetUserRoles 获取用户的角色列表
+func GetUserRoles(userID uuid.UUID) ([]Role, error) {
+	db := database.GetDB()
+
+	var user User
+	if err := db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return nil, errors.New("用户不存在")
+	}
+
+	return user.Roles, nil
+}
+
+// AddRoleToUser 为用户追加一个角色
+func AddRoleToUser(userID, roleID uuid.UUID) error {
+	db := database.GetDB()
+
+	var user User
+	if err := db.First(&user, userID).Error; err != nil {
+		return errors.New("用户不存在")
+	}
+	role, err := GetRoleByID(roleID)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Model(&user).Association("Roles").Append(role); err != nil {
+		return errors.New("分配角色失败：" + err.Error())
+	}
+
+	InvalidateUserPermissions(userID)
+	return nil
+}
+
+// RemoveRoleFromUser 解除用户的一个角色
+func RemoveRoleFromUser(userID, roleID uuid.UUID) error {
+	db := database.GetDB()
+
+	result := db.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&UserRole{})
+	if result.Error != nil {
+		return errors.New("解除角色失败：" + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用户未拥有该角色")
+	}
+
+	InvalidateUserPermissions(userID)
 	return nil
 }
 
@@ -255,14 +391,18 @@ func GetUserPermissions(userID uuid.UUID) ([]Permission, error) {
 }
 
 // UserHasPermission 检查用户是否拥有指定权限
+// resource:manage、resource:* 和 * 视为包含对应的具体权限
 func UserHasPermission(userID uuid.UUID, permissionName string) (bool, error) {
-	permissions, err := GetUserPermissions(userID)
+	set, err := getUserPermissionSet(userID)
 	if err != nil {
 		return false, err
 	}
 
-	for _, perm := range permissions {
-		if perm.Name == permissionName {
+	if set.effective[permissionName] {
+		return true, nil
+	}
+	for _, granted := range set.granted {
+		if PermissionImplies(granted, permissionName) {
 			return true, nil
 		}
 	}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 网关转发记录
+// ============================================================================
+
+// RelayAttempt 单次请求的渠道尝试记录，通过 RequestID 与 TokenUsageRecord 关联
+type RelayAttempt struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	RequestID  string     `gorm:"size:100;index;not null" json:"request_id"`
+	ServiceID  uuid.UUID  `gorm:"type:uuid;index" json:"service_id"`
+	ChannelID  *uuid.UUID `gorm:"type:uuid;index" json:"channel_id"` // 为空表示使用配置文件中的默认上游
+	Attempt    int        `gorm:"default:1" json:"attempt"`          // 第几次尝试
+	StatusCode int        `json:"status_code"`                       // 上游状态码，网络错误时为0
+	Decision   string     `gorm:"size:20" json:"decision"`           // success, failover, ejected, abort
+	Error      string     `gorm:"size:1000" json:"error"`
+	LatencyMs  int64      `json:"latency_ms"`
+	CreatedAt  time.Time  `gorm:"index" json:"created_at"`
+}
+
+func (RelayAttempt) TableName() string {
+	return "relay_attempts"
+}
+
+func (r *RelayAttempt) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// truncateRunes 按字符截断，避免切断多字节字符产生非法 UTF-8
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+// RecordRelayAttempt 记录一次渠道尝试
+func RecordRelayAttempt(attempt *RelayAttempt) error {
+	db := database.GetDB()
+
+	attempt.Error = truncateRunes(attempt.Error, 1000)
+
+	if err := db.Create(attempt).Error; err != nil {
+		return errors.New("记录转发尝试失败：" + err.Error())
+	}
+	return nil
+}
+
+// GetRelayAttempts 获取某次请求的全部尝试记录
+func GetRelayAttempts(requestID string) ([]RelayAttempt, error) {
+	db := database.GetDB()
+	var attempts []RelayAttempt
+	if err := db.Where("request_id = ?", requestID).Order("attempt ASC").Find(&attempts).Error; err != nil {
+		return nil, errors.New("查询转发记录失败：" + err.Error())
+	}
+	return attempts, nil
+}
@@ -13,22 +13,33 @@ import (
 
 // Service AI服务模型
 type ServiceModel struct {
-	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Name        string         `gorm:"size:200;not null" json:"name"`
-	Description string         `gorm:"size:1000" json:"description"`
-	Status      string         `gorm:"size:50;default:'active'" json:"status"` // active, maintenance, inactive
-	Uptime      string         `gorm:"size:20;default:'99.99%'" json:"uptime"`
-	Icon        string         `gorm:"size:50;default:'server'" json:"icon"`
-	Bg          string         `gorm:"size:100;default:'bg-purple-500/10'" json:"bg"`
-	ModelID     string         `gorm:"size:100" json:"model_id"`                  // 关联的AI模型ID
-	MaxTokens   int            `gorm:"default:4096" json:"max_tokens"`            // 最大Token数
-	RateLimit   int            `gorm:"default:100" json:"rate_limit"`             // 请求频率限制
-	Price       float64        `gorm:"type:decimal(10,4);default:0" json:"price"` // 每1000 Token价格
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name          string         `gorm:"size:200;not null" json:"name"`
+	Description   string         `gorm:"size:1000" json:"description"`
+	Status        string         `gorm:"size:50;default:'active'" json:"status"` // active, maintenance, inactive
+	Uptime        string         `gorm:"size:20;default:'99.99%'" json:"uptime"`
+	AutoStatus    bool           `gorm:"default:true" json:"auto_status"` // 是否由健康探测自动维护状态
+	Icon          string         `gorm:"size:50;default:'server'" json:"icon"`
+	Bg            string         `gorm:"size:100;default:'bg-purple-500/10'" json:"bg"`
+	ModelID       string         `gorm:"size:100" json:"model_id"`                  // 关联的AI模型ID
+	Provider      string         `gorm:"size:50;default:'openai'" json:"provider"`  // 上游厂商：openai, anthropic, gemini
+	MaxTokens     int            `gorm:"default:4096" json:"max_tokens"`            // 最大Token数
+	ContextWindow int            `gorm:"default:0" json:"context_window"`           // 上下文窗口大小，0表示未知
+	RateLimit     int            `gorm:"default:100" json:"rate_limit"`             // 请求频率限制（每分钟请求数）
+	TokenLimit    int            `gorm:"default:0" json:"token_limit"`              // 每分钟Token数限制，0表示不限制
+	Price         float64        `gorm:"type:decimal(10,4);default:0" json:"price"` // 每1000 Token价格
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// 服务状态
+const (
+	ServiceStatusActive      = "active"
+	ServiceStatusMaintenance = "maintenance"
+	ServiceStatusInactive    = "inactive"
+)
+
 // TableName 指定表名
 func (ServiceModel) TableName() string {
 	return "services"
@@ -43,7 +54,7 @@ func (s *ServiceModel) BeforeCreate(tx *gorm.DB) error {
 }
 
 // CreateService 创建服务
-func CreateService(name, description, status, icon, bg, modelID string, maxTokens, rateLimit int, price float64) (*ServiceModel, error) {
+func CreateService(name, description, status, icon, bg, modelID, provider string, maxTokens, contextWindow, rateLimit int, price float64) (*ServiceModel, error) {
 	db := database.GetDB()
 
 	if status == "" {
@@ -55,18 +66,24 @@ func CreateService(name, description, status, icon, bg, modelID string, maxToken
 	if bg == "" {
 		bg = "bg-purple-500/10"
 	}
+	if provider == "" {
+		provider = "openai"
+	}
 
 	service := ServiceModel{
-		Name:        name,
-		Description: description,
-		Status:      status,
-		Uptime:      "99.99%",
-		Icon:        icon,
-		Bg:          bg,
-		ModelID:     modelID,
-		MaxTokens:   maxTokens,
-		RateLimit:   rateLimit,
-		Price:       price,
+		Name:          name,
+		Description:   description,
+		Status:        status,
+		Uptime:        "99.99%",
+		AutoStatus:    true,
+		Icon:          icon,
+		Bg:            bg,
+		ModelID:       modelID,
+		Provider:      provider,
+		MaxTokens:     maxTokens,
+		ContextWindow: contextWindow,
+		RateLimit:     rateLimit,
+		Price:         price,
 	}
 
 	if err := db.Create(&service).Error; err != nil {
@@ -107,6 +124,49 @@ func GetServiceByID(id uuid.UUID) (*ServiceModel, error) {
 	return &service, nil
 }
 
+// GetActiveServiceByModelID 根据模型ID获取可用的服务
+func GetActiveServiceByModelID(modelID string) (*ServiceModel, error) {
+	db := database.GetDB()
+	var service ServiceModel
+	if err := db.Where("model_id = ? AND LOWER(status) = ?", modelID, ServiceStatusActive).First(&service).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("模型不存在或不可用")
+		}
+		return nil, err
+	}
+	return &service, nil
+}
+
+// GetActiveServices 获取所有可用的服务
+func GetActiveServices() ([]ServiceModel, error) {
+	db := database.GetDB()
+	var services []ServiceModel
+	if err := db.Where("LOWER(status) = ?", ServiceStatusActive).Order("created_at ASC").Find(&services).Error; err != nil {
+		return nil, errors.New("查询服务列表失败：" + err.Error())
+	}
+	return services, nil
+}
+
+// ModelObject 转换为 /v1/models 的模型信息
+func (s *ServiceModel) ModelObject(rates Rates) ModelObject {
+	return ModelObject{
+		ID:            s.ModelID,
+		Object:        "model",
+		Created:       s.CreatedAt.Unix(),
+		OwnedBy:       s.Provider,
+		Name:          s.Name,
+		Description:   s.Description,
+		ContextWindow: s.ContextWindow,
+		MaxTokens:     s.MaxTokens,
+		Pricing: ModelPricing{
+			Prompt:       rates.Input,
+			Completion:   rates.Output,
+			CachedPrompt: rates.CachedInput,
+			Unit:         "1K tokens",
+		},
+	}
+}
+
 // UpdateService 更新服务
 func UpdateService(id uuid.UUID, updates map[string]interface{}) (*ServiceModel, error) {
 	db := database.GetDB()
@@ -119,6 +179,25 @@ func UpdateService(id uuid.UUID, updates map[string]interface{}) (*ServiceModel,
 		return nil, err
 	}
 
+	// 只允许更新以下字段
+	allowed := map[string]bool{
+		"name": true, "description": true, "status": true, "auto_status": true, "icon": true, "bg": true,
+		"model_id": true, "provider": true, "max_tokens": true, "context_window": true,
+		"rate_limit": true, "token_limit": true, "price": true,
+	}
+	for k := range updates {
+		if !allowed[k] {
+			delete(updates, k)
+		}
+	}
+	if v, ok := updates["status"]; ok {
+		switch v {
+		case ServiceStatusActive, ServiceStatusMaintenance, ServiceStatusInactive:
+		default:
+			return nil, errors.New("无效的服务状态")
+		}
+	}
+
 	if err := db.Model(&service).Updates(updates).Error; err != nil {
 		return nil, errors.New("更新服务失败：" + err.Error())
 	}
@@ -157,26 +236,28 @@ func InitDefaultServices() {
 	}
 
 	defaultServices := []struct {
-		name        string
-		description string
-		status      string
-		icon        string
-		bg          string
-		modelID     string
-		maxTokens   int
-		rateLimit   int
-		price       float64
+		name          string
+		description   string
+		status        string
+		icon          string
+		bg            string
+		modelID       string
+		provider      string
+		maxTokens     int
+		contextWindow int
+		rateLimit     int
+		price         float64
 	}{
-		{"OpenAI GPT-4 Turbo", "Latest high-intelligence model with larger context window.", "Active", "cpu", "bg-purple-500/10", "gpt-4-turbo", 128000, 100, 0.01},
-		{"Claude 3 Opus", "Most powerful model for complex reasoning and coding.", "Active", "zap", "bg-orange-500/10", "claude-3-opus", 200000, 80, 0.015},
-		{"Gemini Pro 1.5", "Balanced performance and cost for general tasks.", "Maintenance", "globe", "bg-blue-500/10", "gemini-pro-1.5", 1000000, 120, 0.005},
-		{"Mistral Large", "Top-tier open weights model served via API.", "Active", "server", "bg-emerald-500/10", "mistral-large", 32000, 150, 0.008},
+		{"OpenAI GPT-4 Turbo", "Latest high-intelligence model with larger context window.", "Active", "cpu", "bg-purple-500/10", "gpt-4-turbo", "openai", 4096, 128000, 100, 0.01},
+		{"Claude 3 Opus", "Most powerful model for complex reasoning and coding.", "Active", "zap", "bg-orange-500/10", "claude-3-opus", "anthropic", 4096, 200000, 80, 0.015},
+		{"Gemini Pro 1.5", "Balanced performance and cost for general tasks.", "Maintenance", "globe", "bg-blue-500/10", "gemini-pro-1.5", "gemini", 8192, 1000000, 120, 0.005},
+		{"Mistral Large", "Top-tier open weights model served via API.", "Active", "server", "bg-emerald-500/10", "mistral-large", "openai", 4096, 32000, 150, 0.008},
 	}
 
 	zap.L().Info("🔧 初始化默认服务")
 
 	for _, s := range defaultServices {
-		service, err := CreateService(s.name, s.description, s.status, s.icon, s.bg, s.modelID, s.maxTokens, s.rateLimit, s.price)
+		service, err := CreateService(s.name, s.description, s.status, s.icon, s.bg, s.modelID, s.provider, s.maxTokens, s.contextWindow, s.rateLimit, s.price)
 		if err != nil {
 			zap.L().Error("创建服务失败", zap.String("name", s.name), zap.Error(err))
 		} else {
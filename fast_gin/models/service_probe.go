@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 服务健康探测记录
+// ============================================================================
+
+// ServiceProbe 单次健康探测结果
+type ServiceProbe struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ServiceID  uuid.UUID  `gorm:"type:uuid;index:idx_service_probe_time;not null" json:"service_id"`
+	ChannelID  *uuid.UUID `gorm:"type:uuid" json:"channel_id"` // 最后一次尝试的渠道，为空表示默认上游
+	Success    bool       `json:"success"`
+	StatusCode int        `json:"status_code"` // 上游状态码，网络错误时为0
+	// 鉴权或配置错误（未配置密钥、401/403、模型不存在等），不代表上游故障，不计入状态切换和可用率
+	Misconfigured bool      `gorm:"default:false" json:"misconfigured"`
+	LatencyMs     int64     `json:"latency_ms"`
+	Error         string    `gorm:"size:1000" json:"error"`
+	CreatedAt     time.Time `gorm:"index:idx_service_probe_time" json:"created_at"`
+}
+
+func (ServiceProbe) TableName() string {
+	return "service_probes"
+}
+
+func (p *ServiceProbe) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// RecordServiceProbe 记录一次探测结果
+func RecordServiceProbe(probe *ServiceProbe) error {
+	db := database.GetDB()
+
+	probe.Error = truncateRunes(probe.Error, 1000)
+
+	if err := db.Create(probe).Error; err != nil {
+		return errors.New("记录探测结果失败：" + err.Error())
+	}
+	return nil
+}
+
+// GetRecentServiceProbes 获取服务最近的有效探测记录（按时间倒序），不含配置错误的记录
+func GetRecentServiceProbes(serviceID uuid.UUID, limit int) ([]ServiceProbe, error) {
+	db := database.GetDB()
+	var probes []ServiceProbe
+	if err := db.Where("service_id = ? AND misconfigured = ?", serviceID, false).Order("created_at DESC").Limit(limit).Find(&probes).Error; err != nil {
+		return nil, errors.New("查询探测记录失败：" + err.Error())
+	}
+	return probes, nil
+}
+
+// CalculateServiceUptime 统计指定时间之后的探测成功率（百分比），不含配置错误的记录，无记录时 total 为0
+func CalculateServiceUptime(serviceID uuid.UUID, since time.Time) (uptime float64, total int64, err error) {
+	db := database.GetDB()
+
+	var result struct {
+		Total     int64
+		Successes int64
+	}
+	if err := db.Model(&ServiceProbe{}).
+		Select("COUNT(*) AS total, COALESCE(SUM(CASE WHEN success THEN 1 ELSE 0 END), 0) AS successes").
+		Where("service_id = ? AND created_at >= ? AND misconfigured = ?", serviceID, since, false).
+		Scan(&result).Error; err != nil {
+		return 0, 0, errors.New("统计可用率失败：" + err.Error())
+	}
+
+	if result.Total == 0 {
+		return 0, 0, nil
+	}
+	return float64(result.Successes) / float64(result.Total) * 100, result.Total, nil
+}
+
+// PruneServiceProbes 清理指定时间之前的探测记录
+func PruneServiceProbes(before time.Time) (int64, error) {
+	db := database.GetDB()
+	result := db.Where("created_at < ?", before).Delete(&ServiceProbe{})
+	if result.Error != nil {
+		return 0, errors.New("清理探测记录失败：" + result.Error.Error())
+	}
+	return result.RowsAffected, nil
+}
+
+// GetAutoStatusServices 获取由健康探测维护状态的服务
+func GetAutoStatusServices() ([]ServiceModel, error) {
+	db := database.GetDB()
+	var services []ServiceModel
+	if err := db.Where("auto_status = ?", true).Find(&services).Error; err != nil {
+		return nil, errors.New("查询服务列表失败：" + err.Error())
+	}
+	return services, nil
+}
+
+// UpdateServiceHealth 写入探测得出的状态和可用率，status 为空时只更新可用率
+func UpdateServiceHealth(id uuid.UUID, status, uptime string) error {
+	db := database.GetDB()
+
+	updates := map[string]interface{}{"uptime": uptime}
+	if status != "" {
+		updates["status"] = status
+	}
+
+	if err := db.Model(&ServiceModel{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return errors.New("更新服务健康状态失败：" + err.Error())
+	}
+	return nil
+}
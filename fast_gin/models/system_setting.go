@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"macg/core"
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// 系统设置
+// 运行时可由管理员修改的设置，未设置时使用配置文件中的默认值
+// ============================================================================
+
+// 设置项
+const (
+	SettingRegistrationMode = "registration_mode"
+)
+
+// 注册模式
+const (
+	RegistrationOpen       = "open"        // 开放注册
+	RegistrationInviteOnly = "invite_only" // 仅凭邀请注册
+)
+
+// SystemSetting 系统设置
+type SystemSetting struct {
+	Key       string     `gorm:"size:100;primaryKey" json:"key"`
+	Value     string     `gorm:"type:text" json:"value"`
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (SystemSetting) TableName() string {
+	return "system_settings"
+}
+
+// GetSetting 读取设置，未设置时返回 fallback
+func GetSetting(key, fallback string) (string, error) {
+	var setting SystemSetting
+	if err := database.GetDB().Where("key = ?", key).First(&setting).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fallback, nil
+		}
+		return "", errors.New("读取系统设置失败：" + err.Error())
+	}
+	return setting.Value, nil
+}
+
+// SetSetting 保存设置
+func SetSetting(key, value string, operatorID *uuid.UUID) error {
+	err := database.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_by", "updated_at"}),
+	}).Create(&SystemSetting{Key: key, Value: value, UpdatedBy: operatorID, UpdatedAt: time.Now()}).Error
+	if err != nil {
+		return errors.New("保存系统设置失败：" + err.Error())
+	}
+	return nil
+}
+
+// GetRegistrationMode 当前注册模式
+func GetRegistrationMode() (string, error) {
+	fallback := core.Cfg.Security.RegistrationMode
+	if fallback != RegistrationInviteOnly {
+		fallback = RegistrationOpen
+	}
+	return GetSetting(SettingRegistrationMode, fallback)
+}
+
+// SetRegistrationMode 修改注册模式
+func SetRegistrationMode(mode string, operatorID *uuid.UUID) error {
+	if mode != RegistrationOpen && mode != RegistrationInviteOnly {
+		return errors.New("无效的注册模式：" + mode)
+	}
+	return SetSetting(SettingRegistrationMode, mode, operatorID)
+}
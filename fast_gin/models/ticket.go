@@ -17,19 +17,20 @@ import (
 
 // SupportTicket 工单模型
 type SupportTicket struct {
-	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	TicketNo    string         `gorm:"uniqueIndex;size:20;not null" json:"ticket_no"` // 工单编号，如 T-1024
-	Subject     string         `gorm:"size:500;not null" json:"subject"`              // 主题
-	Description string         `gorm:"type:text" json:"description"`                  // 详细描述
-	Status      string         `gorm:"size:30;default:'open';index" json:"status"`    // open, in_progress, resolved, closed
-	Priority    string         `gorm:"size:20;default:'medium'" json:"priority"`      // low, medium, high, urgent
-	Category    string         `gorm:"size:50" json:"category"`                       // billing, technical, account, other
-	UserID      uuid.UUID      `gorm:"type:uuid;index" json:"user_id"`                // 提交者
-	AssigneeID  *uuid.UUID     `gorm:"type:uuid;index" json:"assignee_id"`            // 处理人
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	ResolvedAt  *time.Time     `json:"resolved_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	TicketNo       string         `gorm:"uniqueIndex;size:20;not null" json:"ticket_no"` // 工单编号，如 T-1024
+	Subject        string         `gorm:"size:500;not null" json:"subject"`              // 主题
+	Description    string         `gorm:"type:text" json:"description"`                  // 详细描述
+	Status         string         `gorm:"size:30;default:'open';index" json:"status"`    // open, in_progress, resolved, closed
+	Priority       string         `gorm:"size:20;default:'medium'" json:"priority"`      // low, medium, high, urgent
+	Category       string         `gorm:"size:50" json:"category"`                       // billing, technical, account, other
+	UserID         uuid.UUID      `gorm:"type:uuid;index" json:"user_id"`                // 提交者
+	OrganizationID *uuid.UUID     `gorm:"type:uuid;index" json:"organization_id"`        // 在组织上下文中提交时记录组织
+	AssigneeID     *uuid.UUID     `gorm:"type:uuid;index" json:"assignee_id"`            // 处理人
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	ResolvedAt     *time.Time     `json:"resolved_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// 关联
 	User     User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -105,8 +106,8 @@ func (r *TicketReply) BeforeCreate(tx *gorm.DB) error {
 // 工单 CRUD 操作
 // ============================================================================
 
-// CreateTicket 创建工单
-func CreateTicket(userID uuid.UUID, subject, description, priority, category string) (*SupportTicket, error) {
+// CreateTicket 创建工单，orgID 不为空时工单归属该组织
+func CreateTicket(userID uuid.UUID, orgID *uuid.UUID, subject, description, priority, category string) (*SupportTicket, error) {
 	db := database.GetDB()
 
 	if priority == "" {
@@ -117,12 +118,13 @@ func CreateTicket(userID uuid.UUID, subject, description, priority, category str
 	}
 
 	ticket := SupportTicket{
-		Subject:     subject,
-		Description: description,
-		Status:      "open",
-		Priority:    priority,
-		Category:    category,
-		UserID:      userID,
+		Subject:        subject,
+		Description:    description,
+		Status:         "open",
+		Priority:       priority,
+		Category:       category,
+		UserID:         userID,
+		OrganizationID: orgID,
 	}
 
 	if err := db.Create(&ticket).Error; err != nil {
@@ -132,13 +134,19 @@ func CreateTicket(userID uuid.UUID, subject, description, priority, category str
 	return &ticket, nil
 }
 
-// GetAllTickets 获取所有工单
-func GetAllTickets(page, pageSize int, status string) ([]SupportTicket, int64, error) {
+// GetAllTickets 获取所有工单，orgID 不为空时只返回该组织的工单，userID 不为空时只返回该用户提交的工单
+func GetAllTickets(orgID, userID *uuid.UUID, page, pageSize int, status string) ([]SupportTicket, int64, error) {
 	db := database.GetDB()
 	var tickets []SupportTicket
 	var total int64
 
 	query := db.Model(&SupportTicket{})
+	if orgID != nil {
+		query = query.Where("organization_id = ?", *orgID)
+	}
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
 	if status != "" && status != "all" {
 		query = query.Where("status = ?", status)
 	}
@@ -304,7 +312,7 @@ func InitDefaultTickets() {
 	zap.L().Info("🎫 初始化默认工单数据")
 
 	for _, t := range defaultTickets {
-		ticket, err := CreateTicket(user.ID, t.subject, t.description, t.priority, t.category)
+		ticket, err := CreateTicket(user.ID, nil, t.subject, t.description, t.priority, t.category)
 		if err != nil {
 			zap.L().Error("创建工单失败", zap.String("subject", t.subject), zap.Error(err))
 		} else {
@@ -1,12 +1,16 @@
 package models
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
 	"macg/database"
+	"macg/global"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -19,16 +23,19 @@ import (
 
 // TokenUsageRecord Token使用记录模型
 type TokenUsageRecord struct {
-	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	UserID       uuid.UUID `gorm:"type:uuid;index;not null" json:"user_id"`
-	APIKeyID     uuid.UUID `gorm:"type:uuid;index" json:"api_key_id"`
-	ModelName    string    `gorm:"size:100;index;not null" json:"model_name"` // gpt-4, claude-3, etc.
-	InputTokens  int       `gorm:"default:0" json:"input_tokens"`
-	OutputTokens int       `gorm:"default:0" json:"output_tokens"`
-	TotalTokens  int       `gorm:"default:0" json:"total_tokens"`
-	Cost         float64   `gorm:"type:decimal(10,6);default:0" json:"cost"` // 花费（美元）
-	RequestID    string    `gorm:"size:100;index" json:"request_id"`         // 请求ID
-	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+	ID             uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id"` // 使用组织密钥时计入组织
+	APIKeyID       uuid.UUID  `gorm:"type:uuid;index" json:"api_key_id"`
+	ServiceID      *uuid.UUID `gorm:"type:uuid;index" json:"service_id"`         // 为空表示历史数据，无法重算花费
+	ModelName      string     `gorm:"size:100;index;not null" json:"model_name"` // gpt-4, claude-3, etc.
+	InputTokens    int        `gorm:"default:0" json:"input_tokens"`
+	OutputTokens   int        `gorm:"default:0" json:"output_tokens"`
+	CachedTokens   int        `gorm:"default:0" json:"cached_tokens"` // 输入中命中缓存的部分
+	TotalTokens    int        `gorm:"default:0" json:"total_tokens"`
+	Cost           float64    `gorm:"type:decimal(10,6);default:0" json:"cost"` // 花费（美元）
+	RequestID      string     `gorm:"size:100;index" json:"request_id"`         // 请求ID
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
 
 	// 关联
 	User   User    `gorm:"foreignKey:UserID" json:"-"`
@@ -49,18 +56,20 @@ func (t *TokenUsageRecord) BeforeCreate(tx *gorm.DB) error {
 
 // APIKey API密钥模型
 type APIKey struct {
-	ID          uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	UserID      uuid.UUID      `gorm:"type:uuid;index;not null" json:"user_id"`
-	Name        string         `gorm:"size:100;not null" json:"name"`           // 密钥名称
-	KeyPrefix   string         `gorm:"size:10;not null" json:"key_prefix"`      // 密钥前缀，用于显示
-	KeyHash     string         `gorm:"size:100;not null" json:"-"`              // 密钥哈希
-	Status      string         `gorm:"size:20;default:'active'" json:"status"`  // active, revoked
-	Permissions string         `gorm:"size:500;default:'*'" json:"permissions"` // 权限范围，逗号分隔
-	LastUsedAt  *time.Time     `json:"last_used_at"`
-	ExpiresAt   *time.Time     `json:"expires_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID         uuid.UUID      `gorm:"type:uuid;index;not null" json:"user_id"` // 创建者
+	OrganizationID *uuid.UUID     `gorm:"type:uuid;index" json:"organization_id"`  // 组织密钥，为空时为个人密钥
+	Name           string         `gorm:"size:100;not null" json:"name"`           // 密钥名称
+	KeyPrefix      string         `gorm:"size:20;not null" json:"key_prefix"`      // 密钥前缀，用于显示
+	KeyHash        string         `gorm:"size:100;index;not null" json:"-"`        // 密钥哈希（HMAC-SHA256）
+	HashVersion    int            `gorm:"default:0" json:"-"`                      // 0: 旧版明文十六进制，1: HMAC-SHA256
+	Status         string         `gorm:"size:20;default:'active'" json:"status"`  // active, revoked
+	Permissions    string         `gorm:"size:500;default:'*'" json:"permissions"` // 权限范围，逗号分隔
+	LastUsedAt     *time.Time     `json:"last_used_at"`
+	ExpiresAt      *time.Time     `json:"expires_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// 关联
 	User User `gorm:"foreignKey:UserID" json:"-"`
@@ -77,6 +86,64 @@ func (a *APIKey) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// AllowedModels 解析 Permissions 中以 "model:" 开头的条目，返回 nil 表示不限制模型
+// 例如 "model:gpt-4-turbo,model:claude-*" 只允许使用 gpt-4-turbo 和 claude- 开头的模型
+func (a *APIKey) AllowedModels() []string {
+	var patterns []string
+	for _, item := range strings.Split(a.Permissions, ",") {
+		item = strings.TrimSpace(item)
+		if pattern, ok := strings.CutPrefix(item, "model:"); ok && pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// 密钥权限范围，Permissions 中除 "model:" 以外的条目
+const (
+	ScopeAll    = "*"
+	ScopeChat   = "chat"   // /v1/chat/completions
+	ScopeModels = "models" // /v1/models
+)
+
+// HasScope 判断密钥是否拥有指定权限范围
+// 未配置任何范围（只有 "model:" 条目或为空）时视为不限制
+func (a *APIKey) HasScope(scope string) bool {
+	restricted := false
+	for _, item := range strings.Split(a.Permissions, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" || strings.HasPrefix(item, "model:") {
+			continue
+		}
+		if item == ScopeAll || item == scope {
+			return true
+		}
+		restricted = true
+	}
+	return !restricted
+}
+
+// CanUseModel 判断密钥是否可以使用指定模型
+func (a *APIKey) CanUseModel(modelID string) bool {
+	patterns := a.AllowedModels()
+	if patterns == nil {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(strings.ToLower(modelID), strings.ToLower(prefix)) {
+				return true
+			}
+		} else if strings.EqualFold(pattern, modelID) {
+			return true
+		}
+	}
+	return false
+}
+
 // ============================================================================
 // Token 使用统计
 // ============================================================================
@@ -89,17 +156,26 @@ type TokenUsageSummary struct {
 
 // GetTokenUsageSummary 获取Token使用汇总（按模型分组）
 func GetTokenUsageSummary(userID *uuid.UUID, startTime, endTime *time.Time) ([]TokenUsageSummary, error) {
-	db := database.GetDB()
+	query := database.GetDB().Model(&TokenUsageRecord{})
+	if userID != nil {
+		query = query.Where("user_id = ?", userID)
+	}
+	return summarizeTokenUsage(query, startTime, endTime)
+}
+
+// GetOrganizationTokenUsageSummary 获取组织的Token使用汇总（按模型分组）
+func GetOrganizationTokenUsageSummary(orgID uuid.UUID, startTime, endTime *time.Time) ([]TokenUsageSummary, error) {
+	query := database.GetDB().Model(&TokenUsageRecord{}).Where("organization_id = ?", orgID)
+	return summarizeTokenUsage(query, startTime, endTime)
+}
 
-	query := db.Model(&TokenUsageRecord{}).
+// summarizeTokenUsage 按模型汇总查询范围内的Token使用
+func summarizeTokenUsage(query *gorm.DB, startTime, endTime *time.Time) ([]TokenUsageSummary, error) {
+	query = query.
 		Select("model_name, SUM(total_tokens) as total_tokens").
 		Group("model_name").
 		Order("total_tokens DESC")
 
-	if userID != nil {
-		query = query.Where("user_id = ?", userID)
-	}
-
 	if startTime != nil {
 		query = query.Where("created_at >= ?", startTime)
 	}
@@ -150,21 +226,31 @@ func GetUserTokenUsage(userID uuid.UUID, page, pageSize int) ([]TokenUsageRecord
 	return records, total, nil
 }
 
-// RecordTokenUsage 记录Token使用
-func RecordTokenUsage(userID uuid.UUID, apiKeyID *uuid.UUID, modelName string, inputTokens, outputTokens int, cost float64, requestID string) (*TokenUsageRecord, error) {
+// RecordTokenUsage 记录Token使用，使用组织密钥时同时记录组织
+func RecordTokenUsage(userID uuid.UUID, apiKey *APIKey, service *ServiceModel, inputTokens, outputTokens, cachedTokens int, requestID string) (*TokenUsageRecord, error) {
 	db := database.GetDB()
 
+	now := time.Now()
+	cost, err := CalculateUsageCost(service, userID, inputTokens, outputTokens, cachedTokens, now)
+	if err != nil {
+		return nil, errors.New("计算花费失败：" + err.Error())
+	}
+
 	record := TokenUsageRecord{
 		UserID:       userID,
-		ModelName:    modelName,
+		ServiceID:    &service.ID,
+		ModelName:    service.ModelID,
 		InputTokens:  inputTokens,
 		OutputTokens: outputTokens,
+		CachedTokens: cachedTokens,
 		Cost:         cost,
 		RequestID:    requestID,
+		CreatedAt:    now,
 	}
 
-	if apiKeyID != nil {
-		record.APIKeyID = *apiKeyID
+	if apiKey != nil {
+		record.APIKeyID = apiKey.ID
+		record.OrganizationID = apiKey.OrganizationID
 	}
 
 	if err := db.Create(&record).Error; err != nil {
@@ -178,8 +264,22 @@ func RecordTokenUsage(userID uuid.UUID, apiKeyID *uuid.UUID, modelName string, i
 // API Key 操作
 // ============================================================================
 
-// GenerateAPIKey 生成新的API密钥
-func GenerateAPIKey(userID uuid.UUID, name string, permissions string, expiresAt *time.Time) (*APIKey, string, error) {
+// APIKeyOwner 密钥归属，OrganizationID 为空时表示 UserID 的个人密钥
+type APIKeyOwner struct {
+	UserID         uuid.UUID
+	OrganizationID *uuid.UUID
+}
+
+// scope 限定查询范围：组织密钥按组织查询，个人密钥不包含该用户创建的组织密钥
+func (o APIKeyOwner) scope(db *gorm.DB) *gorm.DB {
+	if o.OrganizationID != nil {
+		return db.Where("organization_id = ?", *o.OrganizationID)
+	}
+	return db.Where("user_id = ? AND organization_id IS NULL", o.UserID)
+}
+
+// GenerateAPIKey 生成新的API密钥，owner.UserID 记录为创建者
+func GenerateAPIKey(owner APIKeyOwner, name string, permissions string, expiresAt *time.Time) (*APIKey, string, error) {
 	db := database.GetDB()
 
 	// 生成随机密钥
@@ -190,21 +290,26 @@ func GenerateAPIKey(userID uuid.UUID, name string, permissions string, expiresAt
 	fullKey := "sk-" + hex.EncodeToString(keyBytes)
 	keyPrefix := fullKey[:10] + "..."
 
-	// 密钥哈希存储（简化处理，实际应使用更安全的哈希）
-	keyHash := hex.EncodeToString(keyBytes)
+	// 只存储带服务端密钥的哈希，数据库泄露也无法还原或伪造密钥
+	keyHash := hashAPIKey(fullKey)
 
+	if err := ValidateAPIKeyPermissions(permissions); err != nil {
+		return nil, "", err
+	}
 	if permissions == "" {
-		permissions = "*"
+		permissions = ScopeAll
 	}
 
 	apiKey := APIKey{
-		UserID:      userID,
-		Name:        name,
-		KeyPrefix:   keyPrefix,
-		KeyHash:     keyHash,
-		Status:      "active",
-		Permissions: permissions,
-		ExpiresAt:   expiresAt,
+		UserID:         owner.UserID,
+		OrganizationID: owner.OrganizationID,
+		Name:           name,
+		KeyPrefix:      keyPrefix,
+		KeyHash:        keyHash,
+		HashVersion:    apiKeyHashVersion,
+		Status:         "active",
+		Permissions:    permissions,
+		ExpiresAt:      expiresAt,
 	}
 
 	if err := db.Create(&apiKey).Error; err != nil {
@@ -215,12 +320,76 @@ func GenerateAPIKey(userID uuid.UUID, name string, permissions string, expiresAt
 	return &apiKey, fullKey, nil
 }
 
-// GetUserAPIKeys 获取用户的API密钥列表
-func GetUserAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+// apiKeyHashVersion 当前的密钥哈希版本
+const apiKeyHashVersion = 1
+
+// hashAPIKey 计算密钥的存储哈希
+func hashAPIKey(fullKey string) string {
+	return keyedHash(fullKey)
+}
+
+// keyedHash 以服务端密钥为 key 的 HMAC-SHA256，用于存储各类凭据
+func keyedHash(value string) string {
+	mac := hmac.New(sha256.New, global.AppConfig.SecretKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MigrateAPIKeyHashes 将旧版密钥哈希迁移为 HMAC-SHA256
+// 旧版 KeyHash 直接保存了密钥的十六进制部分，可据此还原完整密钥后重新计算
+func MigrateAPIKeyHashes() error {
+	db := database.GetDB()
+
+	var keys []APIKey
+	if err := db.Unscoped().Where("hash_version < ?", apiKeyHashVersion).Find(&keys).Error; err != nil {
+		return errors.New("查询待迁移API密钥失败：" + err.Error())
+	}
+
+	for _, key := range keys {
+		updates := map[string]interface{}{
+			"key_hash":     hashAPIKey("sk-" + key.KeyHash),
+			"hash_version": apiKeyHashVersion,
+		}
+		if err := db.Unscoped().Model(&APIKey{}).Where("id = ? AND hash_version = ?", key.ID, key.HashVersion).
+			Updates(updates).Error; err != nil {
+			return errors.New("迁移API密钥哈希失败：" + err.Error())
+		}
+	}
+
+	if len(keys) > 0 {
+		zap.L().Info("API密钥哈希迁移完成", zap.Int("count", len(keys)))
+	}
+	return nil
+}
+
+// GetAPIKeyByKey 根据完整密钥查找可用的API密钥
+func GetAPIKeyByKey(fullKey string) (*APIKey, error) {
+	db := database.GetDB()
+
+	var apiKey APIKey
+	if err := db.Where("key_hash = ?", hashAPIKey(fullKey)).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("API密钥无效")
+		}
+		return nil, errors.New("查询API密钥失败：" + err.Error())
+	}
+
+	if apiKey.Status != "active" {
+		return nil, errors.New("API密钥已被撤销")
+	}
+	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
+		return nil, errors.New("API密钥已过期")
+	}
+
+	return &apiKey, nil
+}
+
+// GetAPIKeys 获取个人或组织的API密钥列表
+func GetAPIKeys(owner APIKeyOwner) ([]APIKey, error) {
 	db := database.GetDB()
 	var keys []APIKey
 
-	if err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+	if err := owner.scope(db).Order("created_at DESC").Find(&keys).Error; err != nil {
 		return nil, errors.New("查询API密钥失败：" + err.Error())
 	}
 
@@ -228,11 +397,11 @@ func GetUserAPIKeys(userID uuid.UUID) ([]APIKey, error) {
 }
 
 // RevokeAPIKey 撤销API密钥
-func RevokeAPIKey(id, userID uuid.UUID) error {
+func RevokeAPIKey(id uuid.UUID, owner APIKeyOwner) error {
 	db := database.GetDB()
 
-	result := db.Model(&APIKey{}).
-		Where("id = ? AND user_id = ?", id, userID).
+	result := owner.scope(db.Model(&APIKey{})).
+		Where("id = ?", id).
 		Update("status", "revoked")
 
 	if result.Error != nil {
@@ -245,11 +414,112 @@ func RevokeAPIKey(id, userID uuid.UUID) error {
 	return nil
 }
 
+// UpdateAPIKey 更新API密钥的名称、权限范围和过期时间
+func UpdateAPIKey(id uuid.UUID, owner APIKeyOwner, updates map[string]interface{}) (*APIKey, error) {
+	db := database.GetDB()
+
+	var apiKey APIKey
+	if err := owner.scope(db).Where("id = ?", id).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("密钥不存在")
+		}
+		return nil, errors.New("查询API密钥失败：" + err.Error())
+	}
+
+	// 只允许更新以下字段
+	allowed := map[string]bool{"name": true, "permissions": true, "expires_at": true}
+	for k := range updates {
+		if !allowed[k] {
+			delete(updates, k)
+		}
+	}
+	if permissions, ok := updates["permissions"].(string); ok {
+		if err := ValidateAPIKeyPermissions(permissions); err != nil {
+			return nil, err
+		}
+		if permissions == "" {
+			updates["permissions"] = ScopeAll
+		}
+	}
+	if v, ok := updates["expires_at"]; ok && v != nil {
+		raw, isString := v.(string)
+		if !isString {
+			return nil, errors.New("过期时间格式错误")
+		}
+		expiresAt, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, errors.New("过期时间格式错误：" + err.Error())
+		}
+		updates["expires_at"] = expiresAt
+	}
+
+	if err := db.Model(&apiKey).Updates(updates).Error; err != nil {
+		return nil, errors.New("更新API密钥失败：" + err.Error())
+	}
+
+	return &apiKey, nil
+}
+
+// ValidateAPIKeyPermissions 校验权限范围字符串
+// 允许的条目：*、chat、models 以及 model:<模型ID>（可以 * 结尾做前缀匹配）
+func ValidateAPIKeyPermissions(permissions string) error {
+	for _, item := range strings.Split(permissions, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "", item == ScopeAll, item == ScopeChat, item == ScopeModels:
+		case strings.HasPrefix(item, "model:") && len(item) > len("model:"):
+		default:
+			return errors.New("无效的权限范围：" + item)
+		}
+	}
+	return nil
+}
+
+// GetAllAPIKeys 分页获取所有用户的API密钥（管理员），userID 不为空时只查询该用户
+func GetAllAPIKeys(userID *uuid.UUID, page, pageSize int) ([]APIKey, int64, error) {
+	db := database.GetDB()
+	var keys []APIKey
+	var total int64
+
+	query := db.Model(&APIKey{})
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("获取记录数失败：" + err.Error())
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).
+		Order("created_at DESC").
+		Find(&keys).Error; err != nil {
+		return nil, 0, errors.New("查询API密钥失败：" + err.Error())
+	}
+
+	return keys, total, nil
+}
+
+// AdminRevokeAPIKey 撤销任意用户的API密钥（管理员）
+func AdminRevokeAPIKey(id uuid.UUID) error {
+	db := database.GetDB()
+
+	result := db.Model(&APIKey{}).Where("id = ?", id).Update("status", "revoked")
+	if result.Error != nil {
+		return errors.New("撤销密钥失败：" + result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+
+	return nil
+}
+
 // DeleteAPIKey 删除API密钥
-func DeleteAPIKey(id, userID uuid.UUID) error {
+func DeleteAPIKey(id uuid.UUID, owner APIKeyOwner) error {
 	db := database.GetDB()
 
-	result := db.Where("user_id = ?", userID).Delete(&APIKey{}, id)
+	result := owner.scope(db).Delete(&APIKey{}, id)
 	if result.Error != nil {
 		return errors.New("删除密钥失败：" + result.Error.Error())
 	}
@@ -301,8 +571,15 @@ func InitDefaultTokenUsage() {
 	zap.L().Info("📊 初始化示例Token使用数据")
 
 	for i, m := range models {
-		_, err := RecordTokenUsage(user.ID, nil, m.name, m.inputTokens, m.outputTokens, m.cost, "req-"+uuid.New().String()[:8])
-		if err != nil {
+		record := TokenUsageRecord{
+			UserID:       user.ID,
+			ModelName:    m.name,
+			InputTokens:  m.inputTokens,
+			OutputTokens: m.outputTokens,
+			Cost:         m.cost,
+			RequestID:    "req-" + uuid.New().String()[:8],
+		}
+		if err := db.Create(&record).Error; err != nil {
 			zap.L().Error("创建Token记录失败", zap.Error(err))
 		} else {
 			zap.L().Debug("创建Token记录", zap.Int("index", i), zap.String("model", m.name))
@@ -0,0 +1,325 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"macg/database"
+	"macg/global"
+	"macg/utils"
+	"macg/utils/aesutils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================================
+// 双因素认证（TOTP）
+// ============================================================================
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorNotEnabled = errors.New("未启用双因素认证")
+	ErrTwoFactorInvalid    = errors.New("验证码错误")
+	ErrTwoFactorRequired   = errors.New("当前角色要求启用双因素认证，不能关闭")
+)
+
+// UserTwoFactor 用户的 TOTP 配置，密钥加密存储
+type UserTwoFactor struct {
+	UserID       uuid.UUID  `gorm:"type:uuid;primaryKey" json:"user_id"`
+	Secret       string     `gorm:"size:255;not null" json:"-"` // AES 加密后的 Base32 密钥
+	Enabled      bool       `gorm:"default:false" json:"enabled"`
+	EnabledAt    *time.Time `json:"enabled_at"`
+	LastUsedStep int64      `json:"-"` // 最近一次通过校验的时间步，防止验证码重放
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (UserTwoFactor) TableName() string {
+	return "user_two_factors"
+}
+
+// RecoveryCode 恢复码，只保存哈希，每个只能使用一次
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:100;not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
+
+func (r *RecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// TwoFactorStatus 双因素认证状态
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Required               bool  `json:"required"` // 用户的某个角色要求启用
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// getTwoFactor 获取用户的 TOTP 配置，不存在时返回 nil
+func getTwoFactor(db *gorm.DB, userID uuid.UUID) (*UserTwoFactor, error) {
+	var tf UserTwoFactor
+	if err := db.Where("user_id = ?", userID).First(&tf).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, errors.New("查询双因素认证配置失败：" + err.Error())
+	}
+	return &tf, nil
+}
+
+// IsTwoFactorEnabled 判断用户是否已启用双因素认证
+func IsTwoFactorEnabled(userID uuid.UUID) (bool, error) {
+	tf, err := getTwoFactor(database.GetDB(), userID)
+	if err != nil {
+		return false, err
+	}
+	return tf != nil && tf.Enabled, nil
+}
+
+// UserRequiresTwoFactor 判断用户的角色是否要求双因素认证，user.Roles 需已加载
+func UserRequiresTwoFactor(user *User) bool {
+	for _, role := range user.Roles {
+		if role.Require2FA {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTwoFactorStatus 获取用户的双因素认证状态
+func GetTwoFactorStatus(user *User) (*TwoFactorStatus, error) {
+	db := database.GetDB()
+
+	tf, err := getTwoFactor(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{
+		Enabled:  tf != nil && tf.Enabled,
+		Required: UserRequiresTwoFactor(user),
+	}
+	if status.Enabled {
+		if err := db.Model(&RecoveryCode{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Count(&status.RecoveryCodesRemaining).Error; err != nil {
+			return nil, errors.New("查询恢复码失败：" + err.Error())
+		}
+	}
+	return status, nil
+}
+
+// BeginTwoFactorSetup 生成新的 TOTP 密钥，确认前不生效；返回明文密钥
+func BeginTwoFactorSetup(userID uuid.UUID) (string, error) {
+	db := database.GetDB()
+
+	tf, err := getTwoFactor(db, userID)
+	if err != nil {
+		return "", err
+	}
+	if tf != nil && tf.Enabled {
+		return "", errors.New("已启用双因素认证，请先关闭")
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", errors.New("生成密钥失败")
+	}
+	encrypted, err := aesutils.EncryptWithKey(secret, global.AppConfig.SecretKey)
+	if err != nil {
+		return "", errors.New("加密密钥失败：" + err.Error())
+	}
+
+	if tf == nil {
+		err = db.Create(&UserTwoFactor{UserID: userID, Secret: encrypted}).Error
+	} else {
+		err = db.Model(tf).Updates(map[string]interface{}{"secret": encrypted, "last_used_step": 0}).Error
+	}
+	if err != nil {
+		return "", errors.New("保存双因素认证配置失败：" + err.Error())
+	}
+	return secret, nil
+}
+
+// ConfirmTwoFactorSetup 用验证器生成的验证码确认启用，返回一次性展示的恢复码
+func ConfirmTwoFactorSetup(userID uuid.UUID, code string) ([]string, error) {
+	var codes []string
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var tf UserTwoFactor
+		if err := database.ForUpdate(tx).Where("user_id = ?", userID).First(&tf).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("请先生成双因素认证密钥")
+			}
+			return err
+		}
+		if tf.Enabled {
+			return errors.New("已启用双因素认证")
+		}
+		if err := checkTOTP(tx, &tf, code); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&tf).Updates(map[string]interface{}{"enabled": true, "enabled_at": now}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor 校验验证码后关闭双因素认证
+func DisableTwoFactor(user *User, code string) error {
+	if UserRequiresTwoFactor(user) {
+		return ErrTwoFactorRequired
+	}
+	if err := VerifyTwoFactor(user.ID, code); err != nil {
+		return err
+	}
+
+	return database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&UserTwoFactor{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧恢复码全部失效
+func RegenerateRecoveryCodes(userID uuid.UUID, code string) ([]string, error) {
+	if err := VerifyTwoFactor(userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("生成恢复码失败：" + err.Error())
+	}
+	return codes, nil
+}
+
+// VerifyTwoFactor 校验 TOTP 验证码或未使用的恢复码
+func VerifyTwoFactor(userID uuid.UUID, code string) error {
+	code = strings.TrimSpace(code)
+
+	return database.Transaction(func(tx *gorm.DB) error {
+		var tf UserTwoFactor
+		if err := database.ForUpdate(tx).Where("user_id = ?", userID).First(&tf).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTwoFactorNotEnabled
+			}
+			return err
+		}
+		if !tf.Enabled {
+			return ErrTwoFactorNotEnabled
+		}
+
+		if len(code) == utils.TOTPDigits {
+			return checkTOTP(tx, &tf, code)
+		}
+		return useRecoveryCode(tx, userID, code)
+	})
+}
+
+// checkTOTP 校验验证码并记录时间步，同一时间步的验证码不能重复使用
+func checkTOTP(tx *gorm.DB, tf *UserTwoFactor, code string) error {
+	secret, err := aesutils.DecryptWithKey(tf.Secret, global.AppConfig.SecretKey)
+	if err != nil {
+		return errors.New("解密双因素认证密钥失败：" + err.Error())
+	}
+
+	step, ok := utils.ValidateTOTP(secret, code, time.Now(), tf.LastUsedStep)
+	if !ok {
+		return ErrTwoFactorInvalid
+	}
+
+	tf.LastUsedStep = step
+	return tx.Model(tf).Update("last_used_step", step).Error
+}
+
+// useRecoveryCode 消耗一个恢复码
+func useRecoveryCode(tx *gorm.DB, userID uuid.UUID, code string) error {
+	hash := keyedHash(normalizeRecoveryCode(code))
+	result := tx.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorInvalid
+	}
+	return nil
+}
+
+// replaceRecoveryCodes 删除旧恢复码并生成新的一组，返回明文
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = RecoveryCode{UserID: userID, CodeHash: keyedHash(normalizeRecoveryCode(code))}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// recoveryCodeAlphabet 去掉易混淆字符（0/O、1/I/L）
+const recoveryCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// generateRecoveryCode 生成形如 XXXXX-XXXXX 的恢复码
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.New("生成恢复码失败")
+	}
+	var sb strings.Builder
+	for i, b := range buf {
+		if i == 5 {
+			sb.WriteByte('-')
+		}
+		sb.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return sb.String(), nil
+}
+
+// normalizeRecoveryCode 忽略大小写和分隔符
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
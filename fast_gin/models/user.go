@@ -14,17 +14,22 @@ import (
 
 // User 用户模型 - 使用 UUID 作为主键
 type User struct {
-	ID        uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Username  string         `gorm:"uniqueIndex;size:100;not null" json:"username"`
-	Email     string         `gorm:"uniqueIndex;size:255" json:"email"`
-	Password  string         `gorm:"size:255;not null" json:"-"` // json:"-" 不返回密码
-	Name      string         `gorm:"size:100" json:"name"`
-	Avatar    string         `gorm:"size:500" json:"avatar"`
-	Status    string         `gorm:"size:20;default:'active'" json:"status"` // active, inactive, banned
-	LastLogin *time.Time     `json:"last_login"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                   uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Username             string         `gorm:"uniqueIndex;size:100;not null" json:"username"`
+	Email                string         `gorm:"uniqueIndex;size:255" json:"email"`
+	EmailVerified        bool           `gorm:"default:false" json:"email_verified"`
+	EmailVerifiedAt      *time.Time     `json:"email_verified_at"`
+	AwaitingVerification bool           `gorm:"default:false" json:"-"`     // 注册后等待验证邮箱，验证后自动激活
+	Password             string         `gorm:"size:255;not null" json:"-"` // json:"-" 不返回密码
+	Name                 string         `gorm:"size:100" json:"name"`
+	Avatar               string         `gorm:"size:500" json:"avatar"`
+	Status               string         `gorm:"size:20;default:'active'" json:"status"` // active, inactive, banned
+	LastLogin            *time.Time     `json:"last_login"`
+	LockedUntil          *time.Time     `json:"locked_until"`       // 登录失败次数过多时临时锁定
+	TokenVersion         int            `gorm:"default:0" json:"-"` // 修改密码或退出所有设备时递增，旧令牌随即失效
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	DeletedAt            gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// RBAC 关联
 	Roles []Role `gorm:"many2many:user_roles;" json:"roles,omitempty"`
@@ -43,14 +48,21 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// ErrUsernameExists 用户名已被使用
+var ErrUsernameExists = errors.New("用户名已存在")
+
 // CreateUser 创建用户
 func CreateUser(username, email, password, name, role string) (*User, error) {
-	db := database.GetDB()
+	return createUser(database.GetDB(), username, email, password, name, role)
+}
+
+// createUser 在 db（可为事务）中创建用户并分配角色
+func createUser(db *gorm.DB, username, email, password, name, role string) (*User, error) {
 
 	// 检查用户名是否已存在
 	var existingUser User
 	if err := db.Where("username = ?", username).First(&existingUser).Error; err == nil {
-		return nil, errors.New("用户名已存在")
+		return nil, ErrUsernameExists
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, errors.New("检查用户名时出现数据库错误")
 	}
@@ -102,21 +114,29 @@ func CheckUserCredentials(username, password string) (*User, error) {
 	db := database.GetDB()
 
 	var user User
-	result := db.Where("username = ?", username).First(&user)
+	result := db.Preload("Roles").Where("username = ?", username).First(&user)
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("用户名或密码错误")
+			return nil, ErrInvalidCredentials
 		}
 		return nil, errors.New("查询用户时发生错误：" + result.Error.Error())
 	}
 
 	if user.Status != "active" {
-		return nil, errors.New("账号已被禁用")
+		if user.AwaitingVerification {
+			return nil, ErrEmailNotVerified
+		}
+		return nil, ErrAccountDisabled
+	}
+
+	// 锁定期内不校验密码，避免继续猜测
+	if user.IsLocked() {
+		return nil, ErrAccountLocked
 	}
 
 	if !utils.ComparePassword(user.Password, password) {
-		return nil, errors.New("用户名或密码错误")
+		return nil, ErrInvalidCredentials
 	}
 
 	// 更新最后登录时间
@@ -126,6 +146,11 @@ func CheckUserCredentials(username, password string) (*User, error) {
 	return &user, nil
 }
 
+// TouchLastLogin 更新最后登录时间，用于不经过密码校验的登录方式
+func TouchLastLogin(id uuid.UUID) {
+	database.GetDB().Model(&User{}).Where("id = ?", id).Update("last_login", time.Now())
+}
+
 // GetUserByID 根据 ID 获取用户
 func GetUserByID(id uuid.UUID) (*User, error) {
 	db := database.GetDB()
@@ -152,6 +177,32 @@ func GetUserByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserWithRoles 根据用户名获取用户及其角色
+func GetUserWithRoles(username string) (*User, error) {
+	db := database.GetDB()
+	var user User
+	if err := db.Preload("Roles").Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserWithRolesByID 根据 ID 获取用户及其角色
+func GetUserWithRolesByID(id uuid.UUID) (*User, error) {
+	db := database.GetDB()
+	var user User
+	if err := db.Preload("Roles").First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("用户不存在")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
 // GetAllUsers 分页获取所有用户
 func GetAllUsers(page, pageSize int) ([]User, int64, error) {
 	db := database.GetDB()
@@ -195,13 +246,40 @@ func UpdateUser(id uuid.UUID, updates map[string]interface{}) (*User, error) {
 		updates["password"] = hashedPassword
 	}
 
+	// 更换邮箱后需要重新验证
+	if email, ok := updates["email"].(string); ok && email != user.Email {
+		updates["email_verified"] = false
+		updates["email_verified_at"] = nil
+	}
+
 	if err := db.Model(&user).Updates(updates).Error; err != nil {
 		return nil, errors.New("更新用户失败：" + err.Error())
 	}
 
+	// 修改密码后所有已登录的设备都需要重新登录
+	if _, ok := updates["password"]; ok {
+		if err := RevokeAllUserTokens(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
 
+// ChangePassword 校验原密码后修改密码，并使该用户所有已签发的令牌失效
+func ChangePassword(userID uuid.UUID, oldPassword, newPassword string) error {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !utils.ComparePassword(user.Password, oldPassword) {
+		return errors.New("原密码错误")
+	}
+
+	_, err = UpdateUser(userID, map[string]interface{}{"password": newPassword})
+	return err
+}
+
 // DeleteUser 删除用户（软删除）
 func DeleteUser(id uuid.UUID) error {
 	db := database.GetDB()
@@ -0,0 +1,246 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"macg/database"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// 外部身份（OIDC 单点登录）
+// ============================================================================
+
+var (
+	ErrOIDCStateInvalid   = errors.New("登录请求无效或已过期，请重新登录")
+	ErrExternalUserAbsent = errors.New("该账号尚未开通，请联系管理员")
+)
+
+// UserIdentity 外部身份与本地用户的关联，同一身份提供方的 sub 唯一
+type UserIdentity struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+	Issuer      string     `gorm:"size:255;not null;uniqueIndex:idx_user_identity_subject" json:"issuer"`
+	Subject     string     `gorm:"size:255;not null;uniqueIndex:idx_user_identity_subject" json:"subject"`
+	Email       string     `gorm:"size:255" json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// OIDCLoginState 授权请求的状态，回调时一次性取出
+type OIDCLoginState struct {
+	State        string    `gorm:"size:100;primaryKey" json:"state"`
+	Nonce        string    `gorm:"size:100;not null" json:"-"`
+	CodeVerifier string    `gorm:"size:100;not null" json:"-"`
+	Redirect     string    `gorm:"size:500" json:"redirect"` // 登录完成后前端跳转的路径
+	ExpiresAt    time.Time `gorm:"index" json:"expires_at"`
+}
+
+func (OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
+
+// ExternalIdentity 身份提供方返回的用户信息
+type ExternalIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string // preferred_username
+}
+
+// ProvisionOptions 外部用户的关联和开通策略
+type ProvisionOptions struct {
+	AutoProvision bool
+	LinkByEmail   bool
+	DefaultRole   string
+}
+
+// CreateOIDCLoginState 保存授权请求状态
+func CreateOIDCLoginState(state *OIDCLoginState) error {
+	db := database.GetDB()
+	if err := db.Create(state).Error; err != nil {
+		return errors.New("保存登录状态失败：" + err.Error())
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginState 取出并删除授权请求状态，过期或不存在时返回 ErrOIDCStateInvalid
+func ConsumeOIDCLoginState(state string) (*OIDCLoginState, error) {
+	var loginState OIDCLoginState
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := database.ForUpdate(tx).Where("state = ?", state).First(&loginState).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOIDCStateInvalid
+			}
+			return err
+		}
+		return tx.Delete(&loginState).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, ErrOIDCStateInvalid
+	}
+	return &loginState, nil
+}
+
+// FindOrProvisionExternalUser 按外部身份查找本地用户：
+// 先按 issuer + sub 查找已关联的账号，再按已验证邮箱关联，最后按配置自动开通
+func FindOrProvisionExternalUser(identity ExternalIdentity, opts ProvisionOptions) (*User, error) {
+	db := database.GetDB()
+	now := time.Now()
+
+	var link UserIdentity
+	err := db.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).First(&link).Error
+	if err == nil {
+		db.Model(&link).Updates(map[string]interface{}{"email": identity.Email, "last_login_at": now})
+		return GetUserWithRolesByID(link.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("查询外部身份失败：" + err.Error())
+	}
+
+	var user *User
+	if opts.LinkByEmail && identity.EmailVerified && identity.Email != "" {
+		if user, err = getUserByEmail(identity.Email); err != nil {
+			return nil, err
+		}
+	}
+	if user == nil {
+		if !opts.AutoProvision {
+			return nil, ErrExternalUserAbsent
+		}
+		if user, err = provisionExternalUser(identity, opts.DefaultRole); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.Create(&UserIdentity{
+		UserID:      user.ID,
+		Issuer:      identity.Issuer,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+		LastLoginAt: &now,
+	}).Error; err != nil {
+		return nil, errors.New("关联外部身份失败：" + err.Error())
+	}
+	zap.L().Info("已关联外部身份", zap.String("username", user.Username), zap.String("issuer", identity.Issuer))
+
+	return GetUserWithRolesByID(user.ID)
+}
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// provisionExternalUser 为外部身份创建本地账号，密码随机生成，可通过找回密码另行设置
+func provisionExternalUser(identity ExternalIdentity, role string) (*User, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameDisallowed.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > 80 {
+		base = base[:80]
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, errors.New("生成随机密码失败")
+	}
+	password := hex.EncodeToString(buf)
+
+	email := identity.Email
+	if existing, err := getUserByEmail(email); err != nil {
+		return nil, err
+	} else if existing != nil {
+		// 邮箱已被其他账号使用但未按邮箱关联，新账号不保存邮箱
+		email = ""
+	}
+
+	username := base
+	for attempt := 0; attempt < 5; attempt++ {
+		if attempt > 0 {
+			suffix := make([]byte, 3)
+			rand.Read(suffix)
+			username = base + "-" + hex.EncodeToString(suffix)
+		}
+		user, err := CreateUser(username, email, password, identity.Name, role)
+		if err == nil {
+			if email != "" && identity.EmailVerified {
+				now := time.Now()
+				database.GetDB().Model(user).Updates(map[string]interface{}{"email_verified": true, "email_verified_at": now})
+			}
+			zap.L().Info("已自动开通外部用户", zap.String("username", username), zap.String("issuer", identity.Issuer))
+			return user, nil
+		}
+		if !errors.Is(err, ErrUsernameExists) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("无法为外部用户生成可用的用户名")
+}
+
+// SyncMappedRoles 按身份提供方的组同步角色：managed 为映射表中出现的全部角色，
+// 用户拥有但本次未映射到的 managed 角色会被移除，其余手工分配的角色不受影响
+func SyncMappedRoles(userID uuid.UUID, mapped, managed []string) error {
+	if len(managed) == 0 {
+		return nil
+	}
+
+	var roles []Role
+	if err := database.GetDB().Where("name IN ?", managed).Find(&roles).Error; err != nil {
+		return errors.New("获取角色失败：" + err.Error())
+	}
+	want := make(map[string]bool, len(mapped))
+	for _, name := range mapped {
+		want[name] = true
+	}
+
+	err := database.Transaction(func(tx *gorm.DB) error {
+		for _, role := range roles {
+			if want[role.Name] {
+				// user_roles 由 User.Roles 的 many2many 建表，只有 user_id、role_id 两列
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("CreatedAt").
+					Create(&UserRole{UserID: userID, RoleID: role.ID}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Where("user_id = ? AND role_id = ?", userID, role.ID).Delete(&UserRole{}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.New("同步角色失败：" + err.Error())
+	}
+
+	InvalidateUserPermissions(userID)
+	return nil
+}
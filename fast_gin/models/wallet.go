@@ -0,0 +1,361 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"macg/core"
+	"macg/database"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================================================
+// 预付费钱包
+// 请求转发前按估算用量冻结金额（hold），完成后按实际花费结算（settle），
+// 失败时释放冻结（release）。所有余额变动都在行锁事务中进行并写入流水
+// ============================================================================
+
+// 钱包所有者类型
+const (
+	WalletOwnerUser         = "user"
+	WalletOwnerOrganization = "organization"
+)
+
+// 钱包流水类型
+const (
+	WalletTxCredit  = "credit"  // 充值
+	WalletTxDebit   = "debit"   // 按实际用量扣费
+	WalletTxHold    = "hold"    // 冻结
+	WalletTxRelease = "release" // 释放冻结
+	WalletTxAdjust  = "adjust"  // 花费重算等人工调整，可正可负
+)
+
+// 冻结状态
+const (
+	HoldStatusHeld     = "held"
+	HoldStatusSettled  = "settled"
+	HoldStatusReleased = "released"
+)
+
+// ErrInsufficientBalance 可用余额不足
+var ErrInsufficientBalance = errors.New("余额不足")
+
+// ErrHoldNotFound 冻结记录不存在或已处理
+var ErrHoldNotFound = errors.New("冻结记录不存在或已处理")
+
+// Wallet 钱包，可用余额 = Balance - Held
+type Wallet struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	OwnerType string    `gorm:"size:20;not null;uniqueIndex:idx_wallet_owner" json:"owner_type"` // user, organization
+	OwnerID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_wallet_owner" json:"owner_id"`
+	Balance   float64   `gorm:"type:decimal(18,6);default:0" json:"balance"` // 账户余额
+	Held      float64   `gorm:"type:decimal(18,6);default:0" json:"held"`    // 冻结中的金额
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Wallet) TableName() string {
+	return "wallets"
+}
+
+func (w *Wallet) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// Available 可用余额
+func (w *Wallet) Available() float64 {
+	return w.Balance - w.Held
+}
+
+// WalletTransaction 钱包流水
+type WalletTransaction struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WalletID     uuid.UUID  `gorm:"type:uuid;index;not null" json:"wallet_id"`
+	Type         string     `gorm:"size:20;not null" json:"type"` // credit, debit, hold, release, adjust
+	Amount       float64    `gorm:"type:decimal(18,6)" json:"amount"`
+	BalanceAfter float64    `gorm:"type:decimal(18,6)" json:"balance_after"`
+	HeldAfter    float64    `gorm:"type:decimal(18,6)" json:"held_after"`
+	RequestID    string     `gorm:"size:100;index" json:"request_id"`
+	Description  string     `gorm:"size:500" json:"description"`
+	OperatorID   *uuid.UUID `gorm:"type:uuid" json:"operator_id"` // 手动充值的操作人
+	CreatedAt    time.Time  `gorm:"index" json:"created_at"`
+}
+
+func (WalletTransaction) TableName() string {
+	return "wallet_transactions"
+}
+
+func (t *WalletTransaction) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// WalletHold 单次请求的冻结记录
+type WalletHold struct {
+	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WalletID  uuid.UUID  `gorm:"type:uuid;index;not null" json:"wallet_id"`
+	RequestID string     `gorm:"size:100;uniqueIndex;not null" json:"request_id"`
+	Amount    float64    `gorm:"type:decimal(18,6)" json:"amount"`
+	Status    string     `gorm:"size:20;default:'held';index" json:"status"` // held, settled, released
+	CreatedAt time.Time  `json:"created_at"`
+	SettledAt *time.Time `json:"settled_at"`
+}
+
+func (WalletHold) TableName() string {
+	return "wallet_holds"
+}
+
+func (h *WalletHold) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
+// ============================================================================
+// 钱包操作
+// ============================================================================
+
+// GetOrCreateWallet 获取钱包，不存在时创建并发放初始赠送额度
+func GetOrCreateWallet(ownerType string, ownerID uuid.UUID) (*Wallet, error) {
+	var wallet Wallet
+	err := database.Transaction(func(tx *gorm.DB) error {
+		return lockWallet(tx, ownerType, ownerID, &wallet)
+	})
+	if err != nil {
+		return nil, errors.New("获取钱包失败：" + err.Error())
+	}
+	return &wallet, nil
+}
+
+// lockWallet 在事务中锁定钱包行，钱包不存在时先创建
+func lockWallet(tx *gorm.DB, ownerType string, ownerID uuid.UUID, wallet *Wallet) error {
+	err := database.ForUpdate(tx).Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).First(wallet).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	// 并发创建时只有一个事务会插入成功，其余忽略冲突后读取已有钱包；
+	// 赠送额度只发给用户，组织可随意创建，赠送会被用来反复领取额度
+	var credit float64
+	if ownerType == WalletOwnerUser {
+		credit = core.Cfg.Billing.InitialCredit
+	}
+	created := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Wallet{OwnerType: ownerType, OwnerID: ownerID, Balance: credit})
+	if created.Error != nil {
+		return created.Error
+	}
+	if err := database.ForUpdate(tx).Where("owner_type = ? AND owner_id = ?", ownerType, ownerID).First(wallet).Error; err != nil {
+		return err
+	}
+
+	// 新建钱包的赠送额度同样记入流水
+	if created.RowsAffected > 0 && credit > 0 {
+		return tx.Create(&WalletTransaction{
+			WalletID:     wallet.ID,
+			Type:         WalletTxCredit,
+			Amount:       credit,
+			BalanceAfter: wallet.Balance,
+			HeldAfter:    wallet.Held,
+			Description:  "初始赠送额度",
+		}).Error
+	}
+	return nil
+}
+
+// saveWallet 保存钱包余额并写入流水，需在事务中调用
+func saveWallet(tx *gorm.DB, wallet *Wallet, txType string, amount float64, requestID, description string, operatorID *uuid.UUID) error {
+	if err := tx.Model(wallet).Updates(map[string]interface{}{
+		"balance": wallet.Balance,
+		"held":    wallet.Held,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Create(&WalletTransaction{
+		WalletID:     wallet.ID,
+		Type:         txType,
+		Amount:       amount,
+		BalanceAfter: wallet.Balance,
+		HeldAfter:    wallet.Held,
+		RequestID:    requestID,
+		Description:  description,
+		OperatorID:   operatorID,
+	}).Error
+}
+
+// CreditWallet 充值
+func CreditWallet(ownerType string, ownerID uuid.UUID, amount float64, description string, operatorID *uuid.UUID) (*Wallet, error) {
+	if amount <= 0 {
+		return nil, errors.New("充值金额必须大于0")
+	}
+
+	var wallet Wallet
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := lockWallet(tx, ownerType, ownerID, &wallet); err != nil {
+			return err
+		}
+		wallet.Balance += amount
+		return saveWallet(tx, &wallet, WalletTxCredit, amount, "", description, operatorID)
+	})
+	if err != nil {
+		return nil, errors.New("充值失败：" + err.Error())
+	}
+	return &wallet, nil
+}
+
+// AdjustWallet 调整余额，amount 为正时增加、为负时扣减（允许透支）
+func AdjustWallet(ownerType string, ownerID uuid.UUID, amount float64, description string, operatorID *uuid.UUID) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		return adjustWallet(tx, ownerType, ownerID, amount, description, operatorID)
+	})
+	if err != nil {
+		return errors.New("调整余额失败：" + err.Error())
+	}
+	return nil
+}
+
+// adjustWallet 在调用方事务中调整余额
+func adjustWallet(tx *gorm.DB, ownerType string, ownerID uuid.UUID, amount float64, description string, operatorID *uuid.UUID) error {
+	var wallet Wallet
+	if err := lockWallet(tx, ownerType, ownerID, &wallet); err != nil {
+		return err
+	}
+	wallet.Balance += amount
+	return saveWallet(tx, &wallet, WalletTxAdjust, amount, "", description, operatorID)
+}
+
+// HoldFunds 为请求冻结金额，可用余额不足时返回 ErrInsufficientBalance
+func HoldFunds(ownerType string, ownerID uuid.UUID, requestID string, amount float64) (*WalletHold, error) {
+	var hold WalletHold
+	err := database.Transaction(func(tx *gorm.DB) error {
+		var wallet Wallet
+		if err := lockWallet(tx, ownerType, ownerID, &wallet); err != nil {
+			return err
+		}
+		// 余额已透支或不足以覆盖预估花费时拒绝
+		if wallet.Available() <= 0 || wallet.Available() < amount {
+			return ErrInsufficientBalance
+		}
+
+		wallet.Held += amount
+		if err := saveWallet(tx, &wallet, WalletTxHold, amount, requestID, "请求预扣", nil); err != nil {
+			return err
+		}
+
+		hold = WalletHold{
+			WalletID:  wallet.ID,
+			RequestID: requestID,
+			Amount:    amount,
+			Status:    HoldStatusHeld,
+		}
+		return tx.Create(&hold).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrInsufficientBalance) {
+			return nil, err
+		}
+		return nil, errors.New("冻结余额失败：" + err.Error())
+	}
+	return &hold, nil
+}
+
+// SettleHold 按实际花费结算冻结，实际花费超出冻结金额时余额允许透支
+func SettleHold(requestID string, cost float64) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		hold, wallet, err := lockHold(tx, requestID)
+		if err != nil {
+			return err
+		}
+
+		wallet.Held -= hold.Amount
+		wallet.Balance -= cost
+		if err := saveWallet(tx, wallet, WalletTxDebit, cost, requestID, "请求结算", nil); err != nil {
+			return err
+		}
+		return finishHold(tx, hold, HoldStatusSettled)
+	})
+	if err != nil {
+		if errors.Is(err, ErrHoldNotFound) {
+			return err
+		}
+		return errors.New("结算失败：" + err.Error())
+	}
+	return nil
+}
+
+// ReleaseHold 释放冻结（请求失败时调用）
+func ReleaseHold(requestID string) error {
+	err := database.Transaction(func(tx *gorm.DB) error {
+		hold, wallet, err := lockHold(tx, requestID)
+		if err != nil {
+			return err
+		}
+
+		wallet.Held -= hold.Amount
+		if err := saveWallet(tx, wallet, WalletTxRelease, hold.Amount, requestID, "请求失败，释放冻结", nil); err != nil {
+			return err
+		}
+		return finishHold(tx, hold, HoldStatusReleased)
+	})
+	if err != nil {
+		if errors.Is(err, ErrHoldNotFound) {
+			return err
+		}
+		return errors.New("释放冻结失败：" + err.Error())
+	}
+	return nil
+}
+
+// lockHold 锁定未处理的冻结记录及其钱包
+func lockHold(tx *gorm.DB, requestID string) (*WalletHold, *Wallet, error) {
+	var hold WalletHold
+	if err := database.ForUpdate(tx).Where("request_id = ? AND status = ?", requestID, HoldStatusHeld).First(&hold).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrHoldNotFound
+		}
+		return nil, nil, err
+	}
+
+	var wallet Wallet
+	if err := database.ForUpdate(tx).First(&wallet, hold.WalletID).Error; err != nil {
+		return nil, nil, err
+	}
+	return &hold, &wallet, nil
+}
+
+// finishHold 标记冻结记录已处理
+func finishHold(tx *gorm.DB, hold *WalletHold, status string) error {
+	now := time.Now()
+	return tx.Model(hold).Updates(map[string]interface{}{
+		"status":     status,
+		"settled_at": now,
+	}).Error
+}
+
+// GetWalletTransactions 分页获取钱包流水
+func GetWalletTransactions(walletID uuid.UUID, page, pageSize int) ([]WalletTransaction, int64, error) {
+	db := database.GetDB()
+	var transactions []WalletTransaction
+	var total int64
+
+	query := db.Model(&WalletTransaction{}).Where("wallet_id = ?", walletID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, errors.New("获取流水总数失败：" + err.Error())
+	}
+
+	offset := (page - 1) * pageSize
+	if err := query.Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&transactions).Error; err != nil {
+		return nil, 0, errors.New("查询钱包流水失败：" + err.Error())
+	}
+
+	return transactions, total, nil
+}
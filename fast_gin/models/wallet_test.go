@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"macg/core"
+	"macg/database/dbtest"
+
+	"github.com/google/uuid"
+)
+
+func setupWalletTest(t *testing.T, initialCredit float64) {
+	t.Helper()
+	dbtest.Open(t, &Wallet{}, &WalletTransaction{}, &WalletHold{})
+	saved := core.Cfg.Billing
+	core.Cfg.Billing.InitialCredit = initialCredit
+	t.Cleanup(func() { core.Cfg.Billing = saved })
+}
+
+func TestWalletInitialCredit(t *testing.T) {
+	setupWalletTest(t, 1.5)
+
+	user, err := GetOrCreateWallet(WalletOwnerUser, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approxEqual(user.Balance, 1.5) {
+		t.Errorf("user wallet balance = %v, want 1.5", user.Balance)
+	}
+	again, err := GetOrCreateWallet(WalletOwnerUser, user.OwnerID)
+	if err != nil || again.ID != user.ID || !approxEqual(again.Balance, 1.5) {
+		t.Errorf("second GetOrCreateWallet = %+v, %v", again, err)
+	}
+
+	// 组织钱包不赠送
+	org, err := GetOrCreateWallet(WalletOwnerOrganization, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org.Balance != 0 {
+		t.Errorf("organization wallet balance = %v, want 0", org.Balance)
+	}
+}
+
+func TestWalletHoldSettleRelease(t *testing.T) {
+	setupWalletTest(t, 0)
+	owner := uuid.New()
+	if _, err := CreditWallet(WalletOwnerUser, owner, 10, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		hold    = "hold"
+		settle  = "settle"
+		release = "release"
+	)
+	steps := []struct {
+		name        string
+		op          string
+		requestID   string
+		amount      float64 // 冻结金额或结算花费
+		wantErr     error
+		wantBalance float64
+		wantHeld    float64
+	}{
+		{"hold within balance", hold, "req-1", 4, nil, 10, 4},
+		{"hold beyond available", hold, "req-2", 7, ErrInsufficientBalance, 10, 4},
+		{"hold remaining balance", hold, "req-2", 6, nil, 10, 10},
+		{"hold with nothing available", hold, "req-3", 0.01, ErrInsufficientBalance, 10, 10},
+		{"settle below hold", settle, "req-1", 3, nil, 7, 6},
+		{"settle twice", settle, "req-1", 3, ErrHoldNotFound, 7, 6},
+		{"release settled hold", release, "req-1", 0, ErrHoldNotFound, 7, 6},
+		{"release hold", release, "req-2", 0, nil, 7, 0},
+		{"release unknown request", release, "req-404", 0, ErrHoldNotFound, 7, 0},
+		{"hold again after release", hold, "req-4", 5, nil, 7, 5},
+		{"settle above hold overdraws", settle, "req-4", 9, nil, -2, 0},
+		{"hold while overdrawn", hold, "req-5", 0, ErrInsufficientBalance, -2, 0},
+	}
+	for _, step := range steps {
+		var err error
+		switch step.op {
+		case hold:
+			_, err = HoldFunds(WalletOwnerUser, owner, step.requestID, step.amount)
+		case settle:
+			err = SettleHold(step.requestID, step.amount)
+		case release:
+			err = ReleaseHold(step.requestID)
+		}
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.wantErr)
+		}
+
+		wallet, err := GetOrCreateWallet(WalletOwnerUser, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !approxEqual(wallet.Balance, step.wantBalance) || !approxEqual(wallet.Held, step.wantHeld) {
+			t.Fatalf("%s: balance/held = %v/%v, want %v/%v", step.name, wallet.Balance, wallet.Held, step.wantBalance, step.wantHeld)
+		}
+	}
+
+	// 每次成功的余额变动都写入流水
+	wallet, _ := GetOrCreateWallet(WalletOwnerUser, owner)
+	txs, total, err := GetWalletTransactions(wallet.ID, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 充值 1 + 冻结 3 + 结算 2 + 释放 1
+	if total != 7 {
+		t.Fatalf("transactions = %d, want 7", total)
+	}
+	var holds, debits float64
+	for _, tx := range txs {
+		switch tx.Type {
+		case WalletTxHold:
+			holds += tx.Amount
+		case WalletTxDebit:
+			debits += tx.Amount
+		}
+	}
+	if !approxEqual(holds, 15) || !approxEqual(debits, 12) {
+		t.Errorf("held total = %v, debited total = %v; want 15, 12", holds, debits)
+	}
+}
@@ -0,0 +1,71 @@
+package oidc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Claims 已校验的 ID Token 声明
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+
+	raw jwt.MapClaims
+}
+
+func newClaims(raw jwt.MapClaims) *Claims {
+	c := &Claims{raw: raw}
+	c.Subject = c.String("sub")
+	c.Email = c.String("email")
+	c.Name = c.String("name")
+	c.PreferredUsername = c.String("preferred_username")
+
+	// 部分身份提供方以字符串形式返回 email_verified
+	switch v := raw["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified = strings.EqualFold(v, "true")
+	}
+	return c
+}
+
+// String 读取字符串声明
+func (c *Claims) String(name string) string {
+	s, _ := c.raw[name].(string)
+	return s
+}
+
+// Strings 读取字符串或字符串数组声明，例如 aud 或 groups
+func (c *Claims) Strings(name string) []string {
+	switch v := c.raw[name].(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Time 读取 Unix 时间戳声明
+func (c *Claims) Time(name string) (time.Time, bool) {
+	v, ok := c.raw[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
@@ -0,0 +1,54 @@
+package oidc
+
+import (
+	"context"
+	"sync"
+
+	"macg/core"
+)
+
+// ============================================================================
+// 全局 Provider
+// 首次使用时读取发现文档，失败后下次请求重试，身份提供方暂时不可用不影响启动
+// ============================================================================
+
+var (
+	defaultMu       sync.Mutex
+	defaultProvider *Provider
+)
+
+// Enabled 是否启用 OIDC 单点登录
+func Enabled() bool {
+	return core.Cfg.OIDC.Enabled
+}
+
+// Default 返回按配置创建的全局 Provider
+func Default(ctx context.Context) (*Provider, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultProvider != nil {
+		return defaultProvider, nil
+	}
+
+	cfg := core.Cfg.OIDC
+	provider, err := NewProvider(ctx, Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defaultProvider = provider
+	return provider, nil
+}
+
+// SetDefault 替换全局 Provider，用于测试
+func SetDefault(provider *Provider) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultProvider = provider
+}
@@ -0,0 +1,276 @@
+// Package oidctest 提供测试用的 OpenID Connect 身份提供方替身
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ============================================================================
+// 身份提供方替身
+// 基于 httptest 提供发现文档、授权端点、授权码 + PKCE 令牌端点和 JWKS，
+// 授权端点不做登录交互，直接以 Login 中的声明签发授权码并跳回 redirect_uri
+// ============================================================================
+
+// Key 签名密钥
+type Key struct {
+	Kid     string
+	Private *rsa.PrivateKey
+}
+
+// NewKey 生成 RSA 签名密钥
+func NewKey(tb testing.TB, kid string) *Key {
+	tb.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatalf("generate key: %v", err)
+	}
+	return &Key{Kid: kid, Private: private}
+}
+
+// Sign 用该密钥以 RS256 签名声明
+func (k *Key) Sign(tb testing.TB, claims jwt.MapClaims) string {
+	tb.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = k.Kid
+	signed, err := token.SignedString(k.Private)
+	if err != nil {
+		tb.Fatalf("sign id token: %v", err)
+	}
+	return signed
+}
+
+// grant 已签发的授权码
+type grant struct {
+	challenge   string
+	redirectURI string
+	claims      jwt.MapClaims
+}
+
+// IdP 身份提供方替身
+type IdP struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string // 非空时令牌端点要求 Basic 认证
+
+	// Login 下一次授权签发的用户声明（sub、email、groups 等），iss、aud、nonce 和时间声明自动补齐
+	Login jwt.MapClaims
+
+	tb     testing.TB
+	mu     sync.Mutex
+	signer *Key
+	keys   []*Key
+	codes  map[string]grant
+
+	jwksRequests int
+}
+
+// New 启动身份提供方替身，测试结束时自动关闭
+func New(tb testing.TB, clientID string) *IdP {
+	tb.Helper()
+	key := NewKey(tb, "key-1")
+	idp := &IdP{
+		ClientID: clientID,
+		Login:    jwt.MapClaims{"sub": "subject-1"},
+		tb:       tb,
+		signer:   key,
+		keys:     []*Key{key},
+		codes:    map[string]grant{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/authorize", idp.authorize)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", idp.jwks)
+	idp.Server = httptest.NewServer(mux)
+	tb.Cleanup(idp.Close)
+	return idp
+}
+
+// Issuer 发现文档中的 issuer
+func (i *IdP) Issuer() string {
+	return i.URL
+}
+
+// Signer 当前签名密钥
+func (i *IdP) Signer() *Key {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.signer
+}
+
+// JWKSRequests JWKS 被请求的次数
+func (i *IdP) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksRequests
+}
+
+// Rotate 改用 key 签名，JWKS 只发布 published 中的密钥
+func (i *IdP) Rotate(key *Key, published ...*Key) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.signer = key
+	i.keys = published
+}
+
+// Claims 补齐 iss、aud 和时间声明后的 ID Token 声明，extra 覆盖默认值
+func (i *IdP) Claims(extra jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": i.Issuer(),
+		"aud": i.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return claims
+}
+
+// Authorize 请求授权地址（不跟随跳转），返回跳回 redirect_uri 的地址
+func (i *IdP) Authorize(authURL string) *url.URL {
+	i.tb.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		i.tb.Fatalf("authorize: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		i.tb.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		i.tb.Fatalf("authorize: %v", err)
+	}
+	return location
+}
+
+func (i *IdP) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.Issuer(),
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *IdP) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != i.ClientID ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	claims := i.Claims(i.Login)
+	claims["nonce"] = q.Get("nonce")
+	code := randomString()
+
+	i.mu.Lock()
+	i.codes[code] = grant{challenge: q.Get("code_challenge"), redirectURI: q.Get("redirect_uri"), claims: claims}
+	i.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", q.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (i *IdP) token(w http.ResponseWriter, r *http.Request) {
+	oauthError := func(code string) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+	}
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		oauthError("invalid_request")
+		return
+	}
+	if i.ClientSecret != "" {
+		// client_secret_basic 的凭据先经过表单编码（RFC 6749 2.3.1）
+		id, secret, ok := r.BasicAuth()
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || id != i.ClientID || secret != i.ClientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+	}
+
+	i.mu.Lock()
+	g, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code")) // 授权码只能使用一次
+	signer := i.signer
+	i.mu.Unlock()
+
+	if !ok || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		oauthError("invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		oauthError("invalid_grant")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signer.Sign(i.tb, g.claims),
+	})
+}
+
+func (i *IdP) jwks(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	i.jwksRequests++
+	keys := make([]map[string]string, 0, len(i.keys))
+	for _, k := range i.keys {
+		pub := k.Private.PublicKey
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": k.Kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	i.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
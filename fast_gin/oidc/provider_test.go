@@ -0,0 +1,226 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"macg/oidc/oidctest"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testClientID    = "hub-client"
+	testRedirectURL = "https://hub.example.com/api/auth/oidc/callback"
+)
+
+// newTestProvider 启动身份提供方替身并读取其发现文档
+func newTestProvider(t *testing.T) (*oidctest.IdP, *Provider) {
+	t.Helper()
+	idp := oidctest.New(t, testClientID)
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:      idp.Issuer(),
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, idp.Client())
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return idp, p
+}
+
+func TestNewProviderDiscovery(t *testing.T) {
+	idp, p := newTestProvider(t)
+
+	meta := p.Metadata()
+	if meta.Issuer != idp.Issuer() || meta.TokenEndpoint != idp.URL+"/token" || meta.JWKSURI != idp.URL+"/jwks" {
+		t.Errorf("metadata = %+v", meta)
+	}
+
+	auth := p.AuthCodeURL("state-1", "nonce-1", CodeChallenge("verifier"))
+	for _, want := range []string{"response_type=code", "client_id=" + testClientID, "state=state-1", "nonce=nonce-1",
+		"code_challenge_method=S256", "scope=openid+profile+email"} {
+		if !strings.Contains(auth, want) {
+			t.Errorf("AuthCodeURL = %s, missing %s", auth, want)
+		}
+	}
+}
+
+func TestNewProviderRejectsBadDiscovery(t *testing.T) {
+	cases := map[string]string{
+		"issuer mismatch":   `{"issuer":"https://other.example.com","authorization_endpoint":"a","token_endpoint":"t","jwks_uri":"j"}`,
+		"missing endpoints": `{"issuer":"%s"}`,
+	}
+	for name, doc := range cases {
+		t.Run(name, func(t *testing.T) {
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strings.Replace(doc, "%s", srv.URL, 1)))
+			}))
+			defer srv.Close()
+
+			if _, err := NewProvider(context.Background(), Config{Issuer: srv.URL, ClientID: testClientID}, srv.Client()); err == nil {
+				t.Fatal("NewProvider succeeded")
+			}
+		})
+	}
+}
+
+func TestExchangePKCE(t *testing.T) {
+	idp, p := newTestProvider(t)
+	idp.Login = jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true}
+
+	verifier, err := RandomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := idp.Authorize(p.AuthCodeURL("state-1", "nonce-1", CodeChallenge(verifier)))
+	if callback.Query().Get("state") != "state-1" {
+		t.Fatalf("callback = %s", callback)
+	}
+	code := callback.Query().Get("code")
+
+	// 校验值不匹配时令牌端点拒绝，授权码随之作废
+	if _, err := p.Exchange(context.Background(), code, "wrong-verifier"); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("Exchange with wrong verifier: %v", err)
+	}
+
+	callback = idp.Authorize(p.AuthCodeURL("state-2", "nonce-2", CodeChallenge(verifier)))
+	token, err := p.Exchange(context.Background(), callback.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := p.VerifyIDToken(context.Background(), token.IDToken, "nonce-2")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestExchangeClientSecret(t *testing.T) {
+	idp := oidctest.New(t, testClientID)
+	idp.ClientSecret = "s3cret/+"
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:       idp.Issuer(),
+		ClientID:     testClientID,
+		ClientSecret: idp.ClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, idp.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 含特殊字符的密钥经表单编码后同样能通过认证
+	callback := idp.Authorize(p.AuthCodeURL("s", "n", CodeChallenge("v")))
+	if _, err := p.Exchange(context.Background(), callback.Query().Get("code"), "v"); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	p.cfg.ClientSecret = "wrong"
+	callback = idp.Authorize(p.AuthCodeURL("s", "n", CodeChallenge("v")))
+	if _, err := p.Exchange(context.Background(), callback.Query().Get("code"), "v"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Exchange with wrong secret: %v", err)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	idp, p := newTestProvider(t)
+	other := oidctest.NewKey(t, idp.Signer().Kid) // kid 相同但私钥不同
+	past := time.Now().Add(-2 * time.Hour).Unix()
+
+	cases := []struct {
+		name   string
+		key    *oidctest.Key
+		claims jwt.MapClaims
+		nonce  string
+	}{
+		{"bad signature", other, jwt.MapClaims{"sub": "alice", "nonce": "n"}, "n"},
+		{"issuer", nil, jwt.MapClaims{"sub": "alice", "nonce": "n", "iss": "https://evil.example.com"}, "n"},
+		{"audience", nil, jwt.MapClaims{"sub": "alice", "nonce": "n", "aud": "other-client"}, "n"},
+		{"azp", nil, jwt.MapClaims{"sub": "alice", "nonce": "n", "aud": []string{testClientID, "other-client"}, "azp": "other-client"}, "n"},
+		{"nonce", nil, jwt.MapClaims{"sub": "alice", "nonce": "replayed"}, "n"},
+		{"expired", nil, jwt.MapClaims{"sub": "alice", "nonce": "n", "exp": past}, "n"},
+		{"not yet valid", nil, jwt.MapClaims{"sub": "alice", "nonce": "n", "nbf": time.Now().Add(time.Hour).Unix()}, "n"},
+		{"missing sub", nil, jwt.MapClaims{"nonce": "n"}, "n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			key := tc.key
+			if key == nil {
+				key = idp.Signer()
+			}
+			raw := key.Sign(t, idp.Claims(tc.claims))
+			if _, err := p.VerifyIDToken(context.Background(), raw, tc.nonce); err == nil {
+				t.Fatal("VerifyIDToken accepted the token")
+			}
+		})
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		claims := jwt.MapClaims{"sub": "alice", "nonce": "n", "aud": []string{testClientID, "other-client"}, "azp": testClientID}
+		if _, err := p.VerifyIDToken(context.Background(), idp.Signer().Sign(t, idp.Claims(claims)), "n"); err != nil {
+			t.Fatalf("VerifyIDToken: %v", err)
+		}
+	})
+}
+
+func TestVerifyIDTokenRejectsHMAC(t *testing.T) {
+	idp, p := newTestProvider(t)
+
+	// 用公开的模数作为 HMAC 密钥伪造令牌（算法替换攻击）
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.Claims(jwt.MapClaims{"sub": "alice", "nonce": "n"}))
+	token.Header["kid"] = idp.Signer().Kid
+	raw, err := token.SignedString(idp.Signer().Private.PublicKey.N.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(context.Background(), raw, "n"); err == nil {
+		t.Fatal("VerifyIDToken accepted an HS256 token")
+	}
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	idp, p := newTestProvider(t)
+	ctx := context.Background()
+	sign := func() string {
+		return idp.Signer().Sign(t, idp.Claims(jwt.MapClaims{"sub": "alice", "nonce": "n"}))
+	}
+
+	if _, err := p.VerifyIDToken(ctx, sign(), "n"); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if _, err := p.VerifyIDToken(ctx, sign(), "n"); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if n := idp.JWKSRequests(); n != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1 (cached)", n)
+	}
+
+	// 身份提供方轮换密钥：新 kid 在刷新间隔内不会反复拉取 JWKS
+	oldKey, newKey := idp.Signer(), oidctest.NewKey(t, "key-2")
+	idp.Rotate(newKey, newKey, oldKey)
+	if _, err := p.VerifyIDToken(ctx, sign(), "n"); err == nil {
+		t.Fatal("unknown kid accepted within refresh interval")
+	}
+	if n := idp.JWKSRequests(); n != 1 {
+		t.Fatalf("JWKS fetched %d times within refresh interval", n)
+	}
+
+	// 超过刷新间隔后遇到未知 kid 重新拉取
+	p.mu.Lock()
+	p.keysFetchedAt = time.Now().Add(-jwksRefreshInterval)
+	p.mu.Unlock()
+	if _, err := p.VerifyIDToken(ctx, sign(), "n"); err != nil {
+		t.Fatalf("VerifyIDToken after rotation: %v", err)
+	}
+	if n := idp.JWKSRequests(); n != 2 {
+		t.Fatalf("JWKS fetched %d times, want 2", n)
+	}
+
+}
@@ -0,0 +1,449 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"macg/models"
+)
+
+// anthropicProvider Anthropic Messages API 适配器
+type anthropicProvider struct{}
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+)
+
+// ============================================================================
+// Anthropic 原生数据结构
+// ============================================================================
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Stream        bool               `json:"stream,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice    interface{}        `json:"tool_choice,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"` // user, assistant
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string                `json:"type"` // text, image, tool_use, tool_result
+	Text      string                `json:"text,omitempty"`
+	Source    *anthropicImageSource `json:"source,omitempty"`
+	ID        string                `json:"id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Input     json.RawMessage       `json:"input,omitempty"`
+	ToolUseID string                `json:"tool_use_id,omitempty"`
+	Content   string                `json:"content,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // base64, url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+type anthropicError struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ============================================================================
+// 请求转换
+// ============================================================================
+
+func (anthropicProvider) Name() string { return Anthropic }
+
+func (anthropicProvider) DefaultBaseURL() string { return "https://api.anthropic.com/v1" }
+
+func (anthropicProvider) NewRequest(ctx context.Context, baseURL, apiKey string, req *models.ChatCompletionRequest) (*http.Request, error) {
+	native, err := toAnthropicRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(native)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, joinURL(baseURL, "/messages"), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	if apiKey != "" {
+		httpReq.Header.Set("x-api-key", apiKey)
+	}
+	return httpReq, nil
+}
+
+// toAnthropicRequest 统一格式 -> Anthropic 格式
+func toAnthropicRequest(req *models.ChatCompletionRequest) (*anthropicRequest, error) {
+	native := &anthropicRequest{
+		Model:         req.Model,
+		MaxTokens:     req.OutputTokenLimit(),
+		Temperature:   req.Temperature,
+		TopP:          req.TopP,
+		StopSequences: req.Stop,
+		Stream:        req.Stream,
+	}
+	if native.MaxTokens <= 0 {
+		native.MaxTokens = anthropicDefaultMaxTokens
+	}
+
+	var systemParts []string
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			systemParts = append(systemParts, m.TextContent())
+		case "assistant":
+			var blocks []anthropicBlock
+			if text := m.TextContent(); text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+			native.appendMessage("assistant", blocks)
+		case "tool":
+			native.appendMessage("user", []anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.TextContent()}})
+		default:
+			native.appendMessage("user", anthropicUserBlocks(m))
+		}
+	}
+	native.System = strings.Join(systemParts, "\n\n")
+
+	for _, t := range req.Tools {
+		schema := t.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		native.Tools = append(native.Tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+	native.ToolChoice = anthropicToolChoice(req.ToolChoice)
+
+	if len(native.Messages) == 0 {
+		return nil, fmt.Errorf("anthropic requires at least one non-system message")
+	}
+	return native, nil
+}
+
+// appendMessage 追加消息，连续同角色消息合并为一条
+func (r *anthropicRequest) appendMessage(role string, blocks []anthropicBlock) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(r.Messages); n > 0 && r.Messages[n-1].Role == role {
+		r.Messages[n-1].Content = append(r.Messages[n-1].Content, blocks...)
+		return
+	}
+	r.Messages = append(r.Messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// anthropicUserBlocks 转换用户消息内容（文本和图片）
+func anthropicUserBlocks(m models.ChatMessage) []anthropicBlock {
+	parts, ok := m.Content.([]interface{})
+	if !ok {
+		return []anthropicBlock{{Type: "text", Text: m.TextContent()}}
+	}
+
+	var blocks []anthropicBlock
+	for _, part := range parts {
+		p, ok := part.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch p["type"] {
+		case "text":
+			if text, ok := p["text"].(string); ok {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: text})
+			}
+		case "image_url":
+			url := imageURL(p)
+			if mediaType, data, ok := parseDataURL(url); ok {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "base64", MediaType: mediaType, Data: data}})
+			} else if url != "" {
+				blocks = append(blocks, anthropicBlock{Type: "image", Source: &anthropicImageSource{Type: "url", URL: url}})
+			}
+		}
+	}
+	return blocks
+}
+
+// anthropicToolChoice 转换 tool_choice
+func anthropicToolChoice(choice interface{}) interface{} {
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case "auto":
+			return map[string]string{"type": "auto"}
+		case "required":
+			return map[string]string{"type": "any"}
+		case "none":
+			return map[string]string{"type": "none"}
+		}
+	case map[string]interface{}:
+		if fn, ok := v["function"].(map[string]interface{}); ok {
+			if name, ok := fn["name"].(string); ok {
+				return map[string]string{"type": "tool", "name": name}
+			}
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// 响应转换
+// ============================================================================
+
+func (anthropicProvider) ParseResponse(body []byte) (*models.ChatCompletionResponse, error) {
+	var native anthropicResponse
+	if err := json.Unmarshal(body, &native); err != nil {
+		return nil, fmt.Errorf("decode anthropic response: %w", err)
+	}
+
+	msg := models.ChatMessage{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range native.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, models.ToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: models.FunctionCall{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
+	}
+	msg.Content = text.String()
+
+	return &models.ChatCompletionResponse{
+		ID:      native.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   native.Model,
+		Choices: []models.ChatChoice{{
+			Index:        0,
+			Message:      msg,
+			FinishReason: anthropicFinishReason(native.StopReason),
+		}},
+		Usage: anthropicChatUsage(native.Usage),
+	}, nil
+}
+
+func (anthropicProvider) ParseError(status int, body []byte) models.ChatErrorResponse {
+	var native anthropicError
+	if err := json.Unmarshal(body, &native); err == nil && native.Error.Message != "" {
+		return models.ChatErrorResponse{Error: models.ChatError{Message: native.Error.Message, Type: native.Error.Type}}
+	}
+	return genericError(status, body)
+}
+
+// anthropicFinishReason 转换停止原因
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// anthropicChatUsage 转换用量，缓存读取和写入都计入输入Token
+func anthropicChatUsage(u anthropicUsage) *models.ChatUsage {
+	prompt := u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	usage := &models.ChatUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+	if u.CacheReadInputTokens > 0 {
+		usage.PromptTokensDetails = &models.PromptTokensDetails{CachedTokens: u.CacheReadInputTokens}
+	}
+	return usage
+}
+
+// ============================================================================
+// 流式响应转换
+// ============================================================================
+
+func (anthropicProvider) NewStreamDecoder(body io.Reader) StreamDecoder {
+	return &anthropicStreamDecoder{sse: newSSEReader(body), toolIndex: map[int]int{}}
+}
+
+// anthropicStreamDecoder 将 Anthropic 事件流转换为 OpenAI 数据块
+type anthropicStreamDecoder struct {
+	sse       *sseReader
+	id        string
+	model     string
+	created   int64
+	usage     anthropicUsage
+	toolIndex map[int]int // content block index -> tool_calls index
+	pending   []*models.ChatCompletionChunk
+	done      bool
+}
+
+type anthropicStreamEvent struct {
+	Type         string            `json:"type"`
+	Index        int               `json:"index"`
+	Message      anthropicResponse `json:"message"`
+	ContentBlock anthropicBlock    `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (d *anthropicStreamDecoder) Next() (*models.ChatCompletionChunk, []byte, error) {
+	for {
+		if len(d.pending) > 0 {
+			chunk := d.pending[0]
+			d.pending = d.pending[1:]
+			return chunk, nil, nil
+		}
+		if d.done {
+			return nil, nil, io.EOF
+		}
+
+		_, data, err := d.sse.next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var ev anthropicStreamEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil, nil, fmt.Errorf("decode anthropic stream event: %w", err)
+		}
+
+		switch ev.Type {
+		case "message_start":
+			d.id = ev.Message.ID
+			d.model = ev.Message.Model
+			d.created = time.Now().Unix()
+			d.usage = ev.Message.Usage
+			d.emit(models.ChatDelta{Role: "assistant"}, nil)
+		case "content_block_start":
+			if ev.ContentBlock.Type == "tool_use" {
+				idx := len(d.toolIndex)
+				d.toolIndex[ev.Index] = idx
+				d.emit(models.ChatDelta{ToolCalls: []models.ToolCall{{
+					Index:    &idx,
+					ID:       ev.ContentBlock.ID,
+					Type:     "function",
+					Function: models.FunctionCall{Name: ev.ContentBlock.Name},
+				}}}, nil)
+			}
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				d.emit(models.ChatDelta{Content: ev.Delta.Text}, nil)
+			case "input_json_delta":
+				idx := d.toolIndex[ev.Index]
+				d.emit(models.ChatDelta{ToolCalls: []models.ToolCall{{
+					Index:    &idx,
+					Function: models.FunctionCall{Arguments: ev.Delta.PartialJSON},
+				}}}, nil)
+			}
+		case "message_delta":
+			if ev.Usage != nil {
+				d.usage.OutputTokens = ev.Usage.OutputTokens
+			}
+			if ev.Delta.StopReason != "" {
+				d.emit(models.ChatDelta{}, stringPtr(anthropicFinishReason(ev.Delta.StopReason)))
+			}
+		case "message_stop":
+			d.pending = append(d.pending, &models.ChatCompletionChunk{
+				ID:      d.id,
+				Object:  "chat.completion.chunk",
+				Created: d.created,
+				Model:   d.model,
+				Choices: []models.ChatChunkChoice{},
+				Usage:   anthropicChatUsage(d.usage),
+			})
+			d.done = true
+		case "error":
+			if ev.Error != nil {
+				return nil, nil, fmt.Errorf("anthropic stream error: %s: %s", ev.Error.Type, ev.Error.Message)
+			}
+			return nil, nil, fmt.Errorf("anthropic stream error")
+		}
+	}
+}
+
+// emit 生成一个增量数据块
+func (d *anthropicStreamDecoder) emit(delta models.ChatDelta, finishReason *string) {
+	d.pending = append(d.pending, &models.ChatCompletionChunk{
+		ID:      d.id,
+		Object:  "chat.completion.chunk",
+		Created: d.created,
+		Model:   d.model,
+		Choices: []models.ChatChunkChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	})
+}
@@ -0,0 +1,505 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"macg/models"
+)
+
+// geminiProvider Google Gemini generateContent 适配器
+type geminiProvider struct{}
+
+// ============================================================================
+// Gemini 原生数据结构
+// ============================================================================
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"` // user, model
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	CandidateCount  int      `json:"candidateCount,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"` // AUTO, ANY, NONE
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Index        int           `json:"index"`
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+		ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+}
+
+type geminiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// ============================================================================
+// 请求转换
+// ============================================================================
+
+func (geminiProvider) Name() string { return Gemini }
+
+func (geminiProvider) DefaultBaseURL() string {
+	return "https://generativelanguage.googleapis.com/v1beta"
+}
+
+func (geminiProvider) NewRequest(ctx context.Context, baseURL, apiKey string, req *models.ChatCompletionRequest) (*http.Request, error) {
+	native, err := toGeminiRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(native)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	path := "/models/" + url.PathEscape(req.Model) + ":generateContent"
+	if req.Stream {
+		path = "/models/" + url.PathEscape(req.Model) + ":streamGenerateContent?alt=sse"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, joinURL(baseURL, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		httpReq.Header.Set("x-goog-api-key", apiKey)
+	}
+	return httpReq, nil
+}
+
+// toGeminiRequest 统一格式 -> Gemini 格式
+func toGeminiRequest(req *models.ChatCompletionRequest) (*geminiRequest, error) {
+	native := &geminiRequest{
+		GenerationConfig: &geminiGenerationConfig{
+			Temperature:     req.Temperature,
+			TopP:            req.TopP,
+			MaxOutputTokens: req.OutputTokenLimit(),
+			StopSequences:   req.Stop,
+			CandidateCount:  req.N,
+		},
+	}
+
+	// 工具结果消息只携带调用ID，需要从之前的助手消息中找回函数名
+	toolNames := map[string]string{}
+	var systemParts []geminiPart
+
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			systemParts = append(systemParts, geminiPart{Text: m.TextContent()})
+		case "assistant":
+			var parts []geminiPart
+			if text := m.TextContent(); text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+			for _, tc := range m.ToolCalls {
+				toolNames[tc.ID] = tc.Function.Name
+				args := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: tc.Function.Name, Args: args}})
+			}
+			native.appendContent("model", parts)
+		case "tool":
+			name := toolNames[m.ToolCallID]
+			if name == "" {
+				name = m.Name
+			}
+			native.appendContent("user", []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: geminiToolResponse(m.TextContent()),
+			}}})
+		default:
+			native.appendContent("user", geminiUserParts(m))
+		}
+	}
+
+	if len(systemParts) > 0 {
+		native.SystemInstruction = &geminiContent{Parts: systemParts}
+	}
+
+	if len(req.Tools) > 0 {
+		tool := geminiTool{}
+		for _, t := range req.Tools {
+			tool.FunctionDeclarations = append(tool.FunctionDeclarations, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  t.Function.Parameters,
+			})
+		}
+		native.Tools = []geminiTool{tool}
+	}
+	native.ToolConfig = geminiToolChoice(req.ToolChoice)
+
+	if len(native.Contents) == 0 {
+		return nil, fmt.Errorf("gemini requires at least one non-system message")
+	}
+	return native, nil
+}
+
+// appendContent 追加内容，连续同角色内容合并为一条
+func (r *geminiRequest) appendContent(role string, parts []geminiPart) {
+	if len(parts) == 0 {
+		return
+	}
+	if n := len(r.Contents); n > 0 && r.Contents[n-1].Role == role {
+		r.Contents[n-1].Parts = append(r.Contents[n-1].Parts, parts...)
+		return
+	}
+	r.Contents = append(r.Contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiUserParts 转换用户消息内容（文本和图片）
+func geminiUserParts(m models.ChatMessage) []geminiPart {
+	items, ok := m.Content.([]interface{})
+	if !ok {
+		return []geminiPart{{Text: m.TextContent()}}
+	}
+
+	var parts []geminiPart
+	for _, item := range items {
+		p, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch p["type"] {
+		case "text":
+			if text, ok := p["text"].(string); ok {
+				parts = append(parts, geminiPart{Text: text})
+			}
+		case "image_url":
+			url := imageURL(p)
+			if mediaType, data, ok := parseDataURL(url); ok {
+				parts = append(parts, geminiPart{InlineData: &geminiInlineData{MimeType: mediaType, Data: data}})
+			} else if url != "" {
+				parts = append(parts, geminiPart{FileData: &geminiFileData{FileURI: url}})
+			}
+		}
+	}
+	return parts
+}
+
+// geminiToolResponse 工具结果必须是 JSON 对象，非对象内容包装为 {"content": ...}
+func geminiToolResponse(content string) json.RawMessage {
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	wrapped, _ := json.Marshal(map[string]string{"content": content})
+	return wrapped
+}
+
+// geminiToolChoice 转换 tool_choice
+func geminiToolChoice(choice interface{}) *geminiToolConfig {
+	cfg := &geminiToolConfig{}
+	switch v := choice.(type) {
+	case string:
+		switch v {
+		case "auto":
+			cfg.FunctionCallingConfig.Mode = "AUTO"
+		case "required":
+			cfg.FunctionCallingConfig.Mode = "ANY"
+		case "none":
+			cfg.FunctionCallingConfig.Mode = "NONE"
+		default:
+			return nil
+		}
+	case map[string]interface{}:
+		fn, ok := v["function"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		name, ok := fn["name"].(string)
+		if !ok {
+			return nil
+		}
+		cfg.FunctionCallingConfig.Mode = "ANY"
+		cfg.FunctionCallingConfig.AllowedFunctionNames = []string{name}
+	default:
+		return nil
+	}
+	return cfg
+}
+
+// ============================================================================
+// 响应转换
+// ============================================================================
+
+func (geminiProvider) ParseResponse(body []byte) (*models.ChatCompletionResponse, error) {
+	var native geminiResponse
+	if err := json.Unmarshal(body, &native); err != nil {
+		return nil, fmt.Errorf("decode gemini response: %w", err)
+	}
+
+	resp := &models.ChatCompletionResponse{
+		ID:      native.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   native.ModelVersion,
+		Choices: []models.ChatChoice{},
+		Usage:   geminiChatUsage(&native),
+	}
+
+	for _, cand := range native.Candidates {
+		msg := models.ChatMessage{Role: "assistant"}
+		text, toolCalls := geminiParts(cand.Content.Parts)
+		msg.Content = text
+		msg.ToolCalls = toolCalls
+
+		finish := geminiFinishReason(cand.FinishReason)
+		if len(toolCalls) > 0 {
+			finish = "tool_calls"
+		}
+		resp.Choices = append(resp.Choices, models.ChatChoice{
+			Index:        cand.Index,
+			Message:      msg,
+			FinishReason: finish,
+		})
+	}
+	return resp, nil
+}
+
+func (geminiProvider) ParseError(status int, body []byte) models.ChatErrorResponse {
+	var native geminiError
+	if err := json.Unmarshal(body, &native); err == nil && native.Error.Message != "" {
+		return models.ChatErrorResponse{Error: models.ChatError{Message: native.Error.Message, Type: strings.ToLower(native.Error.Status)}}
+	}
+	return genericError(status, body)
+}
+
+// geminiParts 提取文本和函数调用，Gemini 不返回调用ID，按序号生成
+func geminiParts(parts []geminiPart) (string, []models.ToolCall) {
+	var text strings.Builder
+	var toolCalls []models.ToolCall
+	for _, p := range parts {
+		if p.FunctionCall != nil {
+			args := string(p.FunctionCall.Args)
+			if args == "" {
+				args = "{}"
+			}
+			toolCalls = append(toolCalls, models.ToolCall{
+				ID:       "call_" + strconv.Itoa(len(toolCalls)),
+				Type:     "function",
+				Function: models.FunctionCall{Name: p.FunctionCall.Name, Arguments: args},
+			})
+			continue
+		}
+		text.WriteString(p.Text)
+	}
+	return text.String(), toolCalls
+}
+
+// geminiFinishReason 转换停止原因
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// geminiChatUsage 转换用量，思考Token计入输出
+func geminiChatUsage(native *geminiResponse) *models.ChatUsage {
+	if native.UsageMetadata == nil {
+		return nil
+	}
+	u := native.UsageMetadata
+	output := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	usage := &models.ChatUsage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: output,
+		TotalTokens:      u.PromptTokenCount + output,
+	}
+	if u.CachedContentTokenCount > 0 {
+		usage.PromptTokensDetails = &models.PromptTokensDetails{CachedTokens: u.CachedContentTokenCount}
+	}
+	return usage
+}
+
+// ============================================================================
+// 流式响应转换
+// ============================================================================
+
+func (geminiProvider) NewStreamDecoder(body io.Reader) StreamDecoder {
+	return &geminiStreamDecoder{sse: newSSEReader(body), id: "chatcmpl-" + strconv.FormatInt(time.Now().UnixNano(), 36)}
+}
+
+// geminiStreamDecoder 每个 SSE 事件都是一个完整的 GenerateContentResponse 片段
+type geminiStreamDecoder struct {
+	sse       *sseReader
+	id        string
+	model     string
+	started   bool
+	toolCalls int
+	usage     *models.ChatUsage
+	pending   []*models.ChatCompletionChunk
+	done      bool
+}
+
+func (d *geminiStreamDecoder) Next() (*models.ChatCompletionChunk, []byte, error) {
+	for {
+		if len(d.pending) > 0 {
+			chunk := d.pending[0]
+			d.pending = d.pending[1:]
+			return chunk, nil, nil
+		}
+		if d.done {
+			return nil, nil, io.EOF
+		}
+
+		_, data, err := d.sse.next()
+		if err == io.EOF {
+			// Gemini 没有结束标记，流结束时补发用量数据块
+			d.done = true
+			if d.usage != nil {
+				d.pending = append(d.pending, d.chunk(nil, d.usage))
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var native geminiResponse
+		if err := json.Unmarshal(data, &native); err != nil {
+			return nil, nil, fmt.Errorf("decode gemini stream chunk: %w", err)
+		}
+		if u := geminiChatUsage(&native); u != nil {
+			d.usage = u
+		}
+		if native.ModelVersion != "" {
+			d.model = native.ModelVersion
+		}
+
+		for _, cand := range native.Candidates {
+			delta := models.ChatDelta{}
+			if !d.started {
+				delta.Role = "assistant"
+				d.started = true
+			}
+			text, calls := geminiParts(cand.Content.Parts)
+			delta.Content = text
+			for _, call := range calls {
+				idx := d.toolCalls
+				call.ID = "call_" + strconv.Itoa(idx)
+				call.Index = &idx
+				delta.ToolCalls = append(delta.ToolCalls, call)
+				d.toolCalls++
+			}
+
+			var finish *string
+			if cand.FinishReason != "" {
+				reason := geminiFinishReason(cand.FinishReason)
+				if d.toolCalls > 0 {
+					reason = "tool_calls"
+				}
+				finish = &reason
+			}
+			d.pending = append(d.pending, d.chunk([]models.ChatChunkChoice{{Index: cand.Index, Delta: delta, FinishReason: finish}}, nil))
+		}
+	}
+}
+
+// chunk 生成统一格式数据块
+func (d *geminiStreamDecoder) chunk(choices []models.ChatChunkChoice, usage *models.ChatUsage) *models.ChatCompletionChunk {
+	if choices == nil {
+		choices = []models.ChatChunkChoice{}
+	}
+	return &models.ChatCompletionChunk{
+		ID:      d.id,
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   d.model,
+		Choices: choices,
+		Usage:   usage,
+	}
+}
@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"macg/models"
+)
+
+// openAIProvider OpenAI 及兼容接口（统一格式即 OpenAI 格式，原样转发）
+type openAIProvider struct{}
+
+func (openAIProvider) Name() string { return OpenAI }
+
+func (openAIProvider) DefaultBaseURL() string { return "https://api.openai.com/v1" }
+
+func (openAIProvider) NewRequest(ctx context.Context, baseURL, apiKey string, req *models.ChatCompletionRequest) (*http.Request, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, joinURL(baseURL, "/chat/completions"), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if req.Stream {
+		httpReq.Header.Set("Accept", "text/event-stream")
+	}
+	if apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return httpReq, nil
+}
+
+func (openAIProvider) ParseResponse(body []byte) (*models.ChatCompletionResponse, error) {
+	var resp models.ChatCompletionResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("decode openai response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (openAIProvider) ParseError(status int, body []byte) models.ChatErrorResponse {
+	var resp models.ChatErrorResponse
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error.Message != "" {
+		return resp
+	}
+	return genericError(status, body)
+}
+
+func (openAIProvider) NewStreamDecoder(body io.Reader) StreamDecoder {
+	return &openAIStreamDecoder{sse: newSSEReader(body)}
+}
+
+// openAIStreamDecoder 解析 OpenAI SSE 流，保留原始 JSON 以便透传
+type openAIStreamDecoder struct {
+	sse *sseReader
+}
+
+func (d *openAIStreamDecoder) Next() (*models.ChatCompletionChunk, []byte, error) {
+	_, data, err := d.sse.next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.Equal(data, []byte("[DONE]")) {
+		return nil, nil, io.EOF
+	}
+
+	var chunk models.ChatCompletionChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil, nil, fmt.Errorf("decode openai stream chunk: %w", err)
+	}
+	return &chunk, data, nil
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"macg/models"
+)
+
+// ============================================================================
+// 上游厂商适配器
+// 网关内部统一使用 OpenAI 兼容格式（models.ChatCompletionRequest 等），
+// 各适配器负责与厂商原生 JSON 格式之间的相互转换
+// ============================================================================
+
+// Provider 厂商适配器接口
+type Provider interface {
+	// Name 适配器名称，对应 ServiceModel.Provider
+	Name() string
+	// DefaultBaseURL 未配置上游地址时使用的默认地址
+	DefaultBaseURL() string
+	// NewRequest 将统一格式请求转换为厂商原生 HTTP 请求
+	NewRequest(ctx context.Context, baseURL, apiKey string, req *models.ChatCompletionRequest) (*http.Request, error)
+	// ParseResponse 将厂商原生响应体转换为统一格式
+	ParseResponse(body []byte) (*models.ChatCompletionResponse, error)
+	// ParseError 将厂商原生错误响应转换为统一格式
+	ParseError(status int, body []byte) models.ChatErrorResponse
+	// NewStreamDecoder 创建流式响应解码器
+	NewStreamDecoder(body io.Reader) StreamDecoder
+}
+
+// StreamDecoder 流式响应解码器
+type StreamDecoder interface {
+	// Next 返回下一个统一格式的数据块；raw 为可直接转发的 JSON，为空时由调用方序列化
+	// 流结束时返回 io.EOF
+	Next() (chunk *models.ChatCompletionChunk, raw []byte, err error)
+}
+
+const (
+	OpenAI    = "openai"
+	Anthropic = "anthropic"
+	Gemini    = "gemini"
+)
+
+var registry = map[string]Provider{
+	OpenAI:    openAIProvider{},
+	Anthropic: anthropicProvider{},
+	Gemini:    geminiProvider{},
+}
+
+// Get 根据名称获取适配器，名称为空时默认为 OpenAI
+func Get(name string) (Provider, error) {
+	if name == "" {
+		name = OpenAI
+	}
+	p, ok := registry[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider: %s", name)
+	}
+	return p, nil
+}
+
+// Names 返回所有已注册的适配器名称
+func Names() []string {
+	return []string{OpenAI, Anthropic, Gemini}
+}
+
+// joinURL 拼接基础地址和路径
+func joinURL(baseURL, path string) string {
+	return strings.TrimRight(baseURL, "/") + path
+}
+
+// genericError 无法识别的错误响应
+func genericError(status int, body []byte) models.ChatErrorResponse {
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = http.StatusText(status)
+	}
+	return models.ChatErrorResponse{
+		Error: models.ChatError{
+			Message: msg,
+			Type:    "upstream_error",
+		},
+	}
+}
+
+// stringPtr 返回字符串指针
+func stringPtr(s string) *string {
+	return &s
+}
+
+// imageURL 提取 image_url 内容片段中的地址
+func imageURL(part map[string]interface{}) string {
+	switch v := part["image_url"].(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		if url, ok := v["url"].(string); ok {
+			return url
+		}
+	}
+	return ""
+}
+
+// parseDataURL 解析 data:image/png;base64,xxx 形式的地址
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", "", false
+	}
+	return strings.TrimSuffix(meta, ";base64"), data, true
+}
@@ -0,0 +1,503 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"macg/models"
+)
+
+// upstreamCall httptest 上游收到的请求
+type upstreamCall struct {
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+// replay 启动返回录制响应的上游替身，经适配器发送 req，返回上游收到的请求和响应
+func replay(t *testing.T, p Provider, req *models.ChatCompletionRequest, status int, fixture string) (*upstreamCall, *http.Response) {
+	t.Helper()
+
+	payload, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	call := &upstreamCall{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call.path = r.URL.Path
+		call.query = r.URL.RawQuery
+		call.header = r.Header.Clone()
+		call.body, _ = io.ReadAll(r.Body)
+		if filepath.Ext(fixture) == ".sse" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		w.Write(payload)
+	}))
+	t.Cleanup(srv.Close)
+
+	httpReq, err := p.NewRequest(context.Background(), srv.URL, "test-key", req)
+	if err != nil {
+		t.Fatalf("NewRequest: %v", err)
+	}
+	resp, err := srv.Client().Do(httpReq)
+	if err != nil {
+		t.Fatalf("do request: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return call, resp
+}
+
+// sampleRequest 带系统提示、工具调用往返、停止序列的请求
+func sampleRequest(stream bool) *models.ChatCompletionRequest {
+	temperature := 0.2
+	return &models.ChatCompletionRequest{
+		Model: "test-model",
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: "You are terse."},
+			{Role: "user", Content: "Weather in Paris?"},
+			{Role: "assistant", ToolCalls: []models.ToolCall{{
+				ID:       "call_1",
+				Type:     "function",
+				Function: models.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+			}}},
+			{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+		},
+		MaxTokens:   256,
+		Temperature: &temperature,
+		Stop:        models.StopSequences{"END"},
+		Stream:      stream,
+		Tools: []models.Tool{{
+			Type: "function",
+			Function: models.FunctionDefinition{
+				Name:        "get_weather",
+				Description: "Look up weather",
+				Parameters:  json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+			},
+		}},
+		ToolChoice: "required",
+	}
+}
+
+// streamResult 流式响应汇总
+type streamResult struct {
+	chunks    int
+	raw       int
+	content   string
+	toolCalls map[int]*models.ToolCall
+	finish    string
+	usage     *models.ChatUsage
+}
+
+// drain 读完整个流并汇总增量
+func drain(t *testing.T, d StreamDecoder) *streamResult {
+	t.Helper()
+
+	res := &streamResult{toolCalls: map[int]*models.ToolCall{}}
+	for {
+		chunk, raw, err := d.Next()
+		if errors.Is(err, io.EOF) {
+			return res
+		}
+		if err != nil {
+			t.Fatalf("stream: %v", err)
+		}
+		res.chunks++
+		if len(raw) > 0 {
+			res.raw++
+		}
+		if chunk.Usage != nil {
+			res.usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			res.content += choice.Delta.Content
+			if choice.FinishReason != nil {
+				res.finish = *choice.FinishReason
+			}
+			for _, tc := range choice.Delta.ToolCalls {
+				if tc.Index == nil {
+					t.Fatalf("stream tool call without index: %+v", tc)
+				}
+				acc, ok := res.toolCalls[*tc.Index]
+				if !ok {
+					acc = &models.ToolCall{}
+					res.toolCalls[*tc.Index] = acc
+				}
+				if tc.ID != "" {
+					acc.ID = tc.ID
+				}
+				if tc.Function.Name != "" {
+					acc.Function.Name = tc.Function.Name
+				}
+				acc.Function.Arguments += tc.Function.Arguments
+			}
+		}
+	}
+}
+
+// assertJSONEqual 比较两段 JSON 的语义是否一致
+func assertJSONEqual(t *testing.T, name, got, want string) {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal([]byte(got), &g); err != nil {
+		t.Fatalf("%s: invalid json %q: %v", name, got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("%s: invalid want json: %v", name, err)
+	}
+	gb, _ := json.Marshal(g)
+	wb, _ := json.Marshal(w)
+	if !bytes.Equal(gb, wb) {
+		t.Errorf("%s = %s, want %s", name, gb, wb)
+	}
+}
+
+// assertUsage 比较用量映射
+func assertUsage(t *testing.T, got *models.ChatUsage, prompt, completion, total, cached int) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatal("usage missing")
+	}
+	if got.PromptTokens != prompt || got.CompletionTokens != completion || got.TotalTokens != total {
+		t.Errorf("usage = %d/%d/%d, want %d/%d/%d", got.PromptTokens, got.CompletionTokens, got.TotalTokens, prompt, completion, total)
+	}
+	gotCached := 0
+	if got.PromptTokensDetails != nil {
+		gotCached = got.PromptTokensDetails.CachedTokens
+	}
+	if gotCached != cached {
+		t.Errorf("cached tokens = %d, want %d", gotCached, cached)
+	}
+}
+
+func readAll(t *testing.T, resp *http.Response) []byte {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return body
+}
+
+func TestGet(t *testing.T) {
+	for _, name := range []string{"", "openai", "Anthropic", "GEMINI"} {
+		if _, err := Get(name); err != nil {
+			t.Errorf("Get(%q): %v", name, err)
+		}
+	}
+	if _, err := Get("mistral"); err == nil {
+		t.Error("Get(unknown) should fail")
+	}
+}
+
+// ============================================================================
+// OpenAI
+// ============================================================================
+
+func TestOpenAIRoundTrip(t *testing.T) {
+	p, _ := Get(OpenAI)
+	call, resp := replay(t, p, sampleRequest(false), http.StatusOK, "openai_response.json")
+
+	if call.path != "/chat/completions" {
+		t.Errorf("path = %q", call.path)
+	}
+	if got := call.header.Get("Authorization"); got != "Bearer test-key" {
+		t.Errorf("Authorization = %q", got)
+	}
+
+	// 统一格式即 OpenAI 格式，请求原样转发
+	var sent models.ChatCompletionRequest
+	if err := json.Unmarshal(call.body, &sent); err != nil {
+		t.Fatalf("decode upstream body: %v", err)
+	}
+	if len(sent.Messages) != 4 || sent.Messages[0].Role != "system" || sent.Messages[3].ToolCallID != "call_1" {
+		t.Errorf("messages = %+v", sent.Messages)
+	}
+	if len(sent.Stop) != 1 || sent.Stop[0] != "END" || sent.MaxTokens != 256 {
+		t.Errorf("stop/max_tokens = %v/%d", sent.Stop, sent.MaxTokens)
+	}
+	if len(sent.Tools) != 1 || sent.Tools[0].Function.Name != "get_weather" || sent.ToolChoice != "required" {
+		t.Errorf("tools = %+v, tool_choice = %v", sent.Tools, sent.ToolChoice)
+	}
+
+	out, err := p.ParseResponse(readAll(t, resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice := out.Choices[0]
+	if choice.FinishReason != "tool_calls" || len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("choice = %+v", choice)
+	}
+	tc := choice.Message.ToolCalls[0]
+	if tc.ID != "call_abc" || tc.Function.Name != "get_weather" {
+		t.Errorf("tool call = %+v", tc)
+	}
+	assertJSONEqual(t, "arguments", tc.Function.Arguments, `{"city":"Paris"}`)
+	assertUsage(t, out.Usage, 82, 17, 99, 64)
+}
+
+func TestOpenAIPassesThroughUnknownParameters(t *testing.T) {
+	var req models.ChatCompletionRequest
+	body := `{"model":"test-model","messages":[{"role":"user","content":"hi"}],"max_completion_tokens":64,
+		"response_format":{"type":"json_object"},"seed":7,"logprobs":true,"top_logprobs":2,"logit_bias":{"50256":-100},"parallel_tool_calls":false}`
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.OutputTokenLimit() != 64 {
+		t.Errorf("OutputTokenLimit = %d", req.OutputTokenLimit())
+	}
+	req.Model = "upstream-model" // 网关改写的已建模字段不被原始参数覆盖
+
+	p, _ := Get(OpenAI)
+	call, _ := replay(t, p, &req, http.StatusOK, "openai_response.json")
+
+	var sent map[string]json.RawMessage
+	if err := json.Unmarshal(call.body, &sent); err != nil {
+		t.Fatalf("decode upstream body: %v", err)
+	}
+	want := map[string]string{
+		"model":                 `"upstream-model"`,
+		"max_completion_tokens": `64`,
+		"response_format":       `{"type":"json_object"}`,
+		"seed":                  `7`,
+		"logprobs":              `true`,
+		"top_logprobs":          `2`,
+		"logit_bias":            `{"50256":-100}`,
+		"parallel_tool_calls":   `false`,
+	}
+	for name, value := range want {
+		if string(sent[name]) != value {
+			t.Errorf("%s = %s, want %s", name, sent[name], value)
+		}
+	}
+}
+
+func TestOpenAIStream(t *testing.T) {
+	p, _ := Get(OpenAI)
+	call, resp := replay(t, p, sampleRequest(true), http.StatusOK, "openai_stream.sse")
+
+	if got := call.header.Get("Accept"); got != "text/event-stream" {
+		t.Errorf("Accept = %q", got)
+	}
+
+	res := drain(t, p.NewStreamDecoder(resp.Body))
+	if res.chunks != 5 || res.raw != res.chunks {
+		t.Errorf("chunks = %d (raw %d), want 5 passed through", res.chunks, res.raw)
+	}
+	if res.content != "It is sunny." || res.finish != "stop" {
+		t.Errorf("content = %q, finish = %q", res.content, res.finish)
+	}
+	assertUsage(t, res.usage, 90, 4, 94, 0)
+}
+
+// ============================================================================
+// Anthropic
+// ============================================================================
+
+func TestAnthropicRoundTrip(t *testing.T) {
+	p, _ := Get(Anthropic)
+	call, resp := replay(t, p, sampleRequest(false), http.StatusOK, "anthropic_response.json")
+
+	if call.path != "/messages" {
+		t.Errorf("path = %q", call.path)
+	}
+	if call.header.Get("x-api-key") != "test-key" || call.header.Get("anthropic-version") != anthropicVersion {
+		t.Errorf("headers = %v", call.header)
+	}
+
+	var sent anthropicRequest
+	if err := json.Unmarshal(call.body, &sent); err != nil {
+		t.Fatalf("decode upstream body: %v", err)
+	}
+	if sent.System != "You are terse." {
+		t.Errorf("system = %q", sent.System)
+	}
+	if sent.MaxTokens != 256 || len(sent.StopSequences) != 1 || sent.StopSequences[0] != "END" {
+		t.Errorf("max_tokens/stop = %d/%v", sent.MaxTokens, sent.StopSequences)
+	}
+	if len(sent.Messages) != 3 {
+		t.Fatalf("messages = %+v", sent.Messages)
+	}
+	if m := sent.Messages[0]; m.Role != "user" || m.Content[0].Text != "Weather in Paris?" {
+		t.Errorf("user message = %+v", m)
+	}
+	use := sent.Messages[1].Content[0]
+	if sent.Messages[1].Role != "assistant" || use.Type != "tool_use" || use.ID != "call_1" || use.Name != "get_weather" {
+		t.Errorf("tool_use = %+v", use)
+	}
+	assertJSONEqual(t, "tool_use.input", string(use.Input), `{"city":"Paris"}`)
+	result := sent.Messages[2].Content[0]
+	if sent.Messages[2].Role != "user" || result.Type != "tool_result" || result.ToolUseID != "call_1" || result.Content != "sunny" {
+		t.Errorf("tool_result = %+v", result)
+	}
+	if len(sent.Tools) != 1 || sent.Tools[0].Name != "get_weather" {
+		t.Fatalf("tools = %+v", sent.Tools)
+	}
+	assertJSONEqual(t, "input_schema", string(sent.Tools[0].InputSchema), `{"type":"object","properties":{"city":{"type":"string"}}}`)
+	choice, _ := json.Marshal(sent.ToolChoice)
+	assertJSONEqual(t, "tool_choice", string(choice), `{"type":"any"}`)
+
+	out, err := p.ParseResponse(readAll(t, resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := out.Choices[0]
+	if out.ID != "msg_01XFD" || c.Message.Content != "Let me check." || c.FinishReason != "tool_calls" {
+		t.Errorf("response = %+v", out)
+	}
+	if len(c.Message.ToolCalls) != 1 || c.Message.ToolCalls[0].ID != "toolu_01A" {
+		t.Fatalf("tool calls = %+v", c.Message.ToolCalls)
+	}
+	assertJSONEqual(t, "arguments", c.Message.ToolCalls[0].Function.Arguments, `{"city":"Paris"}`)
+	// 缓存读取和写入都计入输入
+	assertUsage(t, out.Usage, 82, 21, 103, 30)
+}
+
+func TestAnthropicStream(t *testing.T) {
+	p, _ := Get(Anthropic)
+	call, resp := replay(t, p, sampleRequest(true), http.StatusOK, "anthropic_stream.sse")
+
+	var sent anthropicRequest
+	if err := json.Unmarshal(call.body, &sent); err != nil || !sent.Stream {
+		t.Fatalf("stream flag not sent: %v", err)
+	}
+
+	res := drain(t, p.NewStreamDecoder(resp.Body))
+	if res.content != "Checking now." || res.finish != "tool_calls" {
+		t.Errorf("content = %q, finish = %q", res.content, res.finish)
+	}
+	tc := res.toolCalls[0]
+	if len(res.toolCalls) != 1 || tc.ID != "toolu_01B" || tc.Function.Name != "get_weather" {
+		t.Fatalf("tool calls = %+v", res.toolCalls)
+	}
+	assertJSONEqual(t, "arguments", tc.Function.Arguments, `{"city":"Paris"}`)
+	assertUsage(t, res.usage, 50, 25, 75, 10)
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	body := "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"
+	d := anthropicProvider{}.NewStreamDecoder(bytes.NewReader([]byte(body)))
+	if _, _, err := d.Next(); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("err = %v, want stream error", err)
+	}
+}
+
+// ============================================================================
+// Gemini
+// ============================================================================
+
+func TestGeminiRoundTrip(t *testing.T) {
+	p, _ := Get(Gemini)
+	call, resp := replay(t, p, sampleRequest(false), http.StatusOK, "gemini_response.json")
+
+	if call.path != "/models/test-model:generateContent" || call.query != "" {
+		t.Errorf("path = %q?%s", call.path, call.query)
+	}
+	if call.header.Get("x-goog-api-key") != "test-key" {
+		t.Errorf("headers = %v", call.header)
+	}
+
+	var sent geminiRequest
+	if err := json.Unmarshal(call.body, &sent); err != nil {
+		t.Fatalf("decode upstream body: %v", err)
+	}
+	if sent.SystemInstruction == nil || sent.SystemInstruction.Parts[0].Text != "You are terse." {
+		t.Errorf("systemInstruction = %+v", sent.SystemInstruction)
+	}
+	cfg := sent.GenerationConfig
+	if cfg.MaxOutputTokens != 256 || len(cfg.StopSequences) != 1 || cfg.StopSequences[0] != "END" || cfg.Temperature == nil {
+		t.Errorf("generationConfig = %+v", cfg)
+	}
+	if len(sent.Contents) != 3 {
+		t.Fatalf("contents = %+v", sent.Contents)
+	}
+	if fc := sent.Contents[1].Parts[0].FunctionCall; sent.Contents[1].Role != "model" || fc == nil || fc.Name != "get_weather" {
+		t.Errorf("functionCall = %+v", sent.Contents[1])
+	}
+	fr := sent.Contents[2].Parts[0].FunctionResponse
+	if fr == nil || fr.Name != "get_weather" {
+		t.Fatalf("functionResponse = %+v", sent.Contents[2])
+	}
+	// 非 JSON 的工具结果包装为对象
+	assertJSONEqual(t, "functionResponse.response", string(fr.Response), `{"content":"sunny"}`)
+	if len(sent.Tools) != 1 || sent.Tools[0].FunctionDeclarations[0].Name != "get_weather" {
+		t.Errorf("tools = %+v", sent.Tools)
+	}
+	if sent.ToolConfig == nil || sent.ToolConfig.FunctionCallingConfig.Mode != "ANY" {
+		t.Errorf("toolConfig = %+v", sent.ToolConfig)
+	}
+
+	out, err := p.ParseResponse(readAll(t, resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := out.Choices[0]
+	if out.ID != "resp-gem-1" || out.Model != "gemini-2.5-flash" || c.Message.Content != "Checking the weather." {
+		t.Errorf("response = %+v", out)
+	}
+	// 有函数调用时停止原因为 tool_calls
+	if c.FinishReason != "tool_calls" || len(c.Message.ToolCalls) != 1 || c.Message.ToolCalls[0].ID != "call_0" {
+		t.Fatalf("choice = %+v", c)
+	}
+	assertJSONEqual(t, "arguments", c.Message.ToolCalls[0].Function.Arguments, `{"city":"Paris"}`)
+	// 思考 Token 计入输出
+	assertUsage(t, out.Usage, 70, 20, 90, 20)
+}
+
+func TestGeminiStream(t *testing.T) {
+	p, _ := Get(Gemini)
+	call, resp := replay(t, p, sampleRequest(true), http.StatusOK, "gemini_stream.sse")
+
+	if call.path != "/models/test-model:streamGenerateContent" || call.query != "alt=sse" {
+		t.Errorf("path = %q?%s", call.path, call.query)
+	}
+
+	res := drain(t, p.NewStreamDecoder(resp.Body))
+	if res.content != "It is sunny." || res.finish != "length" {
+		t.Errorf("content = %q, finish = %q", res.content, res.finish)
+	}
+	// 流结束时补发最后一次的用量
+	assertUsage(t, res.usage, 60, 7, 67, 0)
+}
+
+// ============================================================================
+// 错误响应
+// ============================================================================
+
+func TestParseError(t *testing.T) {
+	cases := []struct {
+		provider string
+		status   int
+		body     string
+		message  string
+		kind     string
+	}{
+		{OpenAI, 401, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`, "Incorrect API key provided", "invalid_request_error"},
+		{Anthropic, 529, `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`, "Overloaded", "overloaded_error"},
+		{Gemini, 400, `{"error":{"code":400,"message":"API key not valid.","status":"INVALID_ARGUMENT"}}`, "API key not valid.", "invalid_argument"},
+		{Gemini, 502, `<html>Bad Gateway</html>`, "<html>Bad Gateway</html>", "upstream_error"},
+		{OpenAI, 503, ``, "Service Unavailable", "upstream_error"},
+	}
+	for _, tc := range cases {
+		p, _ := Get(tc.provider)
+		got := p.ParseError(tc.status, []byte(tc.body))
+		if got.Error.Message != tc.message || got.Error.Type != tc.kind {
+			t.Errorf("%s %d: got %+v, want %q/%q", tc.provider, tc.status, got.Error, tc.message, tc.kind)
+		}
+	}
+}
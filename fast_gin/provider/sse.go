@@ -0,0 +1,49 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// sseReader 逐条读取 SSE 事件
+type sseReader struct {
+	reader *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// next 返回下一个事件的 event 名称与 data 内容，流结束时返回 io.EOF
+func (s *sseReader) next() (event string, data []byte, err error) {
+	var buf bytes.Buffer
+	for {
+		line, readErr := s.reader.ReadBytes('\n')
+		line = bytes.TrimRight(line, "\r\n")
+
+		switch {
+		case len(line) == 0:
+			// 空行表示一个事件结束
+			if buf.Len() > 0 {
+				return event, buf.Bytes(), nil
+			}
+		case bytes.HasPrefix(line, []byte(":")):
+			// 注释行（心跳）
+		case bytes.HasPrefix(line, []byte("event:")):
+			event = string(bytes.TrimSpace(line[len("event:"):]))
+		case bytes.HasPrefix(line, []byte("data:")):
+			if buf.Len() > 0 {
+				buf.WriteByte('\n')
+			}
+			buf.Write(bytes.TrimPrefix(line[len("data:"):], []byte(" ")))
+		}
+
+		if readErr != nil {
+			if buf.Len() > 0 {
+				return event, buf.Bytes(), nil
+			}
+			return "", nil, readErr
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"macg/models"
+
+	"go.uber.org/zap"
+)
+
+// DBStore 数据库令牌桶存储，多实例共享限流状态
+type DBStore struct{}
+
+// NewDBStore 创建数据库存储，并定期清理长时间未使用的桶
+func NewDBStore() *DBStore {
+	s := &DBStore{}
+	go s.cleanup(10 * time.Minute)
+	return s
+}
+
+// Take 实现 Store
+func (s *DBStore) Take(ctx context.Context, key string, limit Limit, n int) (Result, error) {
+	var result Result
+	err := models.UpdateRateLimitBucket(key, float64(limit.Capacity), func(tokens *float64, updatedAt *time.Time) {
+		b := bucket{tokens: *tokens, updatedAt: *updatedAt}
+		result = b.take(limit, n, time.Now())
+		*tokens, *updatedAt = b.tokens, b.updatedAt
+	})
+	return result, err
+}
+
+// Consume 实现 Store
+func (s *DBStore) Consume(ctx context.Context, key string, limit Limit, n int) error {
+	return models.UpdateRateLimitBucket(key, float64(limit.Capacity), func(tokens *float64, updatedAt *time.Time) {
+		b := bucket{tokens: *tokens, updatedAt: *updatedAt}
+		b.consume(limit, n, time.Now())
+		*tokens, *updatedAt = b.tokens, b.updatedAt
+	})
+}
+
+// cleanup 删除一小时未更新的桶
+func (s *DBStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if _, err := models.PruneRateLimitBuckets(now.Add(-time.Hour)); err != nil {
+			zap.L().Error("清理限流令牌桶失败", zap.Error(err))
+		}
+	}
+}
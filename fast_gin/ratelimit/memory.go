@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内令牌桶存储，适用于单实例部署
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+// NewMemoryStore 创建内存存储，并定期清理已恢复满的空闲桶
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{buckets: make(map[string]*memoryBucket)}
+	go s.cleanup(time.Minute)
+	return s
+}
+
+// Take 实现 Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit, n int) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(key, limit).take(limit, n, time.Now()), nil
+}
+
+// Consume 实现 Store
+func (s *MemoryStore) Consume(ctx context.Context, key string, limit Limit, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(key, limit).consume(limit, n, time.Now())
+	return nil
+}
+
+// get 获取或创建桶，调用方需持有锁
+func (s *MemoryStore) get(key string, limit Limit) *memoryBucket {
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{bucket: newBucket(limit, time.Now())}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	return b
+}
+
+// cleanup 删除空闲时长超过两个窗口的桶（透支最多一个容量，此时已恢复满，删除不影响结果）
+func (s *MemoryStore) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mu.Lock()
+		for key, b := range s.buckets {
+			if now.Sub(b.updatedAt) > 2*b.limit.Window {
+				delete(s.buckets, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
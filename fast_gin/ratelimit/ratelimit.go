@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"macg/core"
+
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// 令牌桶限流
+// 每个桶容量为 Capacity，令牌在 Window 内匀速恢复满，例如 60 RPM 即每秒恢复一个令牌
+// ============================================================================
+
+// Limit 限流规则，Capacity 为0表示不限制
+type Limit struct {
+	Capacity int
+	Window   time.Duration
+}
+
+// PerMinute 每分钟 n 个令牌
+func PerMinute(n int) Limit {
+	return Limit{Capacity: n, Window: time.Minute}
+}
+
+// Unlimited 是否不限制
+func (l Limit) Unlimited() bool {
+	return l.Capacity <= 0
+}
+
+// rate 每秒恢复的令牌数
+func (l Limit) rate() float64 {
+	return float64(l.Capacity) / l.Window.Seconds()
+}
+
+// Result 一次取令牌的结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // 被拒绝时需要等待的时长
+	Reset      time.Duration // 桶恢复满所需时长
+}
+
+// Store 令牌桶存储
+type Store interface {
+	// Take 尝试取出 n 个令牌，不足时不扣除；n 为0时只检查桶是否已耗尽
+	Take(ctx context.Context, key string, limit Limit, n int) (Result, error)
+	// Consume 强制扣除 n 个令牌（允许透支），用于请求结束后按实际 Token 数记账；n 为负数时归还令牌
+	Consume(ctx context.Context, key string, limit Limit, n int) error
+}
+
+// bucket 令牌桶状态
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// newBucket 创建满桶
+func newBucket(limit Limit, now time.Time) bucket {
+	return bucket{tokens: float64(limit.Capacity), updatedAt: now}
+}
+
+// refill 按流逝时间恢复令牌，容量调小时截断到新容量
+func (b *bucket) refill(limit Limit, now time.Time) {
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * limit.rate()
+	}
+	b.tokens = math.Min(b.tokens, float64(limit.Capacity))
+	b.updatedAt = now
+}
+
+// take 取出 n 个令牌
+func (b *bucket) take(limit Limit, n int, now time.Time) Result {
+	b.refill(limit, now)
+
+	allowed := b.tokens > 0
+	if n > 0 {
+		allowed = b.tokens >= float64(n)
+	}
+	if allowed {
+		b.tokens -= float64(n)
+	}
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     limit.Capacity,
+		Remaining: max(int(b.tokens), 0),
+		Reset:     secondsToDuration((float64(limit.Capacity) - b.tokens) / limit.rate()),
+	}
+	if !allowed {
+		need := float64(max(n, 1)) - b.tokens
+		result.RetryAfter = secondsToDuration(need / limit.rate())
+	}
+	return result
+}
+
+// consume 强制扣除 n 个令牌，透支最多一个容量；归还时不超过容量
+func (b *bucket) consume(limit Limit, n int, now time.Time) {
+	b.refill(limit, now)
+	b.tokens = math.Min(math.Max(b.tokens-float64(n), -float64(limit.Capacity)), float64(limit.Capacity))
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// ============================================================================
+// 全局存储
+// ============================================================================
+
+var (
+	defaultStore Store
+	initOnce     sync.Once
+)
+
+// Init 按配置初始化限流存储，只在首次调用时创建，避免重复启动清理协程
+func Init() {
+	initOnce.Do(func() {
+		switch core.Cfg.RateLimit.Store {
+		case "database":
+			defaultStore = NewDBStore()
+		default:
+			defaultStore = NewMemoryStore()
+		}
+		zap.L().Info("限流存储初始化完成", zap.String("store", core.Cfg.RateLimit.Store))
+	})
+}
+
+// Default 返回全局限流存储，未初始化时按当前配置初始化
+func Default() Store {
+	Init()
+	return defaultStore
+}
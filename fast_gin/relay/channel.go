@@ -0,0 +1,260 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"macg/core"
+	"macg/models"
+	"macg/provider"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// 渠道选择与故障转移
+// ============================================================================
+
+// ejected 被临时剔除的渠道：channelID -> 恢复时间
+var ejected sync.Map
+
+// ejectDuration 失败渠道的剔除时长
+func ejectDuration() time.Duration {
+	if core.Cfg.Relay.EjectSeconds <= 0 {
+		return 60 * time.Second
+	}
+	return time.Duration(core.Cfg.Relay.EjectSeconds) * time.Second
+}
+
+// maxAttempts 单次请求最多尝试的渠道数
+func maxAttempts() int {
+	if core.Cfg.Relay.MaxAttempts <= 0 {
+		return 3
+	}
+	return core.Cfg.Relay.MaxAttempts
+}
+
+// eject 临时剔除渠道
+func eject(channelID uuid.UUID) {
+	ejected.Store(channelID, time.Now().Add(ejectDuration()))
+}
+
+// isEjected 判断渠道是否处于剔除期
+func isEjected(channelID uuid.UUID) bool {
+	v, ok := ejected.Load(channelID)
+	if !ok {
+		return false
+	}
+	if time.Now().After(v.(time.Time)) {
+		ejected.Delete(channelID)
+		return false
+	}
+	return true
+}
+
+// Candidates 返回服务的候选上游列表
+// 按优先级从高到低分组，组内按权重随机排序；处于剔除期的渠道排在最后作为兜底。
+// 服务未配置渠道时返回配置文件中的默认上游
+func Candidates(service *models.ServiceModel) ([]Upstream, error) {
+	p, err := provider.Get(service.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := models.GetEnabledChannels(service.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		up, err := DefaultUpstream(service.Provider)
+		if err != nil {
+			return nil, err
+		}
+		return []Upstream{up}, nil
+	}
+
+	var healthy, sick []models.Channel
+	for _, ch := range channels {
+		if isEjected(ch.ID) {
+			sick = append(sick, ch)
+		} else {
+			healthy = append(healthy, ch)
+		}
+	}
+
+	ordered := append(orderByPriority(healthy), orderByPriority(sick)...)
+	upstreams := make([]Upstream, 0, len(ordered))
+	for i := range ordered {
+		ch := ordered[i]
+		apiKey, err := ch.DecryptAPIKey()
+		if err != nil {
+			zap.L().Error("渠道密钥解密失败，跳过该渠道", zap.String("channel_id", ch.ID.String()), zap.Error(err))
+			continue
+		}
+		baseURL := ch.BaseURL
+		if baseURL == "" {
+			baseURL = p.DefaultBaseURL()
+		}
+		upstreams = append(upstreams, Upstream{
+			Provider:  p,
+			BaseURL:   baseURL,
+			APIKey:    apiKey,
+			ChannelID: &ch.ID,
+		})
+	}
+	if len(upstreams) == 0 {
+		return nil, errors.New("no usable channel")
+	}
+	return upstreams, nil
+}
+
+// orderByPriority 按优先级分组，组内按权重做加权随机排列
+func orderByPriority(channels []models.Channel) []models.Channel {
+	groups := map[int][]models.Channel{}
+	var priorities []int
+	for _, ch := range channels {
+		if _, ok := groups[ch.Priority]; !ok {
+			priorities = append(priorities, ch.Priority)
+		}
+		groups[ch.Priority] = append(groups[ch.Priority], ch)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+
+	result := make([]models.Channel, 0, len(channels))
+	for _, pri := range priorities {
+		result = append(result, weightedShuffle(groups[pri])...)
+	}
+	return result
+}
+
+// weightedShuffle 按权重不放回地随机抽取
+func weightedShuffle(channels []models.Channel) []models.Channel {
+	pool := append([]models.Channel(nil), channels...)
+	result := make([]models.Channel, 0, len(pool))
+	for len(pool) > 0 {
+		total := 0
+		for _, ch := range pool {
+			total += max(ch.Weight, 1)
+		}
+		n := rand.Intn(total)
+		for i, ch := range pool {
+			n -= max(ch.Weight, 1)
+			if n < 0 {
+				result = append(result, ch)
+				pool = append(pool[:i], pool[i+1:]...)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// isRetryable 判断错误是否应切换到下一个渠道：429、5xx 和超时/网络错误
+func isRetryable(err error) bool {
+	var upErr *UpstreamError
+	if errors.As(err, &upErr) {
+		return upErr.StatusCode == http.StatusTooManyRequests || upErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// withFailover 依次尝试候选上游，直到成功、遇到不可重试的错误或达到最大尝试次数
+func withFailover(ctx context.Context, service *models.ServiceModel, requestID string, call func(up Upstream) error) error {
+	upstreams, err := Candidates(service)
+	if err != nil {
+		return err
+	}
+	if len(upstreams) > maxAttempts() {
+		upstreams = upstreams[:maxAttempts()]
+	}
+
+	var lastErr error
+	for i, up := range upstreams {
+		start := time.Now()
+		err := call(up)
+
+		attempt := &models.RelayAttempt{
+			RequestID: requestID,
+			ServiceID: service.ID,
+			ChannelID: up.ChannelID,
+			Attempt:   i + 1,
+			LatencyMs: time.Since(start).Milliseconds(),
+		}
+
+		switch {
+		case err == nil:
+			attempt.StatusCode = http.StatusOK
+			attempt.Decision = "success"
+		case ctx.Err() != nil:
+			// 客户端已断开，不再重试
+			attempt.Decision = "abort"
+		case isRetryable(err):
+			attempt.Decision = "failover"
+			if up.ChannelID != nil {
+				eject(*up.ChannelID)
+				attempt.Decision = "ejected"
+			}
+		default:
+			attempt.Decision = "abort"
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+			var upErr *UpstreamError
+			if errors.As(err, &upErr) {
+				attempt.StatusCode = upErr.StatusCode
+			}
+		}
+
+		if recErr := models.RecordRelayAttempt(attempt); recErr != nil {
+			zap.L().Error("记录转发尝试失败", zap.String("request_id", requestID), zap.Error(recErr))
+		}
+
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if attempt.Decision == "abort" {
+			return err
+		}
+		zap.L().Warn("渠道请求失败，尝试下一个渠道",
+			zap.String("request_id", requestID),
+			zap.Int("attempt", i+1),
+			zap.String("decision", attempt.Decision),
+			zap.Error(err),
+		)
+	}
+	return lastErr
+}
+
+// ChatCompletionWithFailover 带故障转移的对话补全
+func ChatCompletionWithFailover(ctx context.Context, service *models.ServiceModel, requestID string, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	var resp *models.ChatCompletionResponse
+	err := withFailover(ctx, service, requestID, func(up Upstream) error {
+		var err error
+		resp, err = ChatCompletion(ctx, up, req)
+		return err
+	})
+	return resp, err
+}
+
+// ChatCompletionStreamWithFailover 带故障转移的流式对话补全，只在收到响应头之前切换渠道
+func ChatCompletionStreamWithFailover(ctx context.Context, service *models.ServiceModel, requestID string, req *models.ChatCompletionRequest) (*Stream, error) {
+	var stream *Stream
+	err := withFailover(ctx, service, requestID, func(up Upstream) error {
+		var err error
+		stream, err = ChatCompletionStream(ctx, up, req)
+		return err
+	})
+	return stream, err
+}
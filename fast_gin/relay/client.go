@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"macg/core"
+	"macg/models"
+	"macg/provider"
+
+	"github.com/google/uuid"
+)
+
+// Upstream 上游连接信息
+type Upstream struct {
+	Provider  provider.Provider
+	BaseURL   string
+	APIKey    string
+	ChannelID *uuid.UUID // 为空表示使用配置文件中的默认上游
+}
+
+// UpstreamError 上游返回的非 2xx 响应
+type UpstreamError struct {
+	StatusCode int
+	Body       []byte
+	provider   provider.Provider
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("upstream returned status %d: %s", e.StatusCode, string(e.Body))
+}
+
+// Response 转换为 OpenAI 风格的错误响应
+func (e *UpstreamError) Response() models.ChatErrorResponse {
+	return e.provider.ParseError(e.StatusCode, e.Body)
+}
+
+var httpClient = &http.Client{}
+
+// DefaultUpstream 根据厂商名称从配置文件读取默认上游
+func DefaultUpstream(providerName string) (Upstream, error) {
+	p, err := provider.Get(providerName)
+	if err != nil {
+		return Upstream{}, err
+	}
+
+	cfg := core.Cfg.Relay.Providers[p.Name()]
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = p.DefaultBaseURL()
+	}
+
+	return Upstream{
+		Provider: p,
+		BaseURL:  baseURL,
+		APIKey:   cfg.APIKey,
+	}, nil
+}
+
+// Timeout 单次上游请求的超时时间
+func Timeout() time.Duration {
+	if core.Cfg.Relay.Timeout <= 0 {
+		return 120 * time.Second
+	}
+	return time.Duration(core.Cfg.Relay.Timeout) * time.Second
+}
+
+// ChatCompletion 将对话补全请求转发至上游并解析响应
+func ChatCompletion(ctx context.Context, up Upstream, req *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout())
+	defer cancel()
+
+	httpReq, err := up.Provider.NewRequest(ctx, up.BaseURL, up.APIKey, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("call upstream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read upstream response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &UpstreamError{StatusCode: resp.StatusCode, Body: respBody, provider: up.Provider}
+	}
+
+	return up.Provider.ParseResponse(respBody)
+}
@@ -0,0 +1,238 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"macg/core"
+	"macg/models"
+
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// 上游健康探测
+// 定期向每个服务发送最小请求，记录结果并据此维护 Status 和 Uptime。
+// 状态切换带滞后：连续失败达到阈值才降级，连续成功达到阈值才恢复
+// ============================================================================
+
+// probeSettings 补全默认值后的探测配置
+func probeSettings() core.ProbeConfig {
+	cfg := core.Cfg.Relay.Probe
+	if cfg.Interval <= 0 {
+		cfg.Interval = 300
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30
+	}
+	if cfg.WindowHours <= 0 {
+		cfg.WindowHours = 24
+	}
+	if cfg.FailThreshold <= 0 {
+		cfg.FailThreshold = 3
+	}
+	if cfg.DownThreshold < cfg.FailThreshold {
+		cfg.DownThreshold = max(cfg.FailThreshold, 10)
+	}
+	if cfg.RecoverThreshold <= 0 {
+		cfg.RecoverThreshold = 2
+	}
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = 7
+	}
+	return cfg
+}
+
+// StartProber 启动后台健康探测，ctx 取消后退出
+func StartProber(ctx context.Context) {
+	if !core.Cfg.Relay.Probe.Enabled {
+		zap.L().Info("上游健康探测未启用")
+		return
+	}
+
+	cfg := probeSettings()
+	zap.L().Info("启动上游健康探测", zap.Int("interval", cfg.Interval))
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			ProbeAll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ProbeAll 对所有自动维护状态的服务执行一轮探测
+func ProbeAll(ctx context.Context) {
+	cfg := probeSettings()
+
+	services, err := models.GetAutoStatusServices()
+	if err != nil {
+		zap.L().Error("获取待探测服务失败", zap.Error(err))
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := range services {
+		wg.Add(1)
+		go func(service *models.ServiceModel) {
+			defer wg.Done()
+			probeService(ctx, service, cfg)
+		}(&services[i])
+	}
+	wg.Wait()
+
+	before := time.Now().AddDate(0, 0, -cfg.RetentionDays)
+	if _, err := models.PruneServiceProbes(before); err != nil {
+		zap.L().Error("清理探测记录失败", zap.Error(err))
+	}
+}
+
+// probeService 探测单个服务并更新其状态和可用率
+func probeService(ctx context.Context, service *models.ServiceModel, cfg core.ProbeConfig) {
+	probe := runProbe(ctx, service, time.Duration(cfg.Timeout)*time.Second)
+	if ctx.Err() != nil {
+		return
+	}
+	if err := models.RecordServiceProbe(probe); err != nil {
+		zap.L().Error("记录探测结果失败", zap.String("service", service.Name), zap.Error(err))
+		return
+	}
+	// 配置错误需要管理员处理，不据此降级服务
+	if probe.Misconfigured {
+		zap.L().Warn("服务探测返回鉴权或配置错误，跳过状态更新",
+			zap.String("service", service.Name),
+			zap.Int("status_code", probe.StatusCode),
+			zap.String("error", probe.Error),
+		)
+		return
+	}
+
+	recent, err := models.GetRecentServiceProbes(service.ID, max(cfg.DownThreshold, cfg.RecoverThreshold))
+	if err != nil {
+		zap.L().Error("查询探测记录失败", zap.String("service", service.Name), zap.Error(err))
+		return
+	}
+	uptime, total, err := models.CalculateServiceUptime(service.ID, time.Now().Add(-time.Duration(cfg.WindowHours)*time.Hour))
+	if err != nil || total == 0 {
+		return
+	}
+
+	status := nextServiceStatus(service.Status, recent, cfg)
+	if strings.EqualFold(status, service.Status) {
+		status = ""
+	} else {
+		zap.L().Warn("服务状态变更",
+			zap.String("service", service.Name),
+			zap.String("from", service.Status),
+			zap.String("to", status),
+		)
+	}
+
+	if err := models.UpdateServiceHealth(service.ID, status, fmt.Sprintf("%.2f%%", uptime)); err != nil {
+		zap.L().Error("更新服务健康状态失败", zap.String("service", service.Name), zap.Error(err))
+	}
+}
+
+// runProbe 依次尝试服务的候选上游，任一成功即视为服务可用
+func runProbe(ctx context.Context, service *models.ServiceModel, timeout time.Duration) *models.ServiceProbe {
+	probe := &models.ServiceProbe{ServiceID: service.ID}
+
+	upstreams, err := Candidates(service)
+	if err != nil {
+		probe.Error = err.Error()
+		probe.Misconfigured = true
+		return probe
+	}
+	if len(upstreams) > maxAttempts() {
+		upstreams = upstreams[:maxAttempts()]
+	}
+
+	req := &models.ChatCompletionRequest{
+		Model:     service.ModelID,
+		Messages:  []models.ChatMessage{{Role: "user", Content: "ping"}},
+		MaxTokens: 1,
+	}
+
+	misconfigured := true
+	for _, up := range upstreams {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		_, err := ChatCompletion(probeCtx, up, req)
+		cancel()
+
+		probe.ChannelID = up.ChannelID
+		probe.LatencyMs = time.Since(start).Milliseconds()
+		probe.StatusCode = 0
+		probe.Error = ""
+
+		if err == nil {
+			probe.Success = true
+			probe.StatusCode = http.StatusOK
+			return probe
+		}
+
+		probe.Error = err.Error()
+		var upErr *UpstreamError
+		if errors.As(err, &upErr) {
+			probe.StatusCode = upErr.StatusCode
+		}
+		if !misconfiguredStatus(probe.StatusCode) {
+			misconfigured = false
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	// 所有候选上游都是配置错误时才标记，其中任一真实故障仍计为失败
+	probe.Misconfigured = misconfigured
+	return probe
+}
+
+// misconfiguredStatus 鉴权或请求配置错误的状态码，说明密钥、模型等配置有误而非上游故障
+func misconfiguredStatus(code int) bool {
+	switch code {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusPaymentRequired,
+		http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// nextServiceStatus 根据最近的探测记录（时间倒序）计算服务应处的状态
+func nextServiceStatus(current string, recent []models.ServiceProbe, cfg core.ProbeConfig) string {
+	current = strings.ToLower(current)
+
+	var successes, failures int
+	for _, p := range recent {
+		if p.Success != recent[0].Success {
+			break
+		}
+		if p.Success {
+			successes++
+		} else {
+			failures++
+		}
+	}
+
+	switch {
+	case successes >= cfg.RecoverThreshold:
+		return models.ServiceStatusActive
+	case failures >= cfg.DownThreshold:
+		return models.ServiceStatusInactive
+	case failures >= cfg.FailThreshold && current == models.ServiceStatusActive:
+		return models.ServiceStatusMaintenance
+	}
+	return current
+}
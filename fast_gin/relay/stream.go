@@ -0,0 +1,74 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"macg/models"
+	"macg/provider"
+)
+
+// Stream 上游流式响应
+type Stream struct {
+	body    io.ReadCloser
+	decoder provider.StreamDecoder
+	cancel  context.CancelFunc
+}
+
+// ChatCompletionStream 发起流式对话补全请求
+// ctx 取消（如客户端断开）时会同时中断上游请求；超时只作用于等待响应头阶段
+func ChatCompletionStream(ctx context.Context, up Upstream, req *models.ChatCompletionRequest) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(Timeout(), cancel)
+
+	httpReq, err := up.Provider.NewRequest(ctx, up.BaseURL, up.APIKey, req)
+	if err != nil {
+		timer.Stop()
+		cancel()
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	timer.Stop()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("call upstream: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer cancel()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &UpstreamError{StatusCode: resp.StatusCode, Body: body, provider: up.Provider}
+	}
+
+	return &Stream{
+		body:    resp.Body,
+		decoder: up.Provider.NewStreamDecoder(resp.Body),
+		cancel:  cancel,
+	}, nil
+}
+
+// Recv 读取下一个统一格式数据块，返回解析后的结构和可转发的 JSON
+// 流结束时返回 io.EOF
+func (s *Stream) Recv() (*models.ChatCompletionChunk, []byte, error) {
+	chunk, raw, err := s.decoder.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if raw == nil {
+		if raw, err = json.Marshal(chunk); err != nil {
+			return nil, nil, fmt.Errorf("encode stream chunk: %w", err)
+		}
+	}
+	return chunk, raw, nil
+}
+
+// Close 关闭流并中断上游连接
+func (s *Stream) Close() error {
+	s.cancel()
+	return s.body.Close()
+}
@@ -0,0 +1,235 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/heap"
+	"embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/dlclark/regexp2"
+)
+
+// ============================================================================
+// 字节级 BPE 编码（与 tiktoken 算法一致）
+// 词表为 tiktoken 格式：每行 "base64(token字节) rank"，gzip 压缩后嵌入二进制
+// ============================================================================
+
+//go:embed vocab/*.tiktoken.gz
+var vocabFS embed.FS
+
+const (
+	Cl100kBase = "cl100k_base"
+	O200kBase  = "o200k_base"
+)
+
+// 预分词正则，与 tiktoken 保持一致（含 Go 标准库不支持的负向预查，故使用 regexp2）
+var patterns = map[string]string{
+	Cl100kBase: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+	O200kBase: `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+}
+
+// Encoding BPE 编码器
+type Encoding struct {
+	Name    string
+	ranks   map[string]int
+	pattern *regexp2.Regexp
+}
+
+var (
+	encodings   = map[string]*Encoding{}
+	encodingsMu sync.Mutex
+)
+
+// GetEncoding 按名称获取编码器，首次使用时加载词表
+func GetEncoding(name string) (*Encoding, error) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[name]; ok {
+		return enc, nil
+	}
+
+	pattern, ok := patterns[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding: %s", name)
+	}
+	ranks, err := loadRanks(name)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := &Encoding{
+		Name:    name,
+		ranks:   ranks,
+		pattern: regexp2.MustCompile(pattern, regexp2.Unicode),
+	}
+	encodings[name] = enc
+	return enc, nil
+}
+
+// loadRanks 读取嵌入的词表
+func loadRanks(name string) (map[string]int, error) {
+	f, err := vocabFS.Open("vocab/" + name + ".tiktoken.gz")
+	if err != nil {
+		return nil, fmt.Errorf("open vocab %s: %w", name, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("decompress vocab %s: %w", name, err)
+	}
+	defer gz.Close()
+
+	ranks := make(map[string]int, 200000)
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		token, rank, ok := bytes.Cut(line, []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("invalid vocab line: %q", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vocab token %q: %w", token, err)
+		}
+		r, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("invalid vocab rank %q: %w", rank, err)
+		}
+		ranks[string(decoded)] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read vocab %s: %w", name, err)
+	}
+	return ranks, nil
+}
+
+// Encode 将文本编码为 token 序列，特殊 token 按普通文本处理
+func (e *Encoding) Encode(text string) []int {
+	var tokens []int
+	e.split(text, func(piece string) {
+		if rank, ok := e.ranks[piece]; ok {
+			tokens = append(tokens, rank)
+			return
+		}
+		tokens = append(tokens, e.bytePairEncode([]byte(piece))...)
+	})
+	return tokens
+}
+
+// Count 统计文本的 token 数
+func (e *Encoding) Count(text string) int {
+	count := 0
+	e.split(text, func(piece string) {
+		if _, ok := e.ranks[piece]; ok {
+			count++
+			return
+		}
+		count += len(e.bytePairEncode([]byte(piece)))
+	})
+	return count
+}
+
+// split 按预分词正则切分文本
+func (e *Encoding) split(text string, fn func(piece string)) {
+	m, err := e.pattern.FindStringMatch(text)
+	for err == nil && m != nil {
+		fn(m.String())
+		m, err = e.pattern.FindNextMatch(m)
+	}
+}
+
+// bytePairEncode 对单个片段反复合并 rank 最小的相邻字节对（rank 相同时取最左侧）。
+// 片段用以起始位置为下标的链表表示，候选字节对放在小顶堆中，合并后只重新计算左右两个相邻对，
+// 复杂度 O(n log n)，超长的无空白片段（base64、压缩 JSON 等）也不会拖慢请求
+func (e *Encoding) bytePairEncode(piece []byte) []int {
+	n := len(piece)
+	if n == 1 {
+		return []int{e.ranks[string(piece)]}
+	}
+
+	// 节点 i 覆盖 piece[i:next[i]]，next 为 n 表示结尾
+	next := make([]int, n)
+	prev := make([]int, n)
+	version := make([]int, n)
+	for i := range piece {
+		next[i], prev[i] = i+1, i-1
+	}
+
+	candidates := &mergeHeap{}
+	push := func(i int) {
+		if i < 0 || next[i] >= n {
+			return
+		}
+		if r, ok := e.ranks[string(piece[i:next[next[i]]])]; ok {
+			heap.Push(candidates, mergeCandidate{rank: r, start: i, version: version[i]})
+		}
+	}
+	for i := 0; i < n-1; i++ {
+		push(i)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(mergeCandidate)
+		// 节点被合并或其右侧相邻节点变化后，旧的候选作废
+		if c.version != version[c.start] {
+			continue
+		}
+
+		right := next[c.start]
+		next[c.start] = next[right]
+		if next[right] < n {
+			prev[next[right]] = c.start
+		}
+		version[right] = -1
+		version[c.start]++
+		push(c.start)
+		if left := prev[c.start]; left >= 0 {
+			version[left]++
+			push(left)
+		}
+	}
+
+	var tokens []int
+	for i := 0; i < n; i = next[i] {
+		tokens = append(tokens, e.ranks[string(piece[i:next[i]])])
+	}
+	return tokens
+}
+
+// mergeCandidate 待合并的相邻字节对，start 为左侧节点
+type mergeCandidate struct {
+	rank    int
+	start   int
+	version int
+}
+
+// mergeHeap 按 rank、位置排序的小顶堆
+type mergeHeap []mergeCandidate
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].start < h[j].start
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeCandidate)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,110 @@
+package tokenizer
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// naiveBytePairEncode 逐轮扫描所有相邻对的参考实现，用于校验堆实现的合并顺序
+func naiveBytePairEncode(e *Encoding, piece []byte) []int {
+	parts := make([]int, len(piece)+1)
+	for i := range parts {
+		parts[i] = i
+	}
+	for len(parts) > 2 {
+		minRank, minIdx := math.MaxInt, -1
+		for i := 0; i < len(parts)-2; i++ {
+			if r, ok := e.ranks[string(piece[parts[i]:parts[i+2]])]; ok && r < minRank {
+				minRank, minIdx = r, i
+			}
+		}
+		if minIdx < 0 {
+			break
+		}
+		parts = append(parts[:minIdx+1], parts[minIdx+2:]...)
+	}
+
+	tokens := make([]int, 0, len(parts)-1)
+	for i := 0; i < len(parts)-1; i++ {
+		tokens = append(tokens, e.ranks[string(piece[parts[i]:parts[i+1]])])
+	}
+	return tokens
+}
+
+func mustEncoding(tb testing.TB, name string) *Encoding {
+	tb.Helper()
+	enc, err := GetEncoding(name)
+	if err != nil {
+		tb.Fatalf("GetEncoding(%s): %v", name, err)
+	}
+	return enc
+}
+
+// randomPiece 生成由字母、数字、符号和多字节字符组成的无空白片段
+func randomPiece(r *rand.Rand, n int) []byte {
+	alphabet := []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+/=_-{}\":,.中文分词测试😀")
+	var b strings.Builder
+	for b.Len() < n {
+		b.WriteRune(alphabet[r.Intn(len(alphabet))])
+	}
+	return []byte(b.String())
+}
+
+func TestEncodeKnownTokens(t *testing.T) {
+	cases := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{Cl100kBase, "hello world", []int{15339, 1917}},
+		{O200kBase, "hello world", []int{24912, 2375}},
+	}
+	for _, tc := range cases {
+		if got := mustEncoding(t, tc.encoding).Encode(tc.text); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s Encode(%q) = %v, want %v", tc.encoding, tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestBytePairEncodeMatchesNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, name := range []string{Cl100kBase, O200kBase} {
+		enc := mustEncoding(t, name)
+		for i := 0; i < 200; i++ {
+			piece := randomPiece(r, 1+r.Intn(300))
+			got, want := enc.bytePairEncode(piece), naiveBytePairEncode(enc, piece)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s bytePairEncode(%q) = %v, want %v", name, piece, got, want)
+			}
+		}
+	}
+}
+
+// TestCountLongPiece 超长无空白片段（如内联 base64 图片）应在线性对数时间内完成
+func TestCountLongPiece(t *testing.T) {
+	enc := mustEncoding(t, Cl100kBase)
+	text := string(randomPiece(rand.New(rand.NewSource(2)), 1<<20))
+
+	start := time.Now()
+	if n := enc.Count(text); n == 0 {
+		t.Fatal("Count returned 0")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Count of 1 MiB piece took %s", elapsed)
+	}
+}
+
+func BenchmarkBytePairEncode(b *testing.B) {
+	enc := mustEncoding(b, Cl100kBase)
+	piece := randomPiece(rand.New(rand.NewSource(3)), 64<<10)
+
+	b.SetBytes(int64(len(piece)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		enc.bytePairEncode(piece)
+	}
+}
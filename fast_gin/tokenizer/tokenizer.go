@@ -0,0 +1,125 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"macg/models"
+
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// 请求 Token 估算
+// OpenAI 模型与官方编码一致；其他厂商的模型没有公开词表，使用 cl100k_base 近似
+// ============================================================================
+
+// 对话格式的固定开销，与 OpenAI 官方计算方式一致
+const (
+	tokensPerMessage = 3  // 每条消息的 <|start|>role<|message|> 等标记
+	tokensPerName    = 1  // 消息带 name 字段时额外计入
+	tokensPerReply   = 3  // 回复以 <|start|>assistant<|message|> 开头
+	tokensPerImage   = 85 // 图片按低清晰度计费估算
+)
+
+// o200kPrefixes 使用 o200k_base 的模型前缀
+var o200kPrefixes = []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-4o", "o1", "o3", "o4"}
+
+// EncodingForModel 返回模型对应的编码名称
+func EncodingForModel(model string) string {
+	model = strings.ToLower(model)
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return O200kBase
+		}
+	}
+	return Cl100kBase
+}
+
+// encodingForModel 获取模型对应的编码器，加载失败时返回 nil
+func encodingForModel(model string) *Encoding {
+	enc, err := GetEncoding(EncodingForModel(model))
+	if err != nil {
+		zap.L().Error("加载分词词表失败", zap.String("model", model), zap.Error(err))
+		return nil
+	}
+	return enc
+}
+
+// CountText 统计纯文本的 token 数
+func CountText(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	enc := encodingForModel(model)
+	if enc == nil {
+		return estimate(text)
+	}
+	return enc.Count(text)
+}
+
+// CountTokens 统计对话消息的提示 token 数
+func CountTokens(model string, messages []models.ChatMessage) int {
+	enc := encodingForModel(model)
+	count := func(text string) int {
+		if enc == nil {
+			return estimate(text)
+		}
+		return enc.Count(text)
+	}
+
+	total := tokensPerReply
+	for _, msg := range messages {
+		total += tokensPerMessage
+		total += count(msg.Role)
+		total += count(msg.TextContent())
+		if msg.Name != "" {
+			total += tokensPerName + count(msg.Name)
+		}
+		total += imageCount(msg.Content) * tokensPerImage
+		for _, tc := range msg.ToolCalls {
+			total += count(tc.Function.Name) + count(tc.Function.Arguments)
+		}
+	}
+	return total
+}
+
+// CountRequestTokens 统计完整请求的提示 token 数，包括工具定义
+func CountRequestTokens(req *models.ChatCompletionRequest) int {
+	total := CountTokens(req.Model, req.Messages)
+	if len(req.Tools) > 0 {
+		if raw, err := json.Marshal(req.Tools); err == nil {
+			total += CountText(req.Model, string(raw))
+		}
+	}
+	return total
+}
+
+// imageCount 统计多模态内容中的图片数量
+func imageCount(content interface{}) int {
+	parts, ok := content.([]interface{})
+	if !ok {
+		return 0
+	}
+	n := 0
+	for _, p := range parts {
+		if part, ok := p.(map[string]interface{}); ok && part["type"] == "image_url" {
+			n++
+		}
+	}
+	return n
+}
+
+// estimate 词表不可用时的粗略估算：中日韩等宽字符每字计1，拉丁字符约4个计1
+func estimate(text string) int {
+	wide, narrow := 0, 0
+	for _, r := range text {
+		if r > unicode.MaxLatin1 {
+			wide++
+		} else {
+			narrow++
+		}
+	}
+	return wide + (narrow+3)/4
+}
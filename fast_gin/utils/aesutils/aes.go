@@ -166,3 +166,57 @@ func obfuscatedUnpadding(data []byte) ([]byte, error) {
 
 	return data[:length-padding], nil
 }
+
+// EncryptWithKey 使用指定密钥进行AES-256加密
+// 参数:
+//   - plaintext: 待加密的字符串
+//   - key: 32字节密钥
+//
+// 返回:
+//   - Base64编码的 IV + 密文
+//   - 错误信息
+func EncryptWithKey(plaintext string, key []byte) (string, error) {
+	if len(key) != 32 {
+		return "", errors.New("密钥长度必须为32字节(AES-256)")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	ivBytes := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, ivBytes); err != nil {
+		return "", err
+	}
+
+	plaintextBytes := obfuscatedPadding([]byte(plaintext), aes.BlockSize)
+	ciphertext := make([]byte, len(plaintextBytes))
+	cipher.NewCBCEncrypter(block, ivBytes).CryptBlocks(ciphertext, plaintextBytes)
+
+	return base64.StdEncoding.EncodeToString(append(ivBytes, ciphertext...)), nil
+}
+
+// DecryptWithKey 解密 EncryptWithKey 生成的数据
+// 参数:
+//   - encoded: Base64编码的 IV + 密文
+//   - key: 32字节密钥
+//
+// 返回:
+//   - 解密后的字符串
+//   - 错误信息
+func DecryptWithKey(encoded string, key []byte) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aes.BlockSize {
+		return "", errors.New("密文长度不正确")
+	}
+
+	return Decrypt(
+		base64.StdEncoding.EncodeToString(data[aes.BlockSize:]),
+		base64.StdEncoding.EncodeToString(data[:aes.BlockSize]),
+		base64.StdEncoding.EncodeToString(key),
+	)
+}
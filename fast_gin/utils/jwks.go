@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// JWTKey RS256 签名密钥，Private 为空时只用于验证
+type JWTKey struct {
+	Kid     string
+	Private *rsa.PrivateKey
+	Public  *rsa.PublicKey
+}
+
+// JWK JSON Web Key（RFC 7517）中的 RSA 公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+var (
+	rsaSigningKey *JWTKey            // 当前签名密钥，为空时使用 HS256
+	rsaKeys       map[string]*JWTKey // 按 kid 索引的验证密钥
+	rsaKeyOrder   []string           // 保持配置顺序，用于输出 JWKS
+)
+
+// SetRSAKeys 启用 RS256 签名：signingKid 对应的密钥用于签名，其余密钥只用于验证
+// signingKid 为空时使用第一个带私钥的密钥
+func SetRSAKeys(keys []JWTKey, signingKid string) error {
+	index := make(map[string]*JWTKey, len(keys))
+	order := make([]string, 0, len(keys))
+	var signing *JWTKey
+
+	for i := range keys {
+		key := &keys[i]
+		if key.Public == nil && key.Private != nil {
+			key.Public = &key.Private.PublicKey
+		}
+		if key.Public == nil {
+			return errors.New("JWT 密钥缺少公钥")
+		}
+		if key.Kid == "" {
+			kid, err := KeyID(key.Public)
+			if err != nil {
+				return err
+			}
+			key.Kid = kid
+		}
+		if _, exists := index[key.Kid]; exists {
+			return errors.New("JWT 密钥 kid 重复：" + key.Kid)
+		}
+		index[key.Kid] = key
+		order = append(order, key.Kid)
+
+		if signing == nil && key.Private != nil && (signingKid == "" || signingKid == key.Kid) {
+			signing = key
+		}
+	}
+	if signing == nil {
+		return errors.New("没有可用于签名的 JWT 私钥")
+	}
+
+	rsaSigningKey = signing
+	rsaKeys = index
+	rsaKeyOrder = order
+	return nil
+}
+
+// KeyID 由公钥的 SHA-256 指纹生成 kid
+func KeyID(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12]), nil
+}
+
+// JWKS 返回全部 RS256 验证公钥，未启用 RS256 时为空
+func JWKS() []JWK {
+	keys := make([]JWK, 0, len(rsaKeyOrder))
+	for _, kid := range rsaKeyOrder {
+		pub := rsaKeys[kid].Public
+		keys = append(keys, JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: kid,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	return keys
+}
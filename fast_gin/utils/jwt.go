@@ -1,31 +1,82 @@
 package utils
 
 import (
+	"errors"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
 )
 
+// 令牌的 typ 声明
 const (
-	JwtTTL = 24 * 7 * 60 * 60 * time.Second         // 有效期为7day
-	JwtKey = "1eb6acbe-7fb3-49b6-ad7f-d12e3ec4140a" // 设置秘钥明文
+	TokenTypeAccess    = "access"        // 访问令牌
+	TokenTypeTwoFactor = "2fa_challenge" // 双因素认证挑战令牌，只能用于完成登录
 )
 
+// TwoFactorChallengeTTL 双因素认证挑战令牌有效期
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+var (
+	JwtTTL = 15 * time.Minute // 访问令牌有效期，由配置覆盖
+	jwtKey []byte             // 签名密钥，由 SetJWTSecret 设置
+)
+
+// SetJWTSecret 设置签名密钥和访问令牌有效期，启动时调用
+func SetJWTSecret(secret []byte, ttl time.Duration) {
+	jwtKey = secret
+	if ttl > 0 {
+		JwtTTL = ttl
+	}
+}
+
 func GetUUID() string {
 	return uuid.New().String()
 }
 
 func CreateJWT(subject string) string {
-	token, _ := createJWT(subject, JwtTTL, GetUUID())
+	token, _ := createJWT(subject, JwtTTL, GetUUID(), nil)
 	return token
 }
 
 func CreateJWTWithTTL(subject string, ttl time.Duration) (string, error) {
-	return createJWT(subject, ttl, GetUUID())
+	return createJWT(subject, ttl, GetUUID(), nil)
+}
+
+// CreateAccessToken 签发访问令牌，version 为用户当前的令牌版本，
+// 返回令牌、jti 和过期时间
+func CreateAccessToken(subject string, version int) (string, string, time.Time, error) {
+	jti := GetUUID()
+	expiresAt := time.Now().Add(JwtTTL)
+	token, err := createJWT(subject, JwtTTL, jti, jwt.MapClaims{
+		"typ": TokenTypeAccess,
+		"ver": version,
+	})
+	return token, jti, expiresAt, err
 }
 
-func createJWT(subject string, ttl time.Duration, uuid string) (string, error) {
+// CreateImpersonationToken 签发模拟登录的访问令牌：sub 为被模拟用户，
+// act 声明（RFC 8693）记录实际操作的管理员，返回令牌、jti 和过期时间
+func CreateImpersonationToken(subject string, version int, actor string, ttl time.Duration) (string, string, time.Time, error) {
+	jti := GetUUID()
+	expiresAt := time.Now().Add(ttl)
+	token, err := createJWT(subject, ttl, jti, jwt.MapClaims{
+		"typ": TokenTypeAccess,
+		"ver": version,
+		"act": map[string]interface{}{"sub": actor},
+	})
+	return token, jti, expiresAt, err
+}
+
+// CreateTwoFactorChallenge 签发双因素认证挑战令牌，密码校验通过后返回给客户端
+func CreateTwoFactorChallenge(subject string, version int) (string, error) {
+	return createJWT(subject, TwoFactorChallengeTTL, GetUUID(), jwt.MapClaims{
+		"typ": TokenTypeTwoFactor,
+		"ver": version,
+	})
+}
+
+func createJWT(subject string, ttl time.Duration, uuid string, extra jwt.MapClaims) (string, error) {
 	nowTime := time.Now()
 	expireTime := nowTime.Add(ttl)
 
@@ -36,18 +87,43 @@ func createJWT(subject string, ttl time.Duration, uuid string) (string, error) {
 		"iat": nowTime.Unix(),
 		"exp": expireTime.Unix(),
 	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	// 配置了 RS256 密钥时用当前密钥签名，并在头部写入 kid 供验证方选择公钥
+	if rsaSigningKey != nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = rsaSigningKey.Kid
+		return token.SignedString(rsaSigningKey.Private)
+	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(JwtKey))
+	return token.SignedString(jwtKey)
 }
 
 func CreateJWTWithID(id, subject string, ttl time.Duration) (string, error) {
-	return createJWT(subject, ttl, id)
+	return createJWT(subject, ttl, id, nil)
 }
 
 func ParseJWT(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(JwtKey), nil
+		// 只接受当前配置的签名算法：启用 RS256 后拒绝 HMAC 令牌，
+		// 否则泄露的共享密钥或由 secret_key 派生的密钥仍可伪造令牌
+		if rsaSigningKey != nil {
+			if token.Method != jwt.SigningMethodRS256 {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			kid, _ := token.Header["kid"].(string)
+			if key, ok := rsaKeys[kid]; ok {
+				return key.Public, nil
+			}
+			return nil, errors.New("unknown kid: " + kid)
+		}
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return jwtKey, nil
 	})
 
 	if err != nil {
@@ -93,17 +93,28 @@ func PublicKeyFromPrivateKey(privateKey *rsa.PrivateKey) *rsa.PublicKey {
 	return &privateKey.PublicKey
 }
 
-// ParsePrivateKeyFromPEM 从 PEM 格式字符串中解析 RSA 私钥
+// ParsePrivateKeyFromPEM 从 PEM 格式字符串中解析 RSA 私钥，支持 PKCS#1 和 PKCS#8
 func ParsePrivateKeyFromPEM(privPEM string) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode([]byte(privPEM))
-	if block == nil || block.Type != "RSA PRIVATE KEY" {
+	if block == nil {
 		return nil, errors.New("failed to decode PEM block containing RSA private key")
 	}
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return nil, err
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("not a valid RSA private key")
+		}
+		return rsaKey, nil
+	default:
+		return nil, errors.New("failed to decode PEM block containing RSA private key")
 	}
-	return privateKey, nil
 }
 
 // ParsePublicKeyFromPEM 从 PEM 格式字符串中解析 RSA 公钥
@@ -112,6 +123,9 @@ func ParsePublicKeyFromPEM(pubPEM string) (*rsa.PublicKey, error) {
 	if block == nil || (block.Type != "PUBLIC KEY" && block.Type != "RSA PUBLIC KEY") {
 		return nil, errors.New("failed to decode PEM block containing RSA public key")
 	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
 	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录 B 的 SHA1 测试密钥 "12345678901234567890"
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// 附录 B 的 8 位验证码取后 6 位
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tc := range cases {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tc.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("TOTPCode(T=%d) = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+	code := func(offset int64) string {
+		c, err := TOTPCode(rfc6238Secret, step+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	cases := []struct {
+		name     string
+		code     string
+		lastUsed int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(0), 0, step, true},
+		{"previous step within skew", code(-1), 0, step - 1, true},
+		{"next step within skew", code(1), 0, step + 1, true},
+		{"two steps behind", code(-2), 0, 0, false},
+		{"two steps ahead", code(2), 0, 0, false},
+		{"surrounding whitespace", " " + code(0) + " ", 0, step, true},
+		{"wrong length", code(0)[:5], 0, 0, false},
+		{"replayed step", code(0), step, 0, false},
+		{"step before last used", code(-1), step, 0, false},
+		{"step after last used", code(1), step, step + 1, true},
+		{"earlier step still unused", code(-1), step - 2, step - 1, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(rfc6238Secret, tc.code, now, tc.lastUsed)
+			if ok != tc.wantOK || gotStep != tc.wantStep {
+				t.Errorf("ValidateTOTP = (%d, %v), want (%d, %v)", gotStep, ok, tc.wantStep, tc.wantOK)
+			}
+		})
+	}
+}